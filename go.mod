@@ -8,6 +8,7 @@ require (
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/joho/godotenv v1.3.0
 	github.com/kyokomi/emoji v2.2.2+incompatible
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/slack-go/slack v0.6.4
 	github.com/urfave/cli/v2 v2.2.0
@@ -1,7 +1,14 @@
 package slackadapter
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,3 +39,54 @@ func Timestamp(t *time.Time) string {
 	}
 	return fmt.Sprintf("%d.%6d", t.Unix(), t.Nanosecond()/1000)
 }
+
+// apiURL is the base URL of Slack Web API.
+var apiURL = "https://slack.com/api/"
+
+// callAPI calls the method of Slack Web API with form, and decodes the
+// response to v. It is used instead of slack-go when the response should be
+// kept as is, or has fields which slack-go doesn't have. When rate limited,
+// it waits as requested and retries.
+func callAPI(ctx context.Context, token, method string, form url.Values, v interface{}) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+method, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			wait, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if err != nil {
+				wait = 1
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(wait) * time.Second):
+			}
+			continue
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		var e Error
+		if err := json.Unmarshal(b, &e); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", method, err)
+		}
+		if !e.Ok {
+			return &e
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", method, err)
+		}
+		return nil
+	}
+}
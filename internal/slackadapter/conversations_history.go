@@ -2,9 +2,10 @@ package slackadapter
 
 import (
 	"context"
+	"net/url"
+	"strconv"
 	"time"
 
-	"github.com/slack-go/slack"
 	"github.com/vim-jp/slacklog-generator/internal/slacklog"
 )
 
@@ -27,34 +28,59 @@ type ConversationsHistoryResponse struct {
 }
 
 // ConversationsHistory gets conversation messages in a channel.
+// The response is decoded into slacklog.Message directly, to keep "blocks"
+// as is. slack-go can't keep contents of rich_text blocks.
 func ConversationsHistory(ctx context.Context, token, channel string, params ConversationsHistoryParams) (*ConversationsHistoryResponse, error) {
-	client := slack.New(token)
-	res, err := client.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
-		ChannelID: channel,
-		Cursor:    string(params.Cursor),
-		Limit:     params.Limit,
-		Oldest:    Timestamp(params.Oldest),
-		Latest:    Timestamp(params.Latest),
-		Inclusive: params.Inclusive,
-	})
-	if err != nil {
+	form := url.Values{"channel": {channel}}
+	if params.Cursor != "" {
+		form.Set("cursor", string(params.Cursor))
+	}
+	if params.Limit > 0 {
+		form.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.Oldest != nil {
+		form.Set("oldest", Timestamp(params.Oldest))
+	}
+	if params.Latest != nil {
+		form.Set("latest", Timestamp(params.Latest))
+	}
+	if params.Inclusive {
+		form.Set("inclusive", "true")
+	}
+	var r ConversationsHistoryResponse
+	if err := callAPI(ctx, token, "conversations.history", form, &r); err != nil {
 		return nil, err
 	}
+	return &r, nil
+}
 
-	var messages []*slacklog.Message
-	for _, m := range res.Messages {
-		messages = append(messages, &slacklog.Message{
-			Message: m,
-		})
-	}
+// ConversationsRepliesParams is optional parameters for ConversationsReplies
+type ConversationsRepliesParams struct {
+	Cursor Cursor `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// ConversationsRepliesResponse is response for ConversationsReplies
+type ConversationsRepliesResponse struct {
+	Ok               bool                `json:"ok"`
+	Messages         []*slacklog.Message `json:"messages,omitempty"`
+	HasMore          bool                `json:"has_more"`
+	ResponseMetadata *NextCursor         `json:"response_metadata"`
+}
 
-	return &ConversationsHistoryResponse{
-		Ok:       true,
-		Messages: messages,
-		HasMore:  res.HasMore,
-		PinCount: res.PinCount,
-		ResponseMetadata: &NextCursor{
-			NextCursor: Cursor(res.ResponseMetaData.NextCursor),
-		},
-	}, nil
+// ConversationsReplies gets messages in a thread, including the root
+// message. Like ConversationsHistory, "blocks" are kept as is.
+func ConversationsReplies(ctx context.Context, token, channel, ts string, params ConversationsRepliesParams) (*ConversationsRepliesResponse, error) {
+	form := url.Values{"channel": {channel}, "ts": {ts}}
+	if params.Cursor != "" {
+		form.Set("cursor", string(params.Cursor))
+	}
+	if params.Limit > 0 {
+		form.Set("limit", strconv.Itoa(params.Limit))
+	}
+	var r ConversationsRepliesResponse
+	if err := callAPI(ctx, token, "conversations.replies", form, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
 }
@@ -0,0 +1,112 @@
+package slackadapter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-jp/slacklog-generator/internal/jsonwriter"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+const richTextBlocks = `[{"type":"rich_text","block_id":"b1","elements":[{"type":"rich_text_section","elements":[` +
+	`{"type":"text","text":"plain "},{"type":"text","text":"bold","style":{"bold":true}}]}]}]`
+
+// TestConversations_roundTrip fetches messages, saves them as fetch-messages
+// does, and renders rich_text blocks of the saved messages.
+func TestConversations_roundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer xoxb-test" {
+			t.Errorf("unexpected Authorization: %s", got)
+		}
+		switch r.URL.Path {
+		case "/conversations.history":
+			if got := r.Form.Get("channel"); got != "C001" {
+				t.Errorf("unexpected channel: %s", got)
+			}
+			w.Write([]byte(`{"ok":true,"has_more":false,"messages":[` +
+				`{"type":"message","user":"U001","text":"plain *bold*","ts":"1580000000.000100","thread_ts":"1580000000.000100","blocks":` + richTextBlocks + `}]}`))
+		case "/conversations.replies":
+			if got := r.Form.Get("ts"); got != "1580000000.000100" {
+				t.Errorf("unexpected ts: %s", got)
+			}
+			w.Write([]byte(`{"ok":true,"has_more":false,"messages":[` +
+				`{"type":"message","user":"U002","text":"reply *bold*","ts":"1580000100.000200","thread_ts":"1580000000.000100","blocks":` + richTextBlocks + `}]}`))
+		default:
+			w.Write([]byte(`{"ok":false,"error":"unknown_method"}`))
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { apiURL = u }(apiURL)
+	apiURL = srv.URL + "/"
+
+	ctx := context.Background()
+	h, err := ConversationsHistory(ctx, "xoxb-test", "C001", ConversationsHistoryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ConversationsReplies(ctx, "xoxb-test", "C001", "1580000000.000100", ConversationsRepliesParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpPath, err := ioutil.TempDir("", "slackadapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpPath)
+	path := filepath.Join(tmpPath, "2020-01-26.json")
+	fw, err := jsonwriter.CreateFile(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range append(h.Messages, r.Messages...) {
+		if err := fw.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var saved slacklog.Messages
+	if err := slacklog.ReadFileAsJSON(path, true, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("unexpected number of saved messages: %d", len(saved))
+	}
+	c := slacklog.NewTextConverter(nil, nil)
+	for _, m := range saved {
+		got, ok := c.BlocksToHTML(m.Blocks)
+		if !ok {
+			t.Fatalf("blocks of %s are not rendered: %s", m.Timestamp, m.Blocks)
+		}
+		if want := "plain <b>bold</b>"; !strings.Contains(got, want) {
+			t.Errorf("rendered blocks of %s don't contain %q: %s", m.Timestamp, want, got)
+		}
+	}
+}
+
+func TestCallAPI_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"missing_scope"}`))
+	}))
+	defer srv.Close()
+	defer func(u string) { apiURL = u }(apiURL)
+	apiURL = srv.URL + "/"
+
+	_, err := Pins(context.Background(), "xoxb-test", "C001")
+	e, ok := err.(*Error)
+	if !ok || e.Err != "missing_scope" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
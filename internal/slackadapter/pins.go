@@ -0,0 +1,48 @@
+package slackadapter
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+// pinsListResponse is response for pins.list. slack.Item doesn't have
+// "created" and "created_by", so it is defined here.
+type pinsListResponse struct {
+	Ok    bool `json:"ok"`
+	Items []struct {
+		Type      string `json:"type"`
+		Created   int64  `json:"created"`
+		CreatedBy string `json:"created_by"`
+		Message   *struct {
+			User string `json:"user"`
+			Ts   string `json:"ts"`
+		} `json:"message"`
+	} `json:"items"`
+}
+
+// Pins gets pinned messages in a channel, in the same form as "pins" of
+// channels.json in exported logs.
+func Pins(ctx context.Context, token, channel string) ([]slacklog.ChannelPin, error) {
+	var r pinsListResponse
+	// pins.list is Tier 2, callAPI waits and retries when rate limited.
+	if err := callAPI(ctx, token, "pins.list", url.Values{"channel": {channel}}, &r); err != nil {
+		return nil, err
+	}
+
+	var pins []slacklog.ChannelPin
+	for _, item := range r.Items {
+		if item.Type != "message" || item.Message == nil {
+			continue
+		}
+		pins = append(pins, slacklog.ChannelPin{
+			ID:      item.Message.Ts,
+			Typ:     "C",
+			Created: item.Created,
+			User:    item.CreatedBy,
+			Owner:   item.Message.User,
+		})
+	}
+	return pins, nil
+}
@@ -2,6 +2,7 @@ package slackadapter
 
 import (
 	"context"
+	"net/url"
 
 	"github.com/slack-go/slack"
 	"github.com/vim-jp/slacklog-generator/internal/slacklog"
@@ -29,3 +30,20 @@ func Users(ctx context.Context, token string) ([]*slacklog.User, error) {
 
 	return logUsers, nil
 }
+
+// userGroupsListResponse is response for usergroups.list.
+type userGroupsListResponse struct {
+	Ok         bool                  `json:"ok"`
+	UserGroups []*slacklog.UserGroup `json:"usergroups"`
+}
+
+// UserGroups gets user groups, including disabled ones. A token without the
+// usergroups:read scope results *Error which Err is "missing_scope".
+func UserGroups(ctx context.Context, token string) ([]*slacklog.UserGroup, error) {
+	var r userGroupsListResponse
+	form := url.Values{"include_disabled": {"true"}}
+	if err := callAPI(ctx, token, "usergroups.list", form, &r); err != nil {
+		return nil, err
+	}
+	return r.UserGroups, nil
+}
@@ -0,0 +1,44 @@
+package slackadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserGroups(t *testing.T) {
+	scope := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.URL.Path != "/usergroups.list" || r.Form.Get("include_disabled") != "true" {
+			t.Errorf("unexpected request: %s %s", r.URL.Path, r.Form.Encode())
+		}
+		if !scope {
+			w.Write([]byte(`{"ok":false,"error":"missing_scope"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"usergroups":[{"id":"S001","handle":"vim-devs","name":"Vim developers"}]}`))
+	}))
+	defer srv.Close()
+	defer func(u string) { apiURL = u }(apiURL)
+	apiURL = srv.URL + "/"
+
+	groups, err := UserGroups(context.Background(), "xoxb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].ID != "S001" || groups[0].Handle != "vim-devs" {
+		t.Errorf("unexpected user groups: %+v", groups)
+	}
+
+	scope = false
+	_, err = UserGroups(context.Background(), "xoxb-test")
+	var e *Error
+	if !errors.As(err, &e) || e.Err != "missing_scope" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package slacklog
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+)
+
+// Block : Block Kitのブロックやその要素。
+// slack.Blocks はrich_textブロックの内容を保持できないため、表示に必要なフィー
+// ルドを種類によらず1つの構造体で読み込む。
+// https://api.slack.com/reference/block-kit/blocks
+type Block struct {
+	Type string `json:"type"`
+	// Text is a text of a rich text element, or a text object of a section
+	// block or a context element.
+	Text BlockText `json:"text"`
+	// Fields are text objects of a section block.
+	Fields []BlockText `json:"fields"`
+	// Elements are child elements of rich text blocks, context blocks.
+	Elements []*Block `json:"elements"`
+	// Style is a style of a rich text element, or a style of a list.
+	Style BlockStyle `json:"style"`
+	// Indent is a nesting level of a rich text list.
+	Indent int `json:"indent"`
+
+	URL         string `json:"url"`
+	UserID      string `json:"user_id"`
+	ChannelID   string `json:"channel_id"`
+	UsergroupID string `json:"usergroup_id"`
+	// Range is "here", "channel" or "everyone" for a broadcast element.
+	Range string `json:"range"`
+	// Name is a name of an emoji element.
+	Name string `json:"name"`
+	// Timestamp, Format and Fallback are for a date element.
+	Timestamp json.Number `json:"timestamp"`
+	Format    string      `json:"format"`
+	Fallback  string      `json:"fallback"`
+
+	ImageURL  string    `json:"image_url"`
+	AltText   string    `json:"alt_text"`
+	Title     BlockText `json:"title"`
+	Accessory *Block    `json:"accessory"`
+}
+
+// BlockText : Block Kitのテキスト。rich textの要素では文字列、それ以外ではテ
+// キストオブジェクトとなっている。
+type BlockText struct {
+	// Type is "mrkdwn" or "plain_text", or empty for a string.
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// UnmarshalJSON implements "encoding/json".Unmarshaller interface.
+func (t *BlockText) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &t.Text)
+	}
+	type alias BlockText
+	return json.Unmarshal(b, (*alias)(t))
+}
+
+// BlockStyle : rich textの要素の装飾、またはリストの種類。
+type BlockStyle struct {
+	// List is "bullet" or "ordered" for a list.
+	List   string
+	Bold   bool `json:"bold"`
+	Italic bool `json:"italic"`
+	Strike bool `json:"strike"`
+	Code   bool `json:"code"`
+}
+
+// UnmarshalJSON implements "encoding/json".Unmarshaller interface.
+func (s *BlockStyle) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &s.List)
+	}
+	type alias BlockStyle
+	return json.Unmarshal(b, (*alias)(s))
+}
+
+// BlocksToHTML : Block Kitのブロックを表すJSONをHTMLに変換する。
+// 表示できるブロックが無い場合はfalseを返すので、その場合はテキストを
+// ToHTML() で変換すること。
+func (c *TextConverter) BlocksToHTML(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+	var blocks []*Block
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", false
+	}
+	b := &strings.Builder{}
+	for _, block := range blocks {
+		c.writeBlockHTML(b, block)
+	}
+	if b.Len() == 0 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+func (c *TextConverter) writeBlockHTML(b *strings.Builder, block *Block) {
+	switch block.Type {
+	case "rich_text":
+		c.writeHTML(b, richTextToMrkdwn(block.Elements))
+	case "section":
+		b.WriteString("<div class='slacklog-block-section'>")
+		c.writeBlockTextHTML(b, block.Text)
+		if len(block.Fields) > 0 {
+			b.WriteString("<div class='slacklog-block-fields'>")
+			for _, f := range block.Fields {
+				b.WriteString("<div>")
+				c.writeBlockTextHTML(b, f)
+				b.WriteString("</div>")
+			}
+			b.WriteString("</div>")
+		}
+		if a := block.Accessory; a != nil && a.Type == "image" {
+			b.WriteString("<img class='slacklog-block-accessory' src='" + html.EscapeString(a.ImageURL) + "' alt='" + html.EscapeString(a.AltText) + "'>")
+		}
+		b.WriteString("</div>")
+	case "header":
+		b.WriteString("<div class='slacklog-block-header'>")
+		c.writeBlockTextHTML(b, block.Text)
+		b.WriteString("</div>")
+	case "context":
+		b.WriteString("<div class='slacklog-block-context'>")
+		for _, e := range block.Elements {
+			if e.Type == "image" {
+				b.WriteString("<img src='" + html.EscapeString(e.ImageURL) + "' alt='" + html.EscapeString(e.AltText) + "'>")
+				continue
+			}
+			b.WriteString("<span>")
+			c.writeBlockTextHTML(b, BlockText{Type: e.Type, Text: e.Text.Text})
+			b.WriteString("</span>")
+		}
+		b.WriteString("</div>")
+	case "image":
+		b.WriteString("<div class='slacklog-block-image'>")
+		if block.Title.Text != "" {
+			b.WriteString("<div>")
+			c.writeBlockTextHTML(b, block.Title)
+			b.WriteString("</div>")
+		}
+		b.WriteString("<img src='" + html.EscapeString(block.ImageURL) + "' alt='" + html.EscapeString(block.AltText) + "'>")
+		b.WriteString("</div>")
+	case "divider":
+		b.WriteString("<hr class='slacklog-block-divider'>")
+	}
+}
+
+// blockTexts returns texts in blocks except rich_text blocks, which have the
+// same contents as the text of the message. It is used to index texts which
+// are shown only in blocks.
+func blockTexts(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var blocks []*Block
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil
+	}
+	var texts []string
+	add := func(t BlockText) {
+		if t.Text != "" {
+			texts = append(texts, t.Text)
+		}
+	}
+	for _, block := range blocks {
+		switch block.Type {
+		case "section":
+			add(block.Text)
+			for _, f := range block.Fields {
+				add(f)
+			}
+		case "header":
+			add(block.Text)
+		case "context":
+			for _, e := range block.Elements {
+				if e.Type != "image" {
+					add(e.Text)
+				}
+			}
+		case "image":
+			add(block.Title)
+		}
+	}
+	return texts
+}
+
+// writeBlockTextHTML writes a text object.
+func (c *TextConverter) writeBlockTextHTML(b *strings.Builder, t BlockText) {
+	if t.Type == "mrkdwn" {
+		c.writeHTML(b, parseMrkdwn(t.Text))
+		return
+	}
+	b.WriteString(strings.Replace(c.escapeText(t.Text), "\n", "<br>", -1))
+}
+
+// richTextToMrkdwn converts elements of a rich_text block to nodes, to be
+// rendered as same as mrkdwn.
+func richTextToMrkdwn(elements []*Block) []*mrkdwnNode {
+	var (
+		nodes []*mrkdwnNode
+		// lists are the last lists for each indent level.
+		lists []*mrkdwnNode
+	)
+	for _, e := range elements {
+		if e.Type != "rich_text_list" {
+			lists = nil
+		}
+		switch e.Type {
+		case "rich_text_section":
+			inline := trimLineBreaks(richTextInline(e.Elements))
+			if len(nodes) > 0 && len(inline) > 0 && !nodes[len(nodes)-1].isBlock() {
+				nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnLineBreak})
+			}
+			nodes = append(nodes, inline...)
+		case "rich_text_preformatted":
+			t := &strings.Builder{}
+			for _, n := range richTextInline(e.Elements) {
+				writeNodeText(t, n)
+			}
+			nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnPreformatted, Text: strings.TrimSuffix(t.String(), "\n")})
+		case "rich_text_quote":
+			nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnQuote, Children: trimLineBreaks(richTextInline(e.Elements))})
+		case "rich_text_list":
+			list := &mrkdwnNode{Kind: mrkdwnList, Ordered: e.Style.List == "ordered"}
+			for _, item := range e.Elements {
+				list.Children = append(list.Children, &mrkdwnNode{
+					Kind:     mrkdwnListItem,
+					Children: trimLineBreaks(richTextInline(item.Elements)),
+				})
+			}
+			// インデントされたリストは直前の浅いリストの最後の項目に入れる
+			if e.Indent > 0 && e.Indent <= len(lists) && lists[e.Indent-1] != nil {
+				parent := lists[e.Indent-1]
+				if n := len(parent.Children); n > 0 {
+					item := parent.Children[n-1]
+					item.Children = append(item.Children, list)
+				}
+			} else {
+				nodes = append(nodes, list)
+			}
+			for len(lists) <= e.Indent {
+				lists = append(lists, nil)
+			}
+			lists = append(lists[:e.Indent], list)
+		}
+	}
+	return nodes
+}
+
+// richTextInline converts inline elements of rich text.
+func richTextInline(elements []*Block) []*mrkdwnNode {
+	var nodes []*mrkdwnNode
+	for _, e := range elements {
+		var n *mrkdwnNode
+		switch e.Type {
+		case "text":
+			for i, line := range strings.Split(e.Text.Text, "\n") {
+				if i > 0 {
+					nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnLineBreak})
+				}
+				if line != "" {
+					nodes = append(nodes, styleNode(e.Style, &mrkdwnNode{Kind: mrkdwnText, Text: line}))
+				}
+			}
+			continue
+		case "link":
+			if !isSafeLinkURL(e.URL) {
+				text := e.Text.Text
+				if text == "" {
+					text = e.URL
+				}
+				n = &mrkdwnNode{Kind: mrkdwnText, Text: text}
+				break
+			}
+			n = &mrkdwnNode{Kind: mrkdwnLink, URL: e.URL}
+			if e.Text.Text != "" {
+				n.Children = []*mrkdwnNode{{Kind: mrkdwnText, Text: e.Text.Text}}
+			}
+		case "user":
+			n = &mrkdwnNode{Kind: mrkdwnUser, URL: e.UserID, Raw: "<@" + e.UserID + ">"}
+		case "channel":
+			n = &mrkdwnNode{Kind: mrkdwnChannel, URL: e.ChannelID, Raw: "<#" + e.ChannelID + ">"}
+		case "emoji":
+			n = &mrkdwnNode{Kind: mrkdwnEmoji, Text: ":" + e.Name + ":"}
+		case "broadcast":
+			n = &mrkdwnNode{Kind: mrkdwnBroadcast, Text: e.Range}
+		case "usergroup":
+			n = &mrkdwnNode{Kind: mrkdwnUserGroup, URL: e.UsergroupID, Raw: "<!subteam^" + e.UsergroupID + ">"}
+		case "date":
+			n = &mrkdwnNode{Kind: mrkdwnDate, URL: e.Timestamp.String(), Text: e.Format, Raw: e.Fallback}
+			if isSafeLinkURL(e.URL) {
+				n.Link = e.URL
+			}
+		default:
+			if e.Text.Text == "" {
+				continue
+			}
+			n = &mrkdwnNode{Kind: mrkdwnText, Text: e.Text.Text}
+		}
+		nodes = append(nodes, styleNode(e.Style, n))
+	}
+	return nodes
+}
+
+// styleNode wraps n by nodes for the style.
+func styleNode(s BlockStyle, n *mrkdwnNode) *mrkdwnNode {
+	if s.Code && n.Kind == mrkdwnText {
+		n = &mrkdwnNode{Kind: mrkdwnCode, Text: n.Text}
+	}
+	if s.Strike {
+		n = &mrkdwnNode{Kind: mrkdwnStrike, Children: []*mrkdwnNode{n}}
+	}
+	if s.Italic {
+		n = &mrkdwnNode{Kind: mrkdwnItalic, Children: []*mrkdwnNode{n}}
+	}
+	if s.Bold {
+		n = &mrkdwnNode{Kind: mrkdwnBold, Children: []*mrkdwnNode{n}}
+	}
+	return n
+}
+
+// trimLineBreaks removes line breaks at the end of nodes. Sections of rich
+// text end with a line break before a following block.
+func trimLineBreaks(nodes []*mrkdwnNode) []*mrkdwnNode {
+	for len(nodes) > 0 && nodes[len(nodes)-1].Kind == mrkdwnLineBreak {
+		nodes = nodes[:len(nodes)-1]
+	}
+	return nodes
+}
+
+// writeNodeText writes texts in n without any decorations.
+func writeNodeText(b *strings.Builder, n *mrkdwnNode) {
+	switch n.Kind {
+	case mrkdwnLineBreak:
+		b.WriteString("\n")
+	case mrkdwnLink:
+		if len(n.Children) == 0 {
+			b.WriteString(n.URL)
+		}
+	case mrkdwnUser, mrkdwnChannel, mrkdwnUserGroup:
+		b.WriteString(n.Raw)
+	case mrkdwnBroadcast:
+		b.WriteString("<!" + n.Text + ">")
+	case mrkdwnDate:
+		b.WriteString(n.Raw)
+	default:
+		b.WriteString(n.Text)
+	}
+	for _, child := range n.Children {
+		writeNodeText(b, child)
+	}
+}
@@ -0,0 +1,160 @@
+package slacklog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextConverter_BlocksToHTML(t *testing.T) {
+	c := newTestTextConverter()
+	var general Channel
+	general.ID = "C001"
+	general.Name = "general"
+	c.SetChannels([]Channel{general})
+
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"empty", ``, ``},
+		{"no blocks", `[]`, ``},
+		{"unknown block", `[{"type":"actions","elements":[]}]`, ``},
+		{
+			"rich text styles",
+			`[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+				{"type":"text","text":"plain "},
+				{"type":"text","text":"bold","style":{"bold":true}},
+				{"type":"text","text":" "},
+				{"type":"text","text":"both","style":{"bold":true,"italic":true}},
+				{"type":"text","text":" "},
+				{"type":"text","text":"del","style":{"strike":true}},
+				{"type":"text","text":" "},
+				{"type":"text","text":"<code>","style":{"code":true}}
+			]}]}]`,
+			`plain <b>bold</b> <b><i>both</i></b> <del>del</del> <code>&lt;code&gt;</code>`,
+		},
+		{
+			"rich text elements",
+			`[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+				{"type":"user","user_id":"U001"},
+				{"type":"text","text":" "},
+				{"type":"channel","channel_id":"C001"},
+				{"type":"text","text":" "},
+				{"type":"channel","channel_id":"C999"},
+				{"type":"text","text":" "},
+				{"type":"link","url":"https://vim-jp.org/","text":"vim-jp"},
+				{"type":"text","text":" "},
+				{"type":"link","url":"https://example.com/"},
+				{"type":"text","text":" "},
+				{"type":"emoji","name":"smile"},
+				{"type":"emoji","name":"party"}
+			]}]}]`,
+			`<a href='https://example.org/users/U001/'>@alice</a> <a href='https://example.org/C001/'>#general</a> &lt;#C999&gt; <a href='https://vim-jp.org/'>vim-jp</a> <a href='https://example.com/'>https://example.com/</a> 😄<img class='slacklog-emoji' title=':party:' alt=':party:' src='https://example.org/emojis/party.gif'>`,
+		},
+		{
+			"rich text special mentions",
+			`[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+				{"type":"broadcast","range":"here"},
+				{"type":"text","text":" "},
+				{"type":"usergroup","usergroup_id":"S001"},
+				{"type":"text","text":" "},
+				{"type":"date","timestamp":1392734382,"format":"{date_num}","fallback":"Feb 18"}
+			]}]}]`,
+			`<span class='slacklog-mention'>@here</span> <span class='slacklog-mention'>@vim-devs</span> <span class='slacklog-date'>2014-02-18</span>`,
+		},
+		{
+			"rich text unsafe links",
+			`[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+				{"type":"link","url":"javascript:alert(1)","text":"click"},
+				{"type":"text","text":" "},
+				{"type":"link","url":"javascript:alert(1)"},
+				{"type":"text","text":" "},
+				{"type":"date","timestamp":1392734382,"format":"{date_num}","url":"javascript:alert(1)","fallback":"Feb 18"}
+			]}]}]`,
+			`click javascript:alert(1) <span class='slacklog-date'>2014-02-18</span>`,
+		},
+		{
+			"rich text lines",
+			`[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+				{"type":"text","text":"line1\nline2\n"}
+			]}]}]`,
+			`line1<br>line2`,
+		},
+		{
+			"rich text blocks",
+			`[{"type":"rich_text","elements":[
+				{"type":"rich_text_section","elements":[{"type":"text","text":"items:\n"}]},
+				{"type":"rich_text_list","style":"bullet","indent":0,"elements":[
+					{"type":"rich_text_section","elements":[{"type":"text","text":"a"}]}
+				]},
+				{"type":"rich_text_list","style":"ordered","indent":1,"elements":[
+					{"type":"rich_text_section","elements":[{"type":"text","text":"b"}]},
+					{"type":"rich_text_section","elements":[{"type":"text","text":"c"}]}
+				]},
+				{"type":"rich_text_list","style":"bullet","indent":0,"elements":[
+					{"type":"rich_text_section","elements":[{"type":"text","text":"d"}]}
+				]},
+				{"type":"rich_text_preformatted","elements":[{"type":"text","text":"if a < b {\n}"}]},
+				{"type":"rich_text_quote","elements":[{"type":"text","text":"quoted *text*"}]},
+				{"type":"rich_text_section","elements":[{"type":"text","text":"end"}]}
+			]}]`,
+			`items:<ul class='slacklog-list'><li>a<ol class='slacklog-list'><li>b</li><li>c</li></ol></li></ul><ul class='slacklog-list'><li>d</li></ul><pre>if a &lt; b {
+}</pre><blockquote class='slacklog-quote'>quoted *text*</blockquote>end`,
+		},
+		{
+			"section",
+			`[{"type":"section","text":{"type":"mrkdwn","text":"*Title*\n<https://vim-jp.org/|link>"},
+				"fields":[{"type":"plain_text","text":"*a*"},{"type":"mrkdwn","text":"*b*"}],
+				"accessory":{"type":"image","image_url":"https://example.com/a.png","alt_text":"a"}}]`,
+			`<div class='slacklog-block-section'><b>Title</b><br><a href='https://vim-jp.org/'>link</a><div class='slacklog-block-fields'><div>*a*</div><div><b>b</b></div></div><img class='slacklog-block-accessory' src='https://example.com/a.png' alt='a'></div>`,
+		},
+		{
+			"context, image and divider",
+			`[{"type":"context","elements":[{"type":"image","image_url":"https://example.com/i.png","alt_text":"icon"},{"type":"mrkdwn","text":"by *bot*"}]},
+				{"type":"divider"},
+				{"type":"image","image_url":"https://example.com/p.png","alt_text":"pic","title":{"type":"plain_text","text":"Picture"}}]`,
+			`<div class='slacklog-block-context'><img src='https://example.com/i.png' alt='icon'><span>by <b>bot</b></span></div><hr class='slacklog-block-divider'><div class='slacklog-block-image'><div>Picture</div><img src='https://example.com/p.png' alt='pic'></div>`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := c.BlocksToHTML(json.RawMessage(tc.in))
+			if ok != (tc.want != "") {
+				t.Errorf("BlocksToHTML returns %t", ok)
+			}
+			if got != tc.want {
+				t.Errorf("BlocksToHTML mismatch:\nwant: %s\n got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMessage_blocks(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	src := `[{"type":"message","user":"U001","text":"fallback","ts":"1580000000.000100","blocks":[{"type":"rich_text","block_id":"x","elements":[{"type":"rich_text_section","elements":[{"type":"text","text":"rich","style":{"bold":true}}]}]}]}]`
+	path := filepath.Join(tmpPath, "2020-01-26.json")
+	if err := ioutil.WriteFile(path, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var msgs Messages
+	if err := ReadFileAsJSON(path, true, &msgs); err != nil {
+		t.Fatal(err)
+	}
+	html, ok := newTestTextConverter().BlocksToHTML(msgs[0].Blocks)
+	if !ok || html != "<b>rich</b>" {
+		t.Errorf("unexpected HTML: %s", html)
+	}
+
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"elements":[{"type":"rich_text_section"`) {
+		t.Errorf("blocks are not kept: %s", b)
+	}
+}
@@ -1,7 +1,10 @@
 package slacklog
 
 import (
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/slack-go/slack"
 )
@@ -23,6 +26,10 @@ func NewChannelTable(path string, whitelist []string) (*ChannelTable, error) {
 	if err := ReadFileAsJSON(path, true, &channels); err != nil {
 		return nil, err
 	}
+	return newChannelTable(channels, whitelist), nil
+}
+
+func newChannelTable(channels []Channel, whitelist []string) *ChannelTable {
 	channels = FilterChannel(channels, whitelist)
 	sort.Slice(channels, func(i, j int) bool {
 		return channels[i].Name < channels[j].Name
@@ -34,7 +41,159 @@ func NewChannelTable(path string, whitelist []string) (*ChannelTable, error) {
 	return &ChannelTable{
 		Channels:   channels,
 		ChannelMap: channelMap,
-	}, nil
+	}
+}
+
+// ConversationFile : slacklog_dataに含まれる会話の種類毎のファイル。
+type ConversationFile struct {
+	// Name is the name of JSON file, like "channels.json".
+	Name string
+	// ByID is true when directories of messages in exported logs are named
+	// by ID of conversations instead of their name.
+	ByID bool
+	// mark sets flags of the type to the conversation, which are not
+	// included in exported logs.
+	mark func(ch *Channel)
+	// is returns true when the conversation is of the type, by flags which
+	// mark sets. See conversationFileOf.
+	is func(ch *Channel) bool
+	// enabled returns true when the type is enabled by Config.
+	enabled func(cfg *Config) bool
+}
+
+// Enabled returns true when conversations in the file are included in the
+// archive by cfg. Only public channels are enabled by default.
+func (f ConversationFile) Enabled(cfg *Config) bool {
+	return f.enabled(cfg)
+}
+
+// ConversationFiles are files of each type of conversations: public
+// channels, private channels, group DMs and DMs.
+var ConversationFiles = []ConversationFile{
+	{
+		Name:    "channels.json",
+		mark:    func(ch *Channel) {},
+		is:      func(ch *Channel) bool { return true },
+		enabled: func(cfg *Config) bool { return true },
+	},
+	{
+		Name: "groups.json",
+		mark: func(ch *Channel) {
+			ch.IsGroup = true
+			ch.IsPrivate = true
+		},
+		is:      func(ch *Channel) bool { return ch.IsGroup || ch.IsPrivate },
+		enabled: func(cfg *Config) bool { return cfg.PrivateChannels },
+	},
+	{
+		Name: "mpims.json",
+		mark: func(ch *Channel) {
+			ch.IsMpIM = true
+			ch.IsPrivate = true
+		},
+		is:      func(ch *Channel) bool { return ch.IsMpIM },
+		enabled: func(cfg *Config) bool { return cfg.GroupDMs },
+	},
+	{
+		Name: "dms.json",
+		ByID: true,
+		mark: func(ch *Channel) {
+			ch.IsIM = true
+			ch.IsPrivate = true
+		},
+		is:      func(ch *Channel) bool { return ch.IsIM },
+		enabled: func(cfg *Config) bool { return cfg.DMs },
+	},
+}
+
+// conversationFileOf returns the ConversationFile of the type of ch. Types
+// are checked from the end of ConversationFiles, as flags of private channels
+// are also set to group DMs and DMs, and public channels are the rest.
+func conversationFileOf(ch *Channel) ConversationFile {
+	for i := len(ConversationFiles) - 1; i > 0; i-- {
+		if f := ConversationFiles[i]; f.is(ch) {
+			return f
+		}
+	}
+	return ConversationFiles[0]
+}
+
+// conversationPaths returns paths of ConversationFiles in dir.
+func conversationPaths(dir string) []string {
+	paths := make([]string, 0, len(ConversationFiles))
+	for _, f := range ConversationFiles {
+		paths = append(paths, filepath.Join(dir, f.Name))
+	}
+	return paths
+}
+
+// ReadConversations : dirに存在する各種類の会話のファイルを全て読み込む。
+// channels.json以外のファイルは存在しなくてもよい。
+func ReadConversations(dir string) ([]Channel, error) {
+	var all []Channel
+	for i, f := range ConversationFiles {
+		var channels []Channel
+		err := ReadFileAsJSON(filepath.Join(dir, f.Name), true, &channels)
+		if err != nil {
+			if i != 0 && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for i := range channels {
+			f.mark(&channels[i])
+		}
+		all = append(all, channels...)
+	}
+	return all, nil
+}
+
+// newConversationTable creates a ChannelTable of conversations which are
+// enabled by cfg.
+func newConversationTable(channels []Channel, ut *UserTable, cfg *Config) *ChannelTable {
+	channels = filterConversationTypes(channels, cfg)
+	nameDMs(channels, ut)
+	return newChannelTable(channels, cfg.Channels)
+}
+
+// filterConversationTypes returns conversations of types which are enabled
+// by cfg.
+func filterConversationTypes(channels []Channel, cfg *Config) []Channel {
+	newChannels := make([]Channel, 0, len(channels))
+	for i := range channels {
+		if !conversationFileOf(&channels[i]).Enabled(cfg) {
+			continue
+		}
+		newChannels = append(newChannels, channels[i])
+	}
+	return newChannels
+}
+
+// nameDMs names DMs which have no name, by names of their members like
+// "dm-alice--bob", as group DMs are named like "mpdm-alice--bob--carol-1".
+func nameDMs(channels []Channel, ut *UserTable) {
+	for i := range channels {
+		ch := &channels[i]
+		if ch.Name != "" || !ch.IsIM {
+			continue
+		}
+		members := ch.Members
+		if len(members) == 0 && ch.User != "" {
+			members = []string{ch.User}
+		}
+		names := make([]string, 0, len(members))
+		for _, id := range members {
+			if u, ok := ut.UserMap[id]; ok {
+				names = append(names, u.Name)
+			} else {
+				names = append(names, id)
+			}
+		}
+		if len(names) == 0 {
+			names = append(names, ch.ID)
+		}
+		ch.Name = "dm-" + strings.Join(names, "--")
+	}
 }
 
 // FilterChannel : whitelistに指定したチャンネル名に該当するチャンネルのみを返
@@ -75,6 +234,25 @@ type Channel struct {
 	Pins []ChannelPin `json:"pins"`
 }
 
+// DisplayName returns the name of the channel to show in pages: "#name" for
+// public channels, "🔒name" for private channels, and names of members for
+// group DMs and DMs.
+func (ch Channel) DisplayName() string {
+	switch {
+	case ch.IsMpIM:
+		name := strings.TrimPrefix(ch.Name, "mpdm-")
+		if i := strings.LastIndex(name, "-"); i > 0 && !strings.HasSuffix(name[:i], "-") {
+			name = name[:i]
+		}
+		return strings.ReplaceAll(name, "--", ", ")
+	case ch.IsIM:
+		return strings.ReplaceAll(strings.TrimPrefix(ch.Name, "dm-"), "--", ", ")
+	case ch.IsPrivate || ch.IsGroup:
+		return "🔒" + ch.Name
+	}
+	return "#" + ch.Name
+}
+
 // ChannelPin represents a pinned message for a channel.
 type ChannelPin struct {
 	ID      string `json:"id"`
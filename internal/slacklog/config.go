@@ -1,17 +1,81 @@
 package slacklog
 
+import (
+	"os"
+	"time"
+)
+
 // Config : ログ出力時の設定を保持する。
 type Config struct {
 	EditedSuffix  string   `json:"edited_suffix"`
 	Channels      []string `json:"channels"`
 	EmojiJSONPath string   `json:"emoji_json_path"`
+	// FeedEntries : 各Atomフィードのエントリの最大数。
+	FeedEntries int `json:"feed_entries,omitempty"`
+	// FeedTitle : Atomフィードのタイトルの接頭辞。既定値は
+	// "${WorkspaceDomain} log"。
+	FeedTitle string `json:"feed_title,omitempty"`
+	// Highlight : コードブロックと添付されたスニペットを、JavaScriptではなく
+	// 生成時にハイライトする。
+	Highlight bool `json:"highlight,omitempty"`
+	// WorkspaceDomain : "vim-jp.slack.com"のようなSlackワークスペースのドメイ
+	// ン。ワークスペース内のメッセージへのリンクはアーカイブへのリンクに書き換
+	// える。既定値はDefaultWorkspaceDomain。
+	WorkspaceDomain string `json:"workspace_domain,omitempty"`
+	// MemoryLimitMB : ログファイルから読み込んだメッセージを保持するメモリのお
+	// およその上限(MB)。既定値は512。
+	MemoryLimitMB int `json:"memory_limit_mb,omitempty"`
+	// PrivateChannels, GroupDMs, DMs : それぞれプライベートチャンネル
+	// (groups.json)、グループDM(mpims.json)、DM(dms.json)をアーカイブに含め
+	// る。アーカイブは公開されるため、既定では含めない。
+	PrivateChannels bool `json:"private_channels,omitempty"`
+	GroupDMs        bool `json:"group_dms,omitempty"`
+	DMs             bool `json:"dms,omitempty"`
+	// EditHistory : message_changedイベントから再現した、編集されたメッセージ
+	// の編集前の内容を表示する。
+	EditHistory bool `json:"edit_history,omitempty"`
+	// ChannelEvents : チャンネルのトピック、説明、名前の変更とアーカイブを、月
+	// 毎のページにも行として表示する。
+	ChannelEvents bool `json:"channel_events,omitempty"`
+	// Timezone : メッセージの日時を決めて表示するタイムゾーンの、"Asia/Tokyo"
+	// のようなIANA Time Zoneの名前。既定値はDefaultTimezone。
+	Timezone string `json:"timezone,omitempty"`
+	// Locale : 日時やラベルを表示するロケール。"ja"または"en"。既定値は
+	// DefaultLocale。
+	Locale string `json:"locale,omitempty"`
 }
 
 // ReadConfig : pathに指定したファイルからコンフィグを読み込む。
+// Timezone及びLocaleが誤っていればエラーを返す。
 func ReadConfig(path string) (*Config, error) {
 	var cfg Config
 	if err := ReadFileAsJSON(path, true, &cfg); err != nil {
 		return nil, err
 	}
+	if _, _, err := cfg.archiveTime(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// ReadConfigIfExists : ReadConfigと同様だが、pathにファイルが無ければゼロ値の
+// Config(公開チャンネルのみ、既定のタイムゾーン)を返す。
+func ReadConfigIfExists(path string) (*Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	return ReadConfig(path)
+}
+
+// archiveTime : TimezoneとLocaleからアーカイブのタイムゾーンとロケールを返す。
+func (cfg *Config) archiveTime() (*time.Location, *locale, error) {
+	loc, err := LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, err := loadLocale(cfg.Locale)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loc, l, nil
+}
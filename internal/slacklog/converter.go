@@ -4,8 +4,9 @@ import (
 	"html"
 	"net/url"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kyokomi/emoji"
 )
@@ -18,42 +19,36 @@ type TextConverter struct {
 	// key: user ID
 	// value: display name
 	users map[string]string
-	re    regexps
+	// key: channel ID
+	// value: channel name
+	channels map[string]string
+	// key: user group ID
+	// value: handle of user group
+	userGroups map[string]string
 	// baseURL is root path for public site, configured by `BASEURL` environment variable.
 	baseURL string
+	// highlight enables syntax highlighting of code blocks.
+	highlight bool
+	// workspaceDomain is the domain of the Slack workspace, to rewrite
+	// permalinks to messages.
+	workspaceDomain string
+	// loc and locale are the timezone and the locale of the archive, to show
+	// dates and to decide months of permalinks.
+	loc    *time.Location
+	locale *locale
 }
 
 // NewTextConverter : TextConverter を生成する
 func NewTextConverter(users, emojis map[string]string) *TextConverter {
-	re := regexps{}
-	// TODO tokenize/parse message.Text
-	re.linkWithTitle = regexp.MustCompile(`&lt;(https?://[^>]+?)\|(.+?)&gt;`)
-	re.link = regexp.MustCompile(`&lt;(https?://[^>]+?)&gt;`)
-	// go regexp does not support back reference
-	re.code = regexp.MustCompile("`{3}|｀{3}")
-	re.codeShort = regexp.MustCompile("[`｀]([^`]+?)[`｀]")
-	re.del = regexp.MustCompile(`~([^~]+?)~`)
-	re.mention = regexp.MustCompile(`&lt;@(\w+?)&gt;`)
-	re.channel = regexp.MustCompile(`&lt;#([^|]+?)\|([^&]+?)&gt;`)
-	re.emoji = regexp.MustCompile(`:[^\s!"#$%&()=^/?\\\[\]<>,.;@{}~:]+:`)
-	re.newLine = regexp.MustCompile(`\n`)
-
 	return &TextConverter{
 		emojis:  emojis,
 		users:   users,
-		re:      re,
 		baseURL: os.Getenv("BASEURL"),
+		loc:     defaultTimezone(),
+		locale:  locales[DefaultLocale],
 	}
 }
 
-type regexps struct {
-	linkWithTitle, link,
-	code, codeShort,
-	del,
-	mention, channel, emoji,
-	newLine *regexp.Regexp
-}
-
 func (c *TextConverter) escapeSpecialChars(text string) string {
 	text = html.EscapeString(html.UnescapeString(text))
 	text = strings.Replace(text, "{{", "&#123;&#123;", -1)
@@ -62,10 +57,18 @@ func (c *TextConverter) escapeSpecialChars(text string) string {
 
 func (c *TextConverter) escape(text string) string {
 	text = html.EscapeString(html.UnescapeString(text))
-	text = c.re.newLine.ReplaceAllString(text, " ")
+	text = strings.Replace(text, "\n", " ", -1)
 	return text
 }
 
+// escapeText escapes a text which is already unescaped, to be embedded into
+// HTML.
+func (c *TextConverter) escapeText(text string) string {
+	text = html.EscapeString(text)
+	text = strings.Replace(text, "{{", "&#123;&#123;", -1)
+	return strings.Replace(text, "{%", "&#123;&#37;", -1)
+}
+
 func (c *TextConverter) bindEmoji(emojiExp string) string {
 	name := emojiExp[1 : len(emojiExp)-1]
 	extension, ok := c.emojis[name]
@@ -87,39 +90,476 @@ func (c *TextConverter) bindEmoji(emojiExp string) string {
 	return "<img class='slacklog-emoji' title='" + emojiExp + "' alt='" + emojiExp + "' src='" + src + "'>"
 }
 
-func (c *TextConverter) bindUser(userExp string) string {
-	m := c.re.mention.FindStringSubmatch(userExp)
-	if name := c.users[m[1]]; name != "" {
-		return "@" + name
+// preformattedHTML converts a code block to HTML, with syntax highlighting if
+// it is enabled and the language is detected.
+func (c *TextConverter) preformattedHTML(code string) string {
+	if c.highlight {
+		if l := detectLexer(code); l != nil {
+			return "<pre class='slacklog-highlight' data-lang='" + l.name + "'>" + l.highlight(code, c.escapeText) + "</pre>"
+		}
+	}
+	return "<pre>" + c.escapeText(code) + "</pre>"
+}
+
+// newStoreTextConverter creates a TextConverter with users, emojis, channels
+// and user groups in s.
+func newStoreTextConverter(s *LogStore) *TextConverter {
+	c := NewTextConverter(s.GetDisplayNameMap(), s.GetEmojiMap())
+	c.SetChannels(s.GetChannels())
+	c.SetUserGroups(s.GetUserGroups())
+	c.SetWorkspaceDomain(s.WorkspaceDomain())
+	c.loc = s.loc
+	c.locale = s.locale
+	return c
+}
+
+// SetWorkspaceDomain sets the domain of the Slack workspace. Permalinks to
+// messages in channels which are set by SetChannels are rewritten to links
+// to the archive.
+func (c *TextConverter) SetWorkspaceDomain(domain string) {
+	c.workspaceDomain = domain
+}
+
+// archiveURL returns a URL of the archive for a permalink to a message. It
+// returns false when rawURL is not a permalink, or the channel is not
+// archived.
+func (c *TextConverter) archiveURL(rawURL string) (string, bool) {
+	if c.workspaceDomain == "" {
+		return "", false
+	}
+	p, ok := ParsePermalink(rawURL, c.workspaceDomain)
+	if !ok {
+		return "", false
+	}
+	if _, ok := c.channels[p.ChannelID]; !ok {
+		return "", false
+	}
+	return c.baseURL + p.ArchivePath(c.loc), true
+}
+
+// linkURL returns a URL to link, which rewrites a permalink to the archive.
+func (c *TextConverter) linkURL(rawURL string) string {
+	if u, ok := c.archiveURL(rawURL); ok {
+		return u
+	}
+	return rawURL
+}
+
+// SetHighlight enables or disables syntax highlighting of code blocks. The
+// language of each code block is guessed from its contents.
+func (c *TextConverter) SetHighlight(enabled bool) {
+	c.highlight = enabled
+}
+
+// SetChannels sets names of channels, to show channels which are referred by
+// ID only.
+func (c *TextConverter) SetChannels(channels []Channel) {
+	c.channels = make(map[string]string, len(channels))
+	for _, ch := range channels {
+		c.channels[ch.ID] = ch.Name
+	}
+}
+
+// SetUserGroups sets user groups, to show mentions to them by their handles.
+func (c *TextConverter) SetUserGroups(groups []UserGroup) {
+	c.userGroups = make(map[string]string, len(groups))
+	for _, g := range groups {
+		c.userGroups[g.ID] = g.Handle
+	}
+}
+
+// mentionLabel returns a label for a mention node: a user who is not in
+// users, or a user group. It returns false when there is no label to show.
+func (c *TextConverter) mentionLabel(n *mrkdwnNode) (string, bool) {
+	label := n.Text
+	if n.Kind == mrkdwnUserGroup {
+		if handle := c.userGroups[n.URL]; handle != "" {
+			label = handle
+		}
+	}
+	if label == "" {
+		return "", false
+	}
+	return "@" + strings.TrimPrefix(label, "@"), true
+}
+
+// dateText returns a formatted text for mrkdwnDate.
+func (c *TextConverter) dateText(n *mrkdwnNode) string {
+	if text, ok := c.locale.formatSlackDate(n.URL, n.Text, c.loc); ok {
+		return text
 	}
-	return userExp
+	return n.Raw
 }
 
-func (c *TextConverter) bindChannel(channelExp string) string {
-	matchResult := c.re.channel.FindStringSubmatch(channelExp)
-	channelID := matchResult[1]
-	channelName := matchResult[2]
-	return "<a href='" + c.baseURL + "/" + channelID + "/'>#" + channelName + "</a>"
+// channelName returns the name of the channel for the node. It returns false
+// for an unknown channel.
+func (c *TextConverter) channelName(n *mrkdwnNode) (string, bool) {
+	if n.Text != "" {
+		return n.Text, true
+	}
+	name := c.channels[n.URL]
+	return name, name != ""
 }
 
-// ToHTML : markdown形式のtextをHTMLに変換する
+// userName returns the display name of the user. It returns false for an
+// unknown user.
+func (c *TextConverter) userName(userID string) (string, bool) {
+	name := c.users[userID]
+	return name, name != ""
+}
+
+// ToHTML : markdown形式(Slack mrkdwn)のtextをHTMLに変換する
 func (c *TextConverter) ToHTML(text string) string {
-	text = c.escapeSpecialChars(text)
-	text = c.re.newLine.ReplaceAllString(text, "<br>")
-	chunks := c.re.code.Split(text, -1)
-	for i, s := range chunks {
-		if i%2 == 0 {
-			s = c.re.linkWithTitle.ReplaceAllString(s, "<a href='${1}'>${2}</a>")
-			s = c.re.link.ReplaceAllString(s, "<a href='${1}'>${1}</a>")
-			s = c.re.codeShort.ReplaceAllString(s, "<code>${1}</code>")
-			s = c.re.del.ReplaceAllString(s, "<del>${1}</del>")
-			s = c.re.emoji.ReplaceAllStringFunc(s, c.bindEmoji)
-			s = c.re.mention.ReplaceAllStringFunc(s, c.bindUser)
-			s = c.re.channel.ReplaceAllStringFunc(s, c.bindChannel)
+	b := &strings.Builder{}
+	c.writeHTML(b, parseMrkdwn(text))
+	return b.String()
+}
+
+func (c *TextConverter) writeHTML(b *strings.Builder, nodes []*mrkdwnNode) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case mrkdwnText:
+			b.WriteString(c.escapeText(n.Text))
+		case mrkdwnLineBreak:
+			b.WriteString("<br>")
+		case mrkdwnBold:
+			c.writeHTMLElement(b, "b", "", n.Children)
+		case mrkdwnItalic:
+			c.writeHTMLElement(b, "i", "", n.Children)
+		case mrkdwnStrike:
+			c.writeHTMLElement(b, "del", "", n.Children)
+		case mrkdwnCode:
+			b.WriteString("<code>" + c.escapeText(n.Text) + "</code>")
+		case mrkdwnPreformatted:
+			b.WriteString(c.preformattedHTML(n.Text))
+		case mrkdwnQuote:
+			c.writeHTMLElement(b, "blockquote", "slacklog-quote", n.Children)
+		case mrkdwnList:
+			tag := "ul"
+			if n.Ordered {
+				tag = "ol"
+			}
+			c.writeHTMLElement(b, tag, "slacklog-list", n.Children)
+		case mrkdwnListItem:
+			c.writeHTMLElement(b, "li", "", n.Children)
+		case mrkdwnLink:
+			u := c.linkURL(n.URL)
+			b.WriteString("<a href='" + html.EscapeString(u) + "'>")
+			if len(n.Children) > 0 {
+				c.writeHTML(b, n.Children)
+			} else {
+				b.WriteString(c.escapeText(u))
+			}
+			b.WriteString("</a>")
+		case mrkdwnUser:
+			if name, ok := c.userName(n.URL); ok {
+				b.WriteString("<a href='" + c.baseURL + UserPagePath(n.URL) + "'>@" + c.escapeText(name) + "</a>")
+			} else if label, ok := c.mentionLabel(n); ok {
+				b.WriteString("<span class='slacklog-mention'>" + c.escapeText(label) + "</span>")
+			} else {
+				b.WriteString(c.escapeText(n.Raw))
+			}
+		case mrkdwnUserGroup:
+			if label, ok := c.mentionLabel(n); ok {
+				b.WriteString("<span class='slacklog-mention'>" + c.escapeText(label) + "</span>")
+			} else {
+				b.WriteString(c.escapeText(n.Raw))
+			}
+		case mrkdwnBroadcast:
+			b.WriteString("<span class='slacklog-mention'>@" + c.escapeText(n.Text) + "</span>")
+		case mrkdwnDate:
+			text := c.escapeText(c.dateText(n))
+			if n.Link != "" {
+				text = "<a href='" + html.EscapeString(n.Link) + "'>" + text + "</a>"
+			}
+			b.WriteString("<span class='slacklog-date'>" + text + "</span>")
+		case mrkdwnChannel:
+			if name, ok := c.channelName(n); ok {
+				b.WriteString("<a href='" + c.baseURL + "/" + html.EscapeString(n.URL) + "/'>#" + c.escapeText(name) + "</a>")
+			} else {
+				b.WriteString(c.escapeText(n.Raw))
+			}
+		case mrkdwnEmoji:
+			b.WriteString(c.bindEmoji(n.Text))
+		}
+	}
+}
+
+func (c *TextConverter) writeHTMLElement(b *strings.Builder, tag, class string, children []*mrkdwnNode) {
+	if class != "" {
+		b.WriteString("<" + tag + " class='" + class + "'>")
+	} else {
+		b.WriteString("<" + tag + ">")
+	}
+	c.writeHTML(b, children)
+	b.WriteString("</" + tag + ">")
+}
+
+// ToPlainText : markdown形式のtextを、装飾を取り除いたプレーンテキストに変換す
+// る。
+// リンクは"タイトル (URL)"、メンションは"@表示名"、チャンネルは"#チャンネル名"
+// となる。
+func (c *TextConverter) ToPlainText(text string) string {
+	return c.plainTextBlocks(parseMrkdwn(text))
+}
+
+func (c *TextConverter) plainTextBlocks(nodes []*mrkdwnNode) string {
+	var parts []string
+	b := &strings.Builder{}
+	flush := func() {
+		if b.Len() > 0 {
+			parts = append(parts, b.String())
+			b.Reset()
+		}
+	}
+	for _, n := range nodes {
+		switch n.Kind {
+		case mrkdwnPreformatted:
+			flush()
+			parts = append(parts, n.Text)
+		case mrkdwnQuote:
+			flush()
+			parts = append(parts, prefixLines(c.plainTextBlocks(n.Children), "> ", ">"))
+		case mrkdwnList:
+			flush()
+			parts = append(parts, c.plainTextList(n, ""))
+		default:
+			c.writePlainText(b, n)
+		}
+	}
+	flush()
+	return strings.Join(parts, "\n")
+}
+
+func (c *TextConverter) plainTextList(list *mrkdwnNode, indent string) string {
+	var lines []string
+	for i, item := range list.Children {
+		marker := "• "
+		if list.Ordered {
+			marker = strconv.Itoa(i+1) + ". "
+		}
+		b := &strings.Builder{}
+		var nested []string
+		for _, n := range item.Children {
+			if n.Kind == mrkdwnList {
+				nested = append(nested, c.plainTextList(n, indent+"  "))
+				continue
+			}
+			c.writePlainText(b, n)
+		}
+		lines = append(lines, indent+marker+b.String())
+		lines = append(lines, nested...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *TextConverter) writePlainText(b *strings.Builder, n *mrkdwnNode) {
+	switch n.Kind {
+	case mrkdwnText, mrkdwnCode, mrkdwnEmoji:
+		b.WriteString(n.Text)
+	case mrkdwnLineBreak:
+		b.WriteString("\n")
+	case mrkdwnBold, mrkdwnItalic, mrkdwnStrike:
+		for _, child := range n.Children {
+			c.writePlainText(b, child)
+		}
+	case mrkdwnLink:
+		u := c.linkURL(n.URL)
+		if len(n.Children) == 0 {
+			b.WriteString(u)
+			break
+		}
+		for _, child := range n.Children {
+			c.writePlainText(b, child)
+		}
+		b.WriteString(" (" + u + ")")
+	case mrkdwnUser, mrkdwnUserGroup:
+		if name, ok := c.userName(n.URL); ok && n.Kind == mrkdwnUser {
+			b.WriteString("@" + name)
+		} else if label, ok := c.mentionLabel(n); ok {
+			b.WriteString(label)
+		} else {
+			b.WriteString(n.Raw)
+		}
+	case mrkdwnBroadcast:
+		b.WriteString("@" + n.Text)
+	case mrkdwnDate:
+		b.WriteString(c.dateText(n))
+	case mrkdwnChannel:
+		if name, ok := c.channelName(n); ok {
+			b.WriteString("#" + name)
 		} else {
-			s = "<pre>" + s + "</pre>"
+			b.WriteString(n.Raw)
+		}
+	default:
+		b.WriteString(c.plainTextBlocks([]*mrkdwnNode{n}))
+	}
+}
+
+// prefixLines adds prefix to each line of s. blank is used for empty lines.
+func prefixLines(s, prefix, blank string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blank
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ToMarkdown : markdown形式(Slack mrkdwn)のtextをGitHub Flavored Markdownに変
+// 換する。
+// HTMLとして解釈されないよう"<", ">", "&"は文字参照とする。
+func (c *TextConverter) ToMarkdown(text string) string {
+	return c.markdownBlocks(parseMrkdwn(text))
+}
+
+func (c *TextConverter) markdownBlocks(nodes []*mrkdwnNode) string {
+	var parts []string
+	b := &strings.Builder{}
+	flush := func() {
+		if b.Len() > 0 {
+			parts = append(parts, b.String())
+			b.Reset()
+		}
+	}
+	for _, n := range nodes {
+		switch n.Kind {
+		case mrkdwnPreformatted:
+			flush()
+			parts = append(parts, "```\n"+n.Text+"\n```")
+		case mrkdwnQuote:
+			flush()
+			parts = append(parts, prefixLines(c.markdownBlocks(n.Children), "> ", ">"))
+		case mrkdwnList:
+			flush()
+			parts = append(parts, c.markdownList(n, ""))
+		default:
+			c.writeMarkdown(b, n)
+		}
+	}
+	flush()
+	// ブロックの後に続く行が引用やリストの一部とならないよう空行で区切る
+	return strings.Join(parts, "\n\n")
+}
+
+func (c *TextConverter) markdownList(list *mrkdwnNode, indent string) string {
+	var lines []string
+	for i, item := range list.Children {
+		marker := "- "
+		if list.Ordered {
+			marker = strconv.Itoa(i+1) + ". "
+		}
+		b := &strings.Builder{}
+		var nested []string
+		for _, n := range item.Children {
+			if n.Kind == mrkdwnList {
+				nested = append(nested, c.markdownList(n, indent+strings.Repeat(" ", len(marker))))
+				continue
+			}
+			c.writeMarkdown(b, n)
+		}
+		lines = append(lines, indent+marker+b.String())
+		lines = append(lines, nested...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;",
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "~", `\~`, "[", `\[`, "]", `\]`,
+)
+
+// markdownURLEscaper escapes characters which end the destination of a link.
+var markdownURLEscaper = strings.NewReplacer("(", "%28", ")", "%29", " ", "%20")
+
+func (c *TextConverter) writeMarkdown(b *strings.Builder, n *mrkdwnNode) {
+	switch n.Kind {
+	case mrkdwnText:
+		b.WriteString(markdownEscaper.Replace(n.Text))
+	case mrkdwnLineBreak:
+		// GitHub Flavored Markdownのhard line breakにする
+		b.WriteString("\\\n")
+	case mrkdwnBold:
+		c.writeMarkdownStyle(b, "**", n.Children)
+	case mrkdwnItalic:
+		c.writeMarkdownStyle(b, "_", n.Children)
+	case mrkdwnStrike:
+		c.writeMarkdownStyle(b, "~~", n.Children)
+	case mrkdwnCode:
+		if strings.Contains(n.Text, "`") {
+			b.WriteString("`` " + n.Text + " ``")
+		} else {
+			b.WriteString("`" + n.Text + "`")
+		}
+	case mrkdwnLink:
+		u := c.linkURL(n.URL)
+		if len(n.Children) == 0 {
+			b.WriteString("<" + u + ">")
+			break
+		}
+		c.writeMarkdownStyle(b, "[", n.Children)
+		b.WriteString("(" + markdownURLEscaper.Replace(u) + ")")
+	case mrkdwnUser, mrkdwnUserGroup:
+		// GitHubのメンションとならないよう、リンクでないものはコードとする
+		if name, ok := c.userName(n.URL); ok && n.Kind == mrkdwnUser {
+			b.WriteString("[@" + markdownEscaper.Replace(name) + "](" + c.baseURL + UserPagePath(n.URL) + ")")
+		} else if label, ok := c.mentionLabel(n); ok {
+			b.WriteString("`" + label + "`")
+		} else {
+			b.WriteString(markdownEscaper.Replace(n.Raw))
+		}
+	case mrkdwnBroadcast:
+		b.WriteString("`@" + n.Text + "`")
+	case mrkdwnDate:
+		text := markdownEscaper.Replace(c.dateText(n))
+		if n.Link != "" {
+			text = "[" + text + "](" + markdownURLEscaper.Replace(n.Link) + ")"
+		}
+		b.WriteString(text)
+	case mrkdwnChannel:
+		if name, ok := c.channelName(n); ok {
+			b.WriteString("[#" + markdownEscaper.Replace(name) + "](" + c.baseURL + "/" + n.URL + "/)")
+		} else {
+			b.WriteString(markdownEscaper.Replace(n.Raw))
+		}
+	case mrkdwnEmoji:
+		b.WriteString(c.bindEmojiMarkdown(n.Text))
+	default:
+		b.WriteString(c.markdownBlocks([]*mrkdwnNode{n}))
+	}
+}
+
+func (c *TextConverter) writeMarkdownStyle(b *strings.Builder, marker string, children []*mrkdwnNode) {
+	b.WriteString(marker)
+	for _, child := range children {
+		c.writeMarkdown(b, child)
+	}
+	if marker == "[" {
+		b.WriteString("]")
+	} else {
+		b.WriteString(marker)
+	}
+}
+
+func (c *TextConverter) bindEmojiMarkdown(emojiExp string) string {
+	name := emojiExp[1 : len(emojiExp)-1]
+	extension, ok := c.emojis[name]
+	if !ok {
+		char, ok := emoji.CodeMap()[emojiExp]
+		if ok {
+			return char
+		}
+		return markdownEscaper.Replace(emojiExp)
+	}
+	for 7 <= len(extension) && extension[:6] == "alias:" {
+		name = extension[6:]
+		extension, ok = c.emojis[name]
+		if !ok {
+			return markdownEscaper.Replace(emojiExp)
 		}
-		chunks[i] = s
 	}
-	return strings.Join(chunks, "")
+	return "![" + emojiExp + "](" + c.baseURL + "/emojis/" + url.PathEscape(name) + extension + ")"
 }
@@ -0,0 +1,216 @@
+package slacklog
+
+import (
+	"testing"
+)
+
+func newTestTextConverter() *TextConverter {
+	c := NewTextConverter(
+		map[string]string{"U001": "alice", "U002": "<bob>"},
+		map[string]string{"party": ".gif", "parrot": "alias:party"},
+	)
+	c.baseURL = "https://example.org"
+	c.SetUserGroups([]UserGroup{{ID: "S001", Handle: "vim-devs"}})
+	return c
+}
+
+func TestTextConverter_ToHTML(t *testing.T) {
+	c := newTestTextConverter()
+
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		// plain texts
+		{"empty", "", ""},
+		{"plain", "hello world", "hello world"},
+		{"japanese", "こんにちは世界", "こんにちは世界"},
+		{"entities", "a &lt;b&gt; &amp; c", "a &lt;b&gt; &amp; c"},
+		{"raw html", "<b>bold</b>", "&lt;b&gt;bold&lt;/b&gt;"},
+		{"quotes", `it's "quoted"`, "it&#39;s &#34;quoted&#34;"},
+		{"template braces", "{{ .x }} {% y %}", "&#123;&#123; .x }} &#123;&#37; y %}"},
+		{"newline", "a\nb", "a<br>b"},
+		{"blank line", "a\n\nb", "a<br><br>b"},
+
+		// bold
+		{"bold", "*bold*", "<b>bold</b>"},
+		{"bold in text", "a *bold* b", "a <b>bold</b> b"},
+		{"bold with spaces", "*bold text*", "<b>bold text</b>"},
+		{"bold punctuation", "(*bold*)", "(<b>bold</b>)"},
+		{"bold before punctuation", "*bold*.", "<b>bold</b>."},
+		{"not bold: space after opener", "* not bold*", "* not bold*"},
+		{"not bold: space before closer", "*not bold *", "*not bold *"},
+		{"not bold: in word", "a*b*c", "a*b*c"},
+		{"not bold: multiplication", "2 * 3 * 4", "2 * 3 * 4"},
+		{"not bold: unclosed", "*unclosed", "*unclosed"},
+		{"not bold: empty", "**", "**"},
+		{"not bold: across lines", "*a\nb*", "*a<br>b*"},
+		{"not bold: next to japanese", "これは*太字*です", "これは*太字*です"},
+		{"bold japanese with spaces", "これは *太字* です", "これは <b>太字</b> です"},
+
+		// italic
+		{"italic", "_italic_", "<i>italic</i>"},
+		{"not italic: snake_case", "snake_case_name", "snake_case_name"},
+		{"not italic: variable", "_private_var", "_private_var"},
+		{"italic with snake_case inside", "_a snake_case b_", "<i>a snake_case b</i>"},
+
+		// strike
+		{"strike", "~strike~", "<del>strike</del>"},
+		{"not strike: path", "~/.vimrc と ~/.vim", "~/.vimrc と ~/.vim"},
+		{"not strike: approx", "~10 ~20", "~10 ~20"},
+
+		// nested styles
+		{"bold italic", "*_both_*", "<b><i>both</i></b>"},
+		{"italic in bold", "*bold _italic_ bold*", "<b>bold <i>italic</i> bold</b>"},
+		{"strike in bold", "*a ~b~ c*", "<b>a <del>b</del> c</b>"},
+		{"bold with link", "*see <https://vim-jp.org/|vim-jp>*", "<b>see <a href='https://vim-jp.org/'>vim-jp</a></b>"},
+		{"bold with code", "*use `x*y`*", "<b>use <code>x*y</code></b>"},
+		{"two bolds", "*a* and *b*", "<b>a</b> and <b>b</b>"},
+
+		// inline code
+		{"code", "`code`", "<code>code</code>"},
+		{"code keeps markers", "`*a* _b_ ~c~`", "<code>*a* _b_ ~c~</code>"},
+		{"code keeps emoji", "`:smile:`", "<code>:smile:</code>"},
+		{"code keeps links", "`<https://vim-jp.org/>`", "<code>&lt;https://vim-jp.org/&gt;</code>"},
+		{"code entities", "`a &lt; b &amp;&amp; c`", "<code>a &lt; b &amp;&amp; c</code>"},
+		{"code in word", "foo`bar`baz", "foo<code>bar</code>baz"},
+		{"full width code", "｀code｀", "<code>code</code>"},
+		{"unclosed code", "`unclosed", "`unclosed"},
+		{"empty code", "``", "``"},
+		{"two codes", "`a` and `b`", "<code>a</code> and <code>b</code>"},
+
+		// code blocks
+		{"code block", "```code```", "<pre>code</pre>"},
+		{"code block lines", "```\nline1\nline2\n```", "<pre>line1\nline2</pre>"},
+		{"code block keeps markers", "```*a* <@U001> :party:```", "<pre>*a* &lt;@U001&gt; :party:</pre>"},
+		{"code block entities", "```if a &lt; b {}```", "<pre>if a &lt; b {}</pre>"},
+		{"code block between texts", "before\n```\ncode\n```\nafter", "before<pre>code</pre>after"},
+		{"code block in line", "see ```code``` here", "see <pre>code</pre> here"},
+		{"two code blocks", "```a```\n```b```", "<pre>a</pre><pre>b</pre>"},
+		{"full width code block", "｀｀｀code｀｀｀", "<pre>code</pre>"},
+		{"unclosed code block", "```code", "```code"},
+		{"code block keeps blank lines", "```a\n\n\nb```", "<pre>a\n\n\nb</pre>"},
+
+		// links
+		{"link", "<https://vim-jp.org/>", "<a href='https://vim-jp.org/'>https://vim-jp.org/</a>"},
+		{"link with title", "<https://vim-jp.org/|vim-jp>", "<a href='https://vim-jp.org/'>vim-jp</a>"},
+		{"http link", "<http://example.com/>", "<a href='http://example.com/'>http://example.com/</a>"},
+		{"link with query", "<https://example.com/?a=1&amp;b=2>", "<a href='https://example.com/?a=1&amp;b=2'>https://example.com/?a=1&amp;b=2</a>"},
+		{"link with quote", "<https://example.com/'x>", "<a href='https://example.com/&#39;x'>https://example.com/&#39;x</a>"},
+		{"link title with entities", "<https://example.com/|a &amp; b>", "<a href='https://example.com/'>a &amp; b</a>"},
+		{"link title keeps markers", "<https://example.com/|*a*>", "<a href='https://example.com/'>*a*</a>"},
+		{"link in text", "see <https://vim-jp.org/> now", "see <a href='https://vim-jp.org/'>https://vim-jp.org/</a> now"},
+		{"link with underscore", "_<https://a.com/x_y>_", "<i><a href='https://a.com/x_y'>https://a.com/x_y</a></i>"},
+		{"mailto", "<mailto:a@example.com|a@example.com>", "<a href='mailto:a@example.com'>a@example.com</a>"},
+		{"not link: javascript", "<javascript:alert(1)>", "&lt;javascript:alert(1)&gt;"},
+		{"not link: unclosed", "<https://vim-jp.org/", "&lt;https://vim-jp.org/"},
+		{"escaped angle is not link", "&lt;https://vim-jp.org/&gt;", "&lt;https://vim-jp.org/&gt;"},
+
+		// mentions
+		{"mention", "<@U001>", "<a href='https://example.org/users/U001/'>@alice</a>"},
+		{"mention escapes name", "<@U002>", "<a href='https://example.org/users/U002/'>@&lt;bob&gt;</a>"},
+		{"mention unknown", "<@U999>", "&lt;@U999&gt;"},
+		{"mention in text", "hi <@U001>!", "hi <a href='https://example.org/users/U001/'>@alice</a>!"},
+		{"mention in bold", "*<@U001>*", "<b><a href='https://example.org/users/U001/'>@alice</a></b>"},
+		{"mention unknown with label", "<@U999|carol>", "<span class='slacklog-mention'>@carol</span>"},
+
+		// special mentions
+		{"here", "<!here>", "<span class='slacklog-mention'>@here</span>"},
+		{"channel mention", "<!channel|channel>", "<span class='slacklog-mention'>@channel</span>"},
+		{"everyone", "hi <!everyone>", "hi <span class='slacklog-mention'>@everyone</span>"},
+		{"user group", "<!subteam^S001>", "<span class='slacklog-mention'>@vim-devs</span>"},
+		{"user group with label", "<!subteam^S001|@old-name>", "<span class='slacklog-mention'>@vim-devs</span>"},
+		{"unknown user group with label", "<!subteam^S999|@team>", "<span class='slacklog-mention'>@team</span>"},
+		{"unknown user group", "<!subteam^S999>", "&lt;!subteam^S999&gt;"},
+		{"unknown command with label", "<!foo|bar>", "bar"},
+		{"unknown command", "<!foo>", "&lt;!foo&gt;"},
+
+		// dates
+		{"date", "<!date^1392734382^{date_num} {time_secs}|Feb 18>", "<span class='slacklog-date'>2014-02-18 23:39:42</span>"},
+		{"date long", "<!date^1392734382^{date_long} at {time}|Feb 18>", "<span class='slacklog-date'>2014年2月18日(火) at 23:39</span>"},
+		{"date with link", "<!date^1392734382^{date_short}^https://example.com/|Feb 18>", "<span class='slacklog-date'><a href='https://example.com/'>2014/02/18</a></span>"},
+		{"date unknown token", "<!date^1392734382^{unknown}|Feb 18>", "<span class='slacklog-date'>{unknown}</span>"},
+		{"date invalid", "<!date^abc^{date}|Feb 18>", "<span class='slacklog-date'>Feb 18</span>"},
+		{"date with javascript link", "<!date^1392734382^{date_short}^javascript:alert(1)|Feb 18>", "<span class='slacklog-date'>2014/02/18</span>"},
+
+		// channels
+		{"channel", "<#C001|general>", "<a href='https://example.org/C001/'>#general</a>"},
+		{"channel without name", "<#C001>", "&lt;#C001&gt;"},
+
+		// emojis
+		{"custom emoji", ":party:", "<img class='slacklog-emoji' title=':party:' alt=':party:' src='https://example.org/emojis/party.gif'>"},
+		{"alias emoji", ":parrot:", "<img class='slacklog-emoji' title=':parrot:' alt=':parrot:' src='https://example.org/emojis/party.gif'>"},
+		{"unicode emoji", ":smile:", "😄"},
+		{"unknown emoji", ":unknown:", ":unknown:"},
+		{"emoji with underscore", ":white_check_mark:", "✅"},
+		{"emoji in italic", "_:smile: yes_", "<i>😄 yes</i>"},
+		{"time is not emoji", "12:30:45", "12:30:45"},
+		{"emoji next to text", "ok:smile:", "ok😄"},
+
+		// quotes
+		{"quote", "&gt; quoted", "<blockquote class='slacklog-quote'>quoted</blockquote>"},
+		{"quote unescaped", "> quoted", "<blockquote class='slacklog-quote'>quoted</blockquote>"},
+		{"quote lines", "&gt; a\n&gt; b", "<blockquote class='slacklog-quote'>a<br>b</blockquote>"},
+		{"quote then text", "&gt; a\nb", "<blockquote class='slacklog-quote'>a</blockquote>b"},
+		{"text then quote", "a\n&gt; b", "a<blockquote class='slacklog-quote'>b</blockquote>"},
+		{"quote with styles", "&gt; *a* `b`", "<blockquote class='slacklog-quote'><b>a</b> <code>b</code></blockquote>"},
+		{"quote without space", "&gt;a", "<blockquote class='slacklog-quote'>a</blockquote>"},
+		{"multi line quote", "&gt;&gt;&gt; a\nb\nc", "<blockquote class='slacklog-quote'>a<br>b<br>c</blockquote>"},
+		{"quote with list", "&gt; • a\n&gt; • b", "<blockquote class='slacklog-quote'><ul class='slacklog-list'><li>a</li><li>b</li></ul></blockquote>"},
+		{"nested quote", "&gt; &gt; a", "<blockquote class='slacklog-quote'><blockquote class='slacklog-quote'>a</blockquote></blockquote>"},
+		{"greater than in text", "a &gt; b", "a &gt; b"},
+
+		// lists
+		{"bullet list", "• a\n• b", "<ul class='slacklog-list'><li>a</li><li>b</li></ul>"},
+		{"hyphen list", "- a\n- b", "<ul class='slacklog-list'><li>a</li><li>b</li></ul>"},
+		{"ordered list", "1. a\n2. b", "<ol class='slacklog-list'><li>a</li><li>b</li></ol>"},
+		{"nested list", "• a\n    ◦ b\n    ◦ c\n• d", "<ul class='slacklog-list'><li>a<ul class='slacklog-list'><li>b</li><li>c</li></ul></li><li>d</li></ul>"},
+		{"deeply nested list", "• a\n    ◦ b\n        ▪ c\n• d", "<ul class='slacklog-list'><li>a<ul class='slacklog-list'><li>b<ul class='slacklog-list'><li>c</li></ul></li></ul></li><li>d</li></ul>"},
+		{"ordered in bullet", "• a\n    1. b", "<ul class='slacklog-list'><li>a<ol class='slacklog-list'><li>b</li></ol></li></ul>"},
+		{"list with styles", "• *a* <@U001>", "<ul class='slacklog-list'><li><b>a</b> <a href='https://example.org/users/U001/'>@alice</a></li></ul>"},
+		{"text around list", "items:\n• a\n• b\nend", "items:<ul class='slacklog-list'><li>a</li><li>b</li></ul>end"},
+		{"bullet then ordered", "• a\n1. b", "<ul class='slacklog-list'><li>a</li></ul><ol class='slacklog-list'><li>b</li></ol>"},
+		{"not list: no space", "-a", "-a"},
+		{"not list: negative number", "-1 point", "-1 point"},
+
+		// mixed
+		{
+			"message",
+			"hello <@U001> see <https://example.com|example> and `code` ~del~ :smile: :party:",
+			"hello <a href='https://example.org/users/U001/'>@alice</a> see <a href='https://example.com'>example</a> and <code>code</code> <del>del</del> 😄 <img class='slacklog-emoji' title=':party:' alt=':party:' src='https://example.org/emojis/party.gif'>",
+		},
+		{
+			"code block after quote",
+			"&gt; question\n```answer```",
+			"<blockquote class='slacklog-quote'>question</blockquote><pre>answer</pre>",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := c.ToHTML(tc.in); got != tc.want {
+				t.Errorf("ToHTML(%q) mismatch:\nwant: %s\n got: %s", tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTextConverter_ToPlainText(t *testing.T) {
+	c := newTestTextConverter()
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"a &lt;b&gt; &amp; c", "a <b> & c"},
+		{"*bold* _italic_ ~strike~ `code`", "bold italic strike code"},
+		{"<https://vim-jp.org/|vim-jp> <https://example.com/>", "vim-jp (https://vim-jp.org/) https://example.com/"},
+		{"<@U001> <@U999> <#C001|general>", "@alice <@U999> #general"},
+		{"<!here> <!subteam^S001> <!subteam^S999|@team>", "@here @vim-devs @team"},
+		{"<!date^1392734382^{date}|Feb 18>", "2014年2月18日"},
+		{"&gt; a\n&gt; b\nc", "> a\n> b\nc"},
+		{"• a\n    ◦ b\n1. c", "• a\n  • b\n1. c"},
+		{"x\n```\ny\n```", "x\ny"},
+	} {
+		if got := c.ToPlainText(tc.in); got != tc.want {
+			t.Errorf("ToPlainText(%q) mismatch:\nwant: %q\n got: %q", tc.in, tc.want, got)
+		}
+	}
+}
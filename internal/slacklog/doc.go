@@ -7,10 +7,16 @@ LogStoreはログデータの取得方法を規定し、必要に応じて各種
 
 ChannelTable/MessageTable/UserTable/EmojiTableはSlackからエクスポートされたJSON
 形式のログファイルを読み込み、LogStoreが処理しやすい形でデータを保持する。
+MessageTableはチャンネル・月毎に必要になった時に読み込み、メモリの上限を超えな
+いよう使われていないものから破棄する。
 
 TextConverterはログが保持しているテキストのエスケープやHTMLへの変換を行なう。
 
 HTMLGeneratorはLogStoreから取得し、TextConverterで変換したデータを、
 text/templateパッケージを用いてHTMLとして出力する。
+
+GeneratorはLogStoreから取得したデータを、出力形式毎のRendererを用いて書き出す。
+変更のないページは再生成しない。RendererにはHTMLGeneratorの他、JSONRenderer、
+TextRendererがある。
 */
 package slacklog
@@ -0,0 +1,199 @@
+package slacklog
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultFeedEntries : Config.FeedEntries が指定されていない場合のフィードの
+// エントリ数。
+const defaultFeedEntries = 50
+
+// atomFeed represents <feed> element of Atom (RFC 4287).
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Links     []atomLink  `xml:"link"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// feedItem is a message to be an entry of feeds.
+type feedItem struct {
+	channel Channel
+	msg     *Message
+}
+
+// feedID returns an ID which is stable across rebuilds, for a feed or an
+// entry. The ID is a name based UUID (version 5 style) made from the name.
+func feedID(name string) string {
+	sum := sha1.Sum([]byte("slacklog:" + name))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func feedTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+var reHTMLTag = regexp.MustCompile(`<[^>]*>`)
+
+// htmlToText strips tags from HTML, to use it as plain text.
+func htmlToText(s string) string {
+	s = html.UnescapeString(reHTMLTag.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// generateFeeds generates Atom feeds for whole archive (outDir/feed.atom) and
+// for each channel (outDir/${channel_id}/feed.atom).
+func (g *HTMLGenerator) generateFeeds(outDir string, channels []Channel) error {
+	title := g.feedTitle()
+	var all []feedItem
+	for _, channel := range channels {
+		var items []feedItem
+		err := g.s.EachMonth(channel.ID, func(_ MessageMonthKey, msgs Messages) error {
+			for _, msg := range msgs {
+				if !msg.isVisible() {
+					continue
+				}
+				items = append(items, feedItem{channel: channel, msg: msg})
+			}
+			// 古いメッセージを保持し続けないよう、月毎に絞り込む
+			items = g.latestFeedItems(items)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		all = append(all, items...)
+
+		err = g.writeFeed(
+			filepath.Join(outDir, channel.ID, "feed.atom"),
+			title+" - #"+channel.Name,
+			"/"+channel.ID+"/",
+			items,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return g.writeFeed(
+		filepath.Join(outDir, "feed.atom"),
+		title,
+		"/",
+		g.latestFeedItems(all),
+	)
+}
+
+// feedTitle returns a prefix for title of feeds, Config.FeedTitle or the
+// default one.
+func (g *HTMLGenerator) feedTitle() string {
+	if g.cfg.FeedTitle != "" {
+		return g.cfg.FeedTitle
+	}
+	return g.s.WorkspaceDomain() + " log"
+}
+
+// latestFeedItems sorts items in descending order of the timestamp, and
+// returns first Config.FeedEntries items.
+func (g *HTMLGenerator) latestFeedItems(items []feedItem) []feedItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].msg.Timestamp > items[j].msg.Timestamp
+	})
+	n := g.cfg.FeedEntries
+	if n <= 0 {
+		n = defaultFeedEntries
+	}
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+func (g *HTMLGenerator) writeFeed(path, title, pagePath string, items []feedItem) error {
+	feed := atomFeed{
+		Title: title,
+		ID:    feedID(pagePath),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: g.baseURL + pagePath + "feed.atom"},
+			{Rel: "alternate", Type: "text/html", Href: g.baseURL + pagePath},
+		},
+	}
+	for _, item := range items {
+		feed.Entries = append(feed.Entries, g.newFeedEntry(item))
+	}
+	if len(items) > 0 {
+		feed.Updated = feedTime(TsToDateTime(items[0].msg.Timestamp, time.UTC))
+	} else {
+		feed.Updated = feedTime(time.Unix(0, 0))
+	}
+
+	return writeXML(path, feed)
+}
+
+func (g *HTMLGenerator) newFeedEntry(item feedItem) atomEntry {
+	msg := item.msg
+	t := TsToDateTime(msg.Timestamp, time.UTC)
+	link := g.messageURL(item.channel.ID, msg)
+	if thread, ok := g.s.GetThread(item.channel.ID, msg.Timestamp); ok && msg.IsRootOfThread() && thread.ReplyCount() > 0 {
+		link = fmt.Sprintf("%s/%s/threads/%s/", g.baseURL, item.channel.ID, msg.Timestamp)
+	}
+
+	content := g.generateMessageText(*msg)
+	text := []rune(htmlToText(content))
+	if len(text) > 40 {
+		text = append(text[:40], []rune(" ...")...)
+	}
+	author := msg.Username
+	if author == "" {
+		author = g.s.GetDisplayNameByUserID(msg.User)
+	}
+	updated := t
+	if msg.Edited != nil && msg.Edited.Timestamp != "" {
+		updated = TsToDateTime(msg.Edited.Timestamp, time.UTC)
+	}
+
+	return atomEntry{
+		Title:     fmt.Sprintf("%s %s: %s", item.channel.DisplayName(), author, string(text)),
+		ID:        feedID(item.channel.ID + "/" + msg.Timestamp),
+		Updated:   feedTime(updated),
+		Published: feedTime(t),
+		Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: link}},
+		Author:    atomAuthor{Name: author},
+		Content:   atomContent{Type: "html", Body: content},
+	}
+}
@@ -1,12 +1,10 @@
 package slacklog
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html"
 	"io/ioutil"
-	"log"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -38,6 +36,19 @@ type HTMLGenerator struct {
 	// filesBaseURL is root path for attachment files, configured by `FILES_BASEURL` environment variable.
 	filesBaseURL string
 
+	// gen traverses LogStore and renders pages by HTMLGenerator.
+	gen *Generator
+
+	// tmplOnce parses templates for messages only once, into monthTmpl and
+	// threadTmpl. They are cloned for each channel in chTmpls.
+	tmplOnce   sync.Once
+	tmplErr    error
+	monthTmpl  *template.Template
+	threadTmpl *template.Template
+	// key: channel ID
+	chTmpls map[string]*channelTemplates
+	chMu    sync.Mutex
+
 	// ueMap is a set of unknown emojis.
 	ueMap map[string]struct{}
 	ueMu  sync.Mutex
@@ -48,10 +59,9 @@ type HTMLGenerator struct {
 const maxEmbeddedFileSize = 102400
 
 // NewHTMLGenerator : HTMLGeneratorを生成する。
-func NewHTMLGenerator(templateDir string, filesDir string, s *LogStore) *HTMLGenerator {
-	users := s.GetDisplayNameMap()
-	emojis := s.GetEmojiMap()
-	c := NewTextConverter(users, emojis)
+func NewHTMLGenerator(templateDir string, filesDir string, s *LogStore, cfg *Config) *HTMLGenerator {
+	c := newStoreTextConverter(s)
+	c.SetHighlight(cfg.Highlight)
 
 	baseURL := os.Getenv("BASEURL")
 	filesBaseURL := os.Getenv("FILES_BASEURL")
@@ -59,76 +69,112 @@ func NewHTMLGenerator(templateDir string, filesDir string, s *LogStore) *HTMLGen
 		filesBaseURL = baseURL + "/files"
 	}
 
-	return &HTMLGenerator{
+	g := &HTMLGenerator{
 		templateDir:  templateDir,
 		filesDir:     filesDir,
 		s:            s,
 		c:            c,
+		cfg:          *cfg,
 		baseURL:      baseURL,
 		filesBaseURL: filesBaseURL,
+		chTmpls:      map[string]*channelTemplates{},
 	}
+	g.gen = NewGenerator(s, cfg, g)
+	return g
 }
 
-// Generate はoutDirにログデータの変換結果を生成する。
-// 目標とする構造は以下となる:
+// SetFullRebuild : trueを指定すると、Generate()は前回の生成結果を考慮せずに全
+// てのページを再生成する。
+func (g *HTMLGenerator) SetFullRebuild(full bool) {
+	g.gen.SetFullRebuild(full)
+}
+
+// Generate はoutDirにログデータをHTMLに変換した結果を生成する。
+// 生成するページの構造は Generator.Generate() を参照のこと。
+// HTMLの場合は加えて以下を生成する:
 //   - outDir/
-//     - index.html // generateIndex()
-//     - ${channel_id}/ // generateChannelDir()
-//       - index.html // generateChannelIndex()
-//       - ${YYYY}/
-//         - ${MM}/
-//           - index.html // generateMessageDir()
+//     - ${channel_id}/
+//       - feed.atom // generateFeeds()
+//     - users/
+//       - ${user_id}/
+//         - index.html // generateUserPages()
+//     - feed.atom // generateFeeds()
+//     - sitemap.xml // generateSitemap()
+//     - locale.json // generateLocaleJSON()
 func (g *HTMLGenerator) Generate(outDir string) error {
-	channels := g.s.GetChannels()
-
-	createdChannels := []Channel{}
-	var (
-		wg   sync.WaitGroup
-		mu   sync.Mutex
-		errs []error
-	)
-	for i := range channels {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			isCreated, err := g.generateChannelDir(
-				filepath.Join(outDir, channels[i].ID),
-				channels[i],
-			)
-			if err != nil {
-				log.Printf("generateChannelDir(%s) failed: %s", channels[i].ID, err)
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-				return
-			}
-			if isCreated {
-				mu.Lock()
-				createdChannels = append(createdChannels, channels[i])
-				mu.Unlock()
-			}
-		}(i)
+	return g.gen.Generate(outDir)
+}
+
+var _ Renderer = (*HTMLGenerator)(nil)
+var _ SiteRenderer = (*HTMLGenerator)(nil)
+
+// Name returns "html".
+func (g *HTMLGenerator) Name() string {
+	return "html"
+}
+
+// Filename returns "index.html".
+func (g *HTMLGenerator) Filename() string {
+	return "index.html"
+}
+
+// Inputs returns the template directory.
+func (g *HTMLGenerator) Inputs() []string {
+	return []string{g.templateDir}
+}
+
+// RenderSite generates pages for users, Atom feeds, sitemap.xml and
+// locale.json.
+func (g *HTMLGenerator) RenderSite(outDir string, channels []Channel, force bool) error {
+	// ユーザページは全てのチャンネルのメッセージから生成するため、いずれかのファ
+	// イルが変更された場合は全て再生成する
+	if err := g.generateUserPages(outDir, channels, force); err != nil {
+		return err
+	}
+	if err := g.generateFeeds(outDir, channels); err != nil {
+		return err
 	}
-	wg.Wait()
-	if len(errs) > 0 {
-		return errs[0]
+	if err := g.generateSitemap(outDir, channels); err != nil {
+		return err
 	}
-
-	if err := g.generateIndex(filepath.Join(outDir, "index.html"), createdChannels); err != nil {
+	if err := g.generateLocaleJSON(outDir); err != nil {
 		return err
 	}
-
 	return nil
 }
 
-func (g *HTMLGenerator) generateIndex(path string, channels []Channel) error {
+// siteLocale is the locale and the timezone of the archive for search.js.
+type siteLocale struct {
+	Locale string `json:"locale"`
+	// Timezone is an IANA Time Zone name, in which search.js decides dates
+	// of messages.
+	Timezone string       `json:"timezone"`
+	Search   searchLabels `json:"search"`
+}
+
+// generateLocaleJSON generates outDir/locale.json, from which search.js reads
+// labels in the locale of the archive, and its timezone.
+func (g *HTMLGenerator) generateLocaleJSON(outDir string) error {
+	timezone := g.cfg.Timezone
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+	return writeJSON(filepath.Join(outDir, "locale.json"), siteLocale{
+		Locale:   g.s.locale.name,
+		Timezone: timezone,
+		Search:   g.s.locale.search,
+	})
+}
+
+// RenderIndex renders the top index page.
+func (g *HTMLGenerator) RenderIndex(path string, channels []Channel) error {
 	params := make(map[string]interface{})
 	SortChannel(channels)
 	params["baseURL"] = g.baseURL
 	params["channels"] = channels
 	tmplPath := filepath.Join(g.templateDir, "index.tmpl")
 	name := filepath.Base(tmplPath)
-	t, err := template.New(name).ParseFiles(tmplPath)
+	t, err := template.New(name).Funcs(g.pageFuncMap()).ParseFiles(tmplPath)
 	if err != nil {
 		return err
 	}
@@ -138,41 +184,8 @@ func (g *HTMLGenerator) generateIndex(path string, channels []Channel) error {
 	return nil
 }
 
-func (g *HTMLGenerator) generateChannelDir(path string, channel Channel) (bool, error) {
-	msgsMap, err := g.s.GetMessagesPerMonth(channel.ID)
-	if err != nil {
-		return false, err
-	}
-	if len(msgsMap) == 0 {
-		return false, nil
-	}
-
-	if err := os.MkdirAll(path, 0777); err != nil {
-		return false, fmt.Errorf("could not create %s directory: %w", path, err)
-	}
-
-	if err := g.generateChannelIndex(
-		channel,
-		msgsMap.Keys(),
-		filepath.Join(path, "index.html"),
-	); err != nil {
-		return true, err
-	}
-
-	for key, mm := range msgsMap {
-		if err := g.generateMessageDir(
-			channel,
-			key,
-			mm,
-			filepath.Join(path, key.Year(), key.Month()),
-		); err != nil {
-			return true, err
-		}
-	}
-	return true, nil
-}
-
-func (g *HTMLGenerator) generateChannelIndex(channel Channel, keys []MessageMonthKey, path string) error {
+// sortMessageMonthKeys sorts keys in descending order, newer month first.
+func sortMessageMonthKeys(keys []MessageMonthKey) {
 	sort.Slice(keys, func(i, j int) bool {
 		if keys[i].year < keys[j].year {
 			return false
@@ -181,15 +194,22 @@ func (g *HTMLGenerator) generateChannelIndex(channel Channel, keys []MessageMont
 		}
 		return keys[i].month > keys[j].month
 	})
+}
+
+// RenderChannelIndex renders an index page for the channel.
+func (g *HTMLGenerator) RenderChannelIndex(path string, channel Channel, keys []MessageMonthKey) error {
+	sortMessageMonthKeys(keys)
 
 	params := make(map[string]interface{})
 	params["baseURL"] = g.baseURL
 	params["channel"] = channel
 	params["keys"] = keys
+	params["pins"] = g.pinnedMessages(channel)
+	params["history"] = g.channelHistory(channel)
 
 	tempPath := filepath.Join(g.templateDir, "channel_index.tmpl")
 	name := filepath.Base(tempPath)
-	t, err := template.New(name).ParseFiles(tempPath)
+	t, err := template.New(name).Funcs(g.pageFuncMap()).ParseFiles(tempPath)
 	if err != nil {
 		return err
 	}
@@ -199,148 +219,400 @@ func (g *HTMLGenerator) generateChannelIndex(channel Channel, keys []MessageMont
 	return nil
 }
 
-func (g *HTMLGenerator) generateMessageDir(channel Channel, key MessageMonthKey, msgs Messages, path string) error {
-	if err := os.MkdirAll(path, 0777); err != nil {
-		return fmt.Errorf("could not create %s directory: %w", path, err)
+// pinnedMessage is a pinned message shown in the channel index.
+type pinnedMessage struct {
+	URL  string
+	User string
+	Time string
+	// Text is escaped and shortened text of the message.
+	Text string
+}
+
+// pinnedMessages returns pinned messages in the channel, newer pinned first.
+// Pins which messages are not found in logs are skipped.
+func (g *HTMLGenerator) pinnedMessages(channel Channel) []pinnedMessage {
+	pins := append([]ChannelPin(nil), channel.Pins...)
+	sort.SliceStable(pins, func(i, j int) bool {
+		return pins[i].Created > pins[j].Created
+	})
+	var list []pinnedMessage
+	for _, pin := range pins {
+		msg, ok := g.s.GetMessage(channel.ID, pin.ID)
+		if !ok || msg.Deleted {
+			continue
+		}
+		user := msg.Username
+		if user == "" {
+			user = g.s.GetDisplayNameByUserID(msg.User)
+		}
+		text := []rune(strings.Join(strings.Fields(g.c.ToPlainText(msg.Text)), " "))
+		if len(text) > 80 {
+			text = append(text[:80], []rune(" ...")...)
+		}
+		list = append(list, pinnedMessage{
+			URL:  g.messageURL(channel.ID, msg),
+			User: html.EscapeString(user),
+			Time: g.s.locale.formatDateTime(g.s.tsToDateTime(msg.Timestamp)),
+			Text: html.EscapeString(string(text)),
+		})
+	}
+	return list
+}
+
+// channelHistoryItem is a change of the channel shown in the channel index.
+type channelHistoryItem struct {
+	URL  string
+	Time string
+	// Text is an escaped description of the change.
+	Text string
+}
+
+// channelHistory returns changes of the channel, newer first.
+func (g *HTMLGenerator) channelHistory(channel Channel) []channelHistoryItem {
+	history, err := g.s.GetChannelHistory(channel.ID)
+	if err != nil {
+		return nil
+	}
+	list := make([]channelHistoryItem, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		msg := history[i]
+		item := channelHistoryItem{
+			Time: g.s.locale.formatDateTime(g.s.tsToDateTime(msg.Timestamp)),
+			Text: g.channelEventText(msg),
+		}
+		// 月のページに表示する場合のみリンクする
+		if key := g.s.tsMonthKey(msg.Timestamp); g.cfg.ChannelEvents && g.s.hasMonth(channel.ID, key) {
+			item.URL = g.messageURL(channel.ID, msg)
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// channelEventText returns an escaped description of the message which
+// changes the channel. It returns an empty string for other messages.
+func (g *HTMLGenerator) channelEventText(msg *Message) string {
+	if !msg.isChannelEvent() {
+		return ""
+	}
+	l := g.s.locale
+	user := html.EscapeString(g.s.GetDisplayNameByUserID(msg.User))
+	switch event := strings.TrimPrefix(strings.TrimPrefix(msg.SubType, "channel_"), "group_"); event {
+	case "topic":
+		if msg.Topic == "" {
+			return l.label("topic_cleared", user)
+		}
+		return l.label(event, user, html.EscapeString(msg.Topic))
+	case "purpose":
+		if msg.Purpose == "" {
+			return l.label("purpose_cleared", user)
+		}
+		return l.label(event, user, html.EscapeString(msg.Purpose))
+	case "name":
+		return l.label(event, user, html.EscapeString(msg.OldName), html.EscapeString(msg.Name))
+	case "archive", "unarchive":
+		return l.label(event, user)
 	}
+	return ""
+}
 
+// withChannelEvents returns messages in the month page, with messages which
+// change the channel in the month.
+func (g *HTMLGenerator) withChannelEvents(channel Channel, key MessageMonthKey, msgs Messages) Messages {
+	history, err := g.s.GetChannelHistory(channel.ID)
+	if err != nil {
+		return msgs
+	}
+	var merged Messages
+	for _, msg := range history {
+		if g.s.tsMonthKey(msg.Timestamp) == key {
+			merged = append(merged, msg)
+		}
+	}
+	if len(merged) == 0 {
+		return msgs
+	}
+	merged = append(merged, msgs...)
+	merged.Sort()
+	return merged
+}
+
+// RenderMonth renders a page for messages in the month.
+func (g *HTMLGenerator) RenderMonth(path string, channel Channel, key MessageMonthKey, msgs Messages) error {
+	if g.cfg.ChannelEvents {
+		msgs = g.withChannelEvents(channel, key, msgs)
+	}
 	params := make(map[string]interface{})
 	params["baseURL"] = g.baseURL
 	params["filesBaseURL"] = g.filesBaseURL
 	params["channel"] = channel
 	params["monthKey"] = key
 	params["msgs"] = msgs
+	params["highlight"] = g.cfg.Highlight
 
-	// TODO check below subtypes work correctly
-	// TODO support more subtypes
-
-	t, err := template.New("").
-		Funcs(map[string]interface{}{
-			"visible": g.isVisibleMessage,
-			"datetime": func(ts string) string {
-				return TsToDateTime(ts).Format("2日 15:04:05")
-			},
-			"threadMessageTime": func(msgTs, threadTs string) string {
-				return LevelOfDetailTime(TsToDateTime(msgTs), TsToDateTime(threadTs))
-			},
-			"slackPermalink": func(ts string) string {
-				return strings.Replace(ts, ".", "", 1)
-			},
-			"username": func(msg *Message) string {
-				if msg.Username != "" {
-					return g.c.escapeSpecialChars(msg.Username)
-				}
-				return g.c.escapeSpecialChars(g.s.GetDisplayNameByUserID(msg.User))
-			},
-			"userIconUrl": func(msg *Message) string {
-				if msg.Icons != nil && msg.Icons.Image48 != "" {
-					return msg.Icons.Image48
-				}
-				userID := msg.User
-				if userID == "" && msg.BotID != "" {
-					userID = msg.BotID
-				}
-				user, ok := g.s.GetUserByID(userID)
-				if !ok {
-					return "" // TODO show default icon
-				}
-				return user.Profile.Image48
-			},
-			"text":           g.generateMessageText,
-			"reactions":      g.getReactions,
-			"attachmentText": g.generateAttachmentText,
-			"fileHTML":       g.generateFileHTML,
-			"threadMtime": func(ts string) string {
-				if t, ok := g.s.GetThread(channel.ID, ts); ok {
-					return LevelOfDetailTime(t.LastReplyTime(), TsToDateTime(ts))
-				}
-				return ""
-			},
-			"threads": func(ts string) Messages {
-				if t, ok := g.s.GetThread(channel.ID, ts); ok {
-					return t.Replies()
-				}
-				return nil
-			},
-			"threadNum": func(ts string) int {
-				if t, ok := g.s.GetThread(channel.ID, ts); ok {
-					return t.ReplyCount()
-				}
-				return 0
-			},
-			"threadRootText": func(ts string) string {
-				thread, ok := g.s.GetThread(channel.ID, ts)
-				if !ok {
-					return ""
-				}
-				runes := []rune(thread.RootText())
-				text := string(runes)
-				if len(runes) > 20 {
-					text = string(runes[:20]) + " ..."
-				}
-				return g.c.escape(text)
-			},
-			"hasPrevMonth": func(key MessageMonthKey) bool {
-				return g.s.HasPrevMonth(channel.ID, key)
-			},
-			"hasNextMonth": func(key MessageMonthKey) bool {
-				return g.s.HasNextMonth(channel.ID, key)
-			},
-			"hostBySlack":      HostBySlack,
-			"localPath":        LocalPath,
-			"topLevelMimetype": TopLevelMimetype,
-			"thumbImagePath":   ThumbImagePath,
-			"thumbImageWidth":  ThumbImageWidth,
-			"thumbImageHeight": ThumbImageHeight,
-			"thumbVideoPath":   ThumbVideoPath,
-			"stringsJoin":      strings.Join,
-			"genAttachedURL": func(ts json.Number, fromURL string) string {
-				timestamp := string(ts)
-				if len(strings.Split(timestamp, ".")) < 2 {
-					return ""
-				}
-				postTime := TsToDateTime(timestamp)
-				c := strings.Split(fromURL, "/")
-				if len(c) < 2 {
-					return ""
-				}
-				channel := c[len(c)-2]
-				return fmt.Sprintf("/%s/%d/%02d/#ts-%s", channel, postTime.Year(), postTime.Month(), ts)
-			},
-			"isSlackMessage": func(fromURL string) bool {
-				return len(fromURL) >= 25 && fromURL[0:25] == "https://vim-jp.slack.com/"
-			},
-			"getBaseURL": func() string {
-				return g.baseURL
-			},
-		}).
-		ParseGlob(filepath.Join(g.templateDir, "channel_per_month", "*.tmpl"))
+	ct, err := g.channelTemplates(channel)
 	if err != nil {
 		return err
 	}
-	tmpl := t.Lookup("index.tmpl")
-	if tmpl == nil {
-		return errors.New("no index.tmpl in channel_per_month/ dir")
-	}
-	err = executeAndWrite(tmpl, params, filepath.Join(path, "index.html"))
+	err = executeAndWrite(ct.month, params, path)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// channelTemplates has templates for messages, which functions are bound to
+// a channel.
+type channelTemplates struct {
+	// month is index.tmpl in channel_per_month/ dir.
+	month *template.Template
+	// thread is thread.tmpl.
+	thread *template.Template
+}
+
+// parseMessageTemplates parses templates for messages once.
+func (g *HTMLGenerator) parseMessageTemplates() error {
+	g.tmplOnce.Do(func() {
+		// 関数はチャンネル毎にchannelTemplates()で差し替える
+		funcs := g.messageFuncMap(Channel{})
+		t, err := template.New("").
+			Funcs(funcs).
+			ParseGlob(filepath.Join(g.templateDir, "channel_per_month", "*.tmpl"))
+		if err != nil {
+			g.tmplErr = err
+			return
+		}
+		g.monthTmpl = t.Lookup("index.tmpl")
+		if g.monthTmpl == nil {
+			g.tmplErr = errors.New("no index.tmpl in channel_per_month/ dir")
+			return
+		}
+		g.threadTmpl, g.tmplErr = template.New("thread.tmpl").
+			Funcs(funcs).
+			ParseFiles(
+				filepath.Join(g.templateDir, "thread.tmpl"),
+				filepath.Join(g.templateDir, "channel_per_month", "attachment.tmpl"),
+			)
+	})
+	return g.tmplErr
+}
+
+// channelTemplates returns templates for messages in the channel. They are
+// cloned from the parsed ones once for each channel.
+func (g *HTMLGenerator) channelTemplates(channel Channel) (*channelTemplates, error) {
+	if err := g.parseMessageTemplates(); err != nil {
+		return nil, err
+	}
+	g.chMu.Lock()
+	defer g.chMu.Unlock()
+	if ct, ok := g.chTmpls[channel.ID]; ok {
+		return ct, nil
+	}
+	funcs := g.messageFuncMap(channel)
+	month, err := g.monthTmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	thread, err := g.threadTmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	ct := &channelTemplates{
+		month:  month.Funcs(funcs),
+		thread: thread.Funcs(funcs),
+	}
+	g.chTmpls[channel.ID] = ct
+	return ct, nil
+}
+
+// RenderThread renders a page for the thread.
+func (g *HTMLGenerator) RenderThread(path string, channel Channel, key MessageMonthKey, root *Message, replies Messages) error {
+	ct, err := g.channelTemplates(channel)
+	if err != nil {
+		return err
+	}
+
+	params := make(map[string]interface{})
+	params["baseURL"] = g.baseURL
+	params["filesBaseURL"] = g.filesBaseURL
+	params["channel"] = channel
+	params["monthKey"] = key
+	params["root"] = root
+	params["replies"] = replies
+	params["highlight"] = g.cfg.Highlight
+	return executeAndWrite(ct.thread, params, path)
+}
+
+// messageFuncMap returns functions for templates which render messages in
+// the channel.
+func (g *HTMLGenerator) messageFuncMap(channel Channel) template.FuncMap {
+	// TODO check below subtypes work correctly
+	// TODO support more subtypes
+
+	funcs := template.FuncMap{
+		"visible": g.isVisibleMessage,
+		"datetime": func(ts string) string {
+			return g.s.locale.formatDayTime(g.s.tsToDateTime(ts))
+		},
+		"fullDatetime": func(ts string) string {
+			return g.s.locale.formatDateTimeSecs(g.s.tsToDateTime(ts))
+		},
+		"threadMessageTime": func(msgTs, threadTs string) string {
+			return g.s.locale.levelOfDetailTime(g.s.tsToDateTime(msgTs), g.s.tsToDateTime(threadTs))
+		},
+		"slackPermalink": func(ts string) string {
+			return strings.Replace(ts, ".", "", 1)
+		},
+		"userPageURL": func(msg *Message) string {
+			if msg.User == "" {
+				return ""
+			}
+			if _, ok := g.s.GetUserByID(msg.User); !ok {
+				return ""
+			}
+			return g.baseURL + UserPagePath(msg.User)
+		},
+		"username": func(msg *Message) string {
+			if msg.Username != "" {
+				return g.c.escapeSpecialChars(msg.Username)
+			}
+			return g.c.escapeSpecialChars(g.s.GetDisplayNameByUserID(msg.User))
+		},
+		"userIconUrl": func(msg *Message) string {
+			if msg.Icons != nil && msg.Icons.Image48 != "" {
+				return msg.Icons.Image48
+			}
+			userID := msg.User
+			if userID == "" && msg.BotID != "" {
+				userID = msg.BotID
+			}
+			user, ok := g.s.GetUserByID(userID)
+			if !ok {
+				return "" // TODO show default icon
+			}
+			return user.Profile.Image48
+		},
+		"text":           g.generateMessageText,
+		"reactions":      g.getReactions,
+		"attachmentText": g.generateAttachmentText,
+		"fileHTML":       g.generateFileHTML,
+		"threadMtime": func(ts string) string {
+			if t, ok := g.s.GetThread(channel.ID, ts); ok {
+				return g.s.locale.levelOfDetailTime(t.LastReplyTime(g.s.Location()), g.s.tsToDateTime(ts))
+			}
+			return ""
+		},
+		"threads": func(ts string) Messages {
+			if t, ok := g.s.GetThread(channel.ID, ts); ok {
+				return t.Replies()
+			}
+			return nil
+		},
+		"threadNum": func(ts string) int {
+			if t, ok := g.s.GetThread(channel.ID, ts); ok {
+				return t.ReplyCount()
+			}
+			return 0
+		},
+		"threadRootText": func(ts string) string {
+			thread, ok := g.s.GetThread(channel.ID, ts)
+			if !ok {
+				return ""
+			}
+			runes := []rune(thread.RootText())
+			text := string(runes)
+			if len(runes) > 20 {
+				text = string(runes[:20]) + " ..."
+			}
+			return g.c.escape(text)
+		},
+		"channelEvent": func(msg *Message) string {
+			return g.channelEventText(msg)
+		},
+		"hasPrevMonth": func(key MessageMonthKey) bool {
+			return g.s.HasPrevMonth(channel.ID, key)
+		},
+		"hasNextMonth": func(key MessageMonthKey) bool {
+			return g.s.HasNextMonth(channel.ID, key)
+		},
+		"hostBySlack":      HostBySlack,
+		"localPath":        LocalPath,
+		"topLevelMimetype": TopLevelMimetype,
+		"thumbImagePath":   ThumbImagePath,
+		"thumbImageWidth":  ThumbImageWidth,
+		"thumbImageHeight": ThumbImageHeight,
+		"thumbVideoPath":   ThumbVideoPath,
+		"stringsJoin":      strings.Join,
+		"archiveURL": func(rawURL string) string {
+			u, _ := g.c.archiveURL(rawURL)
+			return u
+		},
+		"workspaceURL": func() string {
+			return "https://" + g.s.WorkspaceDomain()
+		},
+		"getBaseURL": func() string {
+			return g.baseURL
+		},
+	}
+	for name, f := range g.pageFuncMap() {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// pageFuncMap returns functions for templates of all pages, which show texts
+// in the locale of the archive.
+func (g *HTMLGenerator) pageFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"monthLabel": g.s.locale.formatMonth,
+		"label":      g.s.locale.label,
+	}
+}
+
 func (g *HTMLGenerator) isVisibleMessage(msg Message) bool {
 	return msg.SubType == "" || msg.SubType == "bot_message" || msg.SubType == "slackbot_response" || msg.SubType == "thread_broadcast"
 }
 
 func (g *HTMLGenerator) generateMessageText(msg Message) string {
-	text := g.c.ToHTML(msg.Text)
+	if msg.Deleted {
+		return "<span class='slacklog-text-deleted'>" + g.s.locale.label("deleted_message") + "</span>"
+	}
+	text, ok := g.c.BlocksToHTML(msg.Blocks)
+	if !ok {
+		text = g.c.ToHTML(msg.Text)
+	}
 	if msg.Edited != nil && g.cfg.EditedSuffix != "" {
 		text += "<span class='slacklog-text-edited'>" + html.EscapeString(g.cfg.EditedSuffix) + "</span>"
 	}
+	if g.cfg.EditHistory && len(msg.History) > 0 {
+		text += g.generateEditHistory(msg.History)
+	}
 	return text
 }
 
+// generateEditHistory : 編集前のメッセージを古い順に折り畳んで表示する。
+func (g *HTMLGenerator) generateEditHistory(history Messages) string {
+	var b strings.Builder
+	b.WriteString("<details class='slacklog-edit-history'><summary>" + g.s.locale.label("edit_history") + "</summary><ol>")
+	for _, prev := range history {
+		ts := prev.Timestamp
+		if prev.Edited != nil && prev.Edited.Timestamp != "" {
+			ts = prev.Edited.Timestamp
+		}
+		text, ok := g.c.BlocksToHTML(prev.Blocks)
+		if !ok {
+			text = g.c.ToHTML(prev.Text)
+		}
+		b.WriteString("<li><span class='slacklog-edit-time'>")
+		b.WriteString(g.s.locale.formatDateTimeSecs(g.s.tsToDateTime(ts)))
+		b.WriteString("</span> ")
+		b.WriteString(text)
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ol></details>")
+	return b.String()
+}
+
 func (g *HTMLGenerator) generateAttachmentText(attachment slack.Attachment) string {
 	return g.c.ToHTML(attachment.Text)
 }
@@ -359,6 +631,11 @@ func (g *HTMLGenerator) generateFileHTML(file slack.File) string {
 		}
 		return fmt.Sprintf(`<span class="file-error">failed to read a file: %s</span>`, err)
 	}
+	if g.cfg.Highlight {
+		if l := lexerForFile(file.Filetype, file.Name, string(src)); l != nil {
+			return "<code class='slacklog-highlight' data-lang='" + l.name + "'>" + l.highlight(string(src), html.EscapeString) + "</code>"
+		}
+	}
 	ftype := file.Filetype
 	if file.Filetype == "text" {
 		ftype = "none"
@@ -0,0 +1,533 @@
+package slacklog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/slack-go/slack"
+)
+
+func copyDir(t *testing.T, from, to string) {
+	t.Helper()
+
+	err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(to, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, 0777)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, b, 0666)
+	})
+	if err != nil {
+		t.Fatalf("failed to copyDir: %s", err)
+	}
+}
+
+func newTestGenerator(t *testing.T, dataDir string) *HTMLGenerator {
+	t.Helper()
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHTMLGenerator("../../templates", "testdata/generator/files", s, cfg)
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHTMLGenerator_Generate_incremental(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	outDir := filepath.Join(tmpPath, "site")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// mark all pages, to detect which pages are regenerated.
+	const marker = "not regenerated"
+	pages := []string{
+		filepath.Join(outDir, "index.html"),
+		filepath.Join(outDir, "C001", "index.html"),
+		filepath.Join(outDir, "C001", "2020", "01", "index.html"),
+		filepath.Join(outDir, "C001", "2020", "02", "index.html"),
+	}
+	for _, p := range pages {
+		if err := ioutil.WriteFile(p, []byte(marker), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pages {
+		if got := readString(t, p); got != marker {
+			t.Errorf("%s is regenerated without changes", p)
+		}
+	}
+
+	// add a message to February, which is a reply for a thread in January.
+	febPath := filepath.Join(dataDir, "C001", "2020-02-03.json")
+	feb := readString(t, febPath)
+	feb = feb[:len(feb)-2] + `,
+ {"type":"message","user":"U002","text":"another reply","ts":"1580700200.000300","thread_ts":"1580000000.000100","parent_user_id":"U001"}]
+`
+	if err := ioutil.WriteFile(febPath, []byte(feb), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path        string
+		regenerated bool
+	}{
+		{pages[0], false},
+		{pages[1], false},
+		{pages[2], true},
+		{pages[3], true},
+	} {
+		got := readString(t, tc.path) != marker
+		if got != tc.regenerated {
+			t.Errorf("unexpected regeneration of %s: want=%t got=%t", tc.path, tc.regenerated, got)
+		}
+	}
+
+	g := newTestGenerator(t, dataDir)
+	g.SetFullRebuild(true)
+	if err := g.Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pages {
+		if got := readString(t, p); got == marker {
+			t.Errorf("%s is not regenerated by full rebuild", p)
+		}
+	}
+}
+
+func TestHTMLGenerator_Generate_deletedReply(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	outDir := filepath.Join(tmpPath, "site")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	const marker = "not regenerated"
+	janPage := filepath.Join(outDir, "C001", "2020", "01", "index.html")
+	if err := ioutil.WriteFile(janPage, []byte(marker), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// remove the reply in February, for a thread in January.
+	febPath := filepath.Join(dataDir, "C001", "2020-02-03.json")
+	feb := `[{"type":"message","user":"U002","text":"feb message","ts":"1580700000.000100"}]
+`
+	if err := ioutil.WriteFile(febPath, []byte(feb), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, janPage); got == marker {
+		t.Errorf("%s is not regenerated after a reply is removed", janPage)
+	}
+}
+
+func TestHTMLGenerator_Generate_removedThread(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	outDir := filepath.Join(tmpPath, "site")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	threadDir := filepath.Join(outDir, "C001", "threads", "1580000000.000100")
+	if _, err := os.Stat(threadDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// remove all replies of the thread.
+	for name, content := range map[string]string{
+		"2020-01-26.json": `[{"type":"message","user":"U001","text":"hello","ts":"1580000000.000100"}]`,
+		"2020-02-03.json": `[{"type":"message","user":"U002","text":"feb message","ts":"1580700000.000100"}]`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dataDir, "C001", name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := newTestGenerator(t, dataDir).Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(threadDir); !os.IsNotExist(err) {
+		t.Errorf("%s is not removed: %v", threadDir, err)
+	}
+}
+
+func TestHTMLGenerator_Generate_threadPage(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	if err := newTestGenerator(t, "testdata/generator/slacklog_data").Generate(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readString(t, filepath.Join(tmpPath, "C001", "threads", "1580000000.000100", "index.html"))
+	for _, want := range []string{
+		`href="/C001/2020/01/#ts-1580000000.000100"`,
+		`id="ts-1580000100.000200"`,
+		// a reply posted in the next month.
+		`id="ts-1580700100.000200"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("thread page doesn't contain %q", want)
+		}
+	}
+
+	month := readString(t, filepath.Join(tmpPath, "C001", "2020", "01", "index.html"))
+	if want := `href="/C001/threads/1580000000.000100/"`; !strings.Contains(month, want) {
+		t.Errorf("month page doesn't contain %q", want)
+	}
+}
+
+func TestHTMLGenerator_Generate_highlight(t *testing.T) {
+	for _, highlight := range []bool{false, true} {
+		t.Run(fmt.Sprintf("highlight=%t", highlight), func(t *testing.T) {
+			tmpPath := createTmpDir(t)
+			defer t.Cleanup(func() {
+				cleanupTmpDir(t, tmpPath)
+			})
+
+			g := newTestGenerator(t, "testdata/generator/slacklog_data")
+			g.cfg.Highlight = highlight
+			g.c.SetHighlight(highlight)
+			if err := g.Generate(tmpPath); err != nil {
+				t.Fatal(err)
+			}
+
+			// Prismはサーバ側でハイライトしない場合のみ読み込む
+			for _, path := range []string{
+				filepath.Join("C001", "2020", "01", "index.html"),
+				filepath.Join("C001", "threads", "1580000000.000100", "index.html"),
+			} {
+				page := readString(t, filepath.Join(tmpPath, path))
+				if got := strings.Contains(page, "prismjs"); got == highlight {
+					t.Errorf("%s: Prism is loaded: %t", path, got)
+				}
+				if got := strings.Contains(page, "/assets/css/highlight.css"); got != highlight {
+					t.Errorf("%s: highlight.css is loaded: %t", path, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLGenerator_Generate_pins(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	if err := newTestGenerator(t, "testdata/generator/slacklog_data").Generate(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readString(t, filepath.Join(tmpPath, "C001", "index.html"))
+	for _, want := range []string{
+		`<h5 class="text-gray pb-1">ピン留め</h5>`,
+		`<a class="SideNav-item" href="/C001/2020/01/#ts-1580000000.000100">`,
+		`<span class="text-bold mr-1">Alice</span>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("channel index doesn't contain %q", want)
+		}
+	}
+}
+
+func TestHTMLGenerator_Generate_channelEvents(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+	err := ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-02-05.json"), []byte(`[
+ {"type":"message","subtype":"channel_topic","user":"U001","text":"<@U001> set the channel topic: <b>vim</b>","topic":"<b>vim</b>","ts":"1580860000.000100"},
+ {"type":"message","subtype":"channel_name","user":"U002","text":"<@U002> renamed the channel from \"old\" to \"general\"","old_name":"old","name":"general","ts":"1580870000.000100"}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, enabled := range []bool{false, true} {
+		cfg, err := ReadConfig("testdata/generator/config.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.ChannelEvents = enabled
+		s, err := NewLogStore(dataDir, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outDir := filepath.Join(tmpPath, fmt.Sprintf("site-%t", enabled))
+		if err := NewHTMLGenerator("../../templates", "testdata/generator/files", s, cfg).Generate(outDir); err != nil {
+			t.Fatal(err)
+		}
+
+		index := readString(t, filepath.Join(outDir, "C001", "index.html"))
+		for _, want := range []string{
+			`<h5 class="text-gray pb-1">チャンネルの履歴</h5>`,
+			`Alice がトピックを「&lt;b&gt;vim&lt;/b&gt;」に設定しました`,
+			`bob がチャンネル名を #old から #general に変更しました`,
+		} {
+			if !strings.Contains(index, want) {
+				t.Errorf("channel index (channel_events: %t) doesn't contain %q", enabled, want)
+			}
+		}
+		// 新しい変更が先に表示される
+		if strings.Index(index, "#general") > strings.Index(index, "トピック") {
+			t.Errorf("channel history (channel_events: %t) is not newest first", enabled)
+		}
+
+		month := readString(t, filepath.Join(outDir, "C001", "2020", "02", "index.html"))
+		line := `<div class="slacklog-channel-event m-3 f6 text-gray" id="ts-1580860000.000100">`
+		if got := strings.Contains(month, line); got != enabled {
+			t.Errorf("month page (channel_events: %t) contains channel event: %t", enabled, got)
+		}
+		link := `href="/C001/2020/02/#ts-1580860000.000100"`
+		if got := strings.Contains(index, link); got != enabled {
+			t.Errorf("channel index (channel_events: %t) links to channel event: %t", enabled, got)
+		}
+	}
+}
+
+func TestHTMLGenerator_Generate_locale(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+	err := ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-02-05.json"), []byte(`[
+ {"type":"message","subtype":"channel_name","user":"U002","text":"<@U002> renamed the channel from \"old\" to \"general\"","old_name":"old","name":"general","ts":"1580870000.000100"}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Locale = "en"
+	cfg.Timezone = "America/New_York"
+	cfg.EditHistory = true
+	s, err := NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewHTMLGenerator("../../templates", "testdata/generator/files", s, cfg)
+	outDir := filepath.Join(tmpPath, "site")
+	if err := g.Generate(outDir); err != nil {
+		t.Fatal(err)
+	}
+
+	index := readString(t, filepath.Join(outDir, "C001", "index.html"))
+	for _, want := range []string{
+		`bob renamed the channel from #old to #general`,
+		`/C001/2020/01/">January 2020</a>`,
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("channel index doesn't contain %q", want)
+		}
+	}
+
+	// testdataは日本語を含まないため、日本語があればラベルが翻訳されていない
+	pages := 0
+	for name, content := range readDirFiles(t, outDir) {
+		if filepath.Ext(name) != ".html" {
+			continue
+		}
+		pages++
+		for _, line := range strings.Split(content, "\n") {
+			if strings.IndexFunc(line, func(r rune) bool {
+				return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+			}) >= 0 {
+				t.Errorf("%s has a Japanese label: %s", name, strings.TrimSpace(line))
+			}
+		}
+	}
+	if pages == 0 {
+		t.Error("no pages are generated")
+	}
+
+	var locale siteLocale
+	if err := ReadFileAsJSON(filepath.Join(outDir, "locale.json"), true, &locale); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(siteLocale{Locale: "en", Timezone: "America/New_York", Search: locales["en"].search}, locale); diff != "" {
+		t.Errorf("unexpected locale.json: -want +got\n%s", diff)
+	}
+
+	msg := Message{}
+	msg.Text = "new"
+	prev := &Message{}
+	prev.Timestamp = "1580000000.000100"
+	prev.Text = "old"
+	msg.History = Messages{prev}
+	want := "new<details class='slacklog-edit-history'><summary>Edit history</summary><ol><li><span class='slacklog-edit-time'>Jan 25, 2020 19:53:20</span> old</li></ol></details>"
+	if got := g.generateMessageText(msg); got != want {
+		t.Errorf("unexpected text with history:\nwant: %s\n got: %s", want, got)
+	}
+	msg.Deleted = true
+	if got, want := g.generateMessageText(msg), "<span class='slacklog-text-deleted'>This message was deleted.</span>"; got != want {
+		t.Errorf("unexpected deleted text:\nwant: %s\n got: %s", want, got)
+	}
+}
+
+func TestHTMLGenerator_Generate_feeds(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	if err := newTestGenerator(t, "testdata/generator/slacklog_data").Generate(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path  string
+		title string
+	}{
+		{filepath.Join(tmpPath, "feed.atom"), "vim-jp.slack.com log"},
+		{filepath.Join(tmpPath, "C001", "feed.atom"), "vim-jp.slack.com log - #general"},
+	} {
+		path := tc.path
+		var feed atomFeed
+		if err := xml.Unmarshal([]byte(readString(t, path)), &feed); err != nil {
+			t.Fatalf("failed to parse %s: %s", path, err)
+		}
+		if feed.Title != tc.title {
+			t.Errorf("unexpected title of %s: want=%q got=%q", path, tc.title, feed.Title)
+		}
+		var ids []string
+		for _, e := range feed.Entries {
+			ids = append(ids, e.ID)
+		}
+		// newest first, a reply and a channel_join are not included.
+		want := []string{
+			feedID("C001/1580700000.000100"),
+			feedID("C001/1580000000.000100"),
+		}
+		if diff := cmp.Diff(want, ids); diff != "" {
+			t.Errorf("unexpected entries in %s: -want +got\n%s", path, diff)
+		}
+	}
+
+	g := newTestGenerator(t, "testdata/generator/slacklog_data")
+	g.cfg.FeedTitle = "vim-jp log"
+	if got := g.feedTitle(); got != "vim-jp log" {
+		t.Errorf("feed_title is not used: got=%q", got)
+	}
+}
+
+func TestHTMLGenerator_Generate_userPages(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	if err := newTestGenerator(t, "testdata/generator/slacklog_data").Generate(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readString(t, filepath.Join(tmpPath, "users", "U001", "index.html"))
+	for _, want := range []string{
+		// thread started by the user
+		`href="/C001/threads/1580000000.000100/"`,
+		// a reply in February is shown in the page of January
+		`href="/C001/2020/01/#ts-1580700100.000200"`,
+		// a mention links to the user page
+		`<a href='/users/U002/'>@bob</a>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("user page doesn't contain %q", want)
+		}
+	}
+	if !fileExists(filepath.Join(tmpPath, "users", "U002", "index.html")) {
+		t.Errorf("user page for U002 is not generated")
+	}
+}
+
+func TestHTMLGenerator_generateMessageText_edited(t *testing.T) {
+	g := newTestGenerator(t, "testdata/generator/slacklog_data")
+	msg := Message{}
+	msg.Text = "new"
+	msg.Edited = &slack.Edited{Timestamp: "1580000200.000000"}
+	prev := &Message{}
+	prev.Timestamp = "1580000000.000100"
+	prev.Text = "old"
+	msg.History = Messages{prev}
+
+	if got, want := g.generateMessageText(msg), "new<span class='slacklog-text-edited'> (edited)</span>"; got != want {
+		t.Errorf("unexpected text:\nwant: %s\n got: %s", want, got)
+	}
+
+	g.cfg.EditHistory = true
+	want := "new<span class='slacklog-text-edited'> (edited)</span><details class='slacklog-edit-history'><summary>編集履歴</summary><ol><li><span class='slacklog-edit-time'>2020年1月26日 09:53:20</span> old</li></ol></details>"
+	if got := g.generateMessageText(msg); got != want {
+		t.Errorf("unexpected text with history:\nwant: %s\n got: %s", want, got)
+	}
+
+	msg.Deleted = true
+	if got := g.generateMessageText(msg); !strings.Contains(got, "slacklog-text-deleted") {
+		t.Errorf("deleted message is not shown as deleted: %s", got)
+	}
+}
@@ -0,0 +1,469 @@
+package slacklog
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// lexer : シンタックスハイライトのための簡易的な字句解析の定義。
+// キーワード、文字列、コメント、数値のみを区別する。
+type lexer struct {
+	// name is a name of the language, which is shown as a data-lang attribute.
+	name     string
+	keywords map[string]bool
+	// ignoreCase is true when keywords are case insensitive.
+	ignoreCase bool
+	// lineComments start comments which continue to the end of line.
+	lineComments []string
+	// lineStartComments are same as lineComments, but only at the start of
+	// lines (after spaces), like `"` of Vim script.
+	lineStartComments []string
+	// blockComment is start and end of a block comment, if the language has.
+	blockComment [2]string
+	// quotes are characters which start and end strings.
+	quotes string
+	// multiLineQuotes are quotes of strings which can contain newlines.
+	multiLineQuotes string
+	// tripleQuotes allows strings like `"""string"""` of Python.
+	tripleQuotes bool
+}
+
+func keywordSet(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	lexerGo = &lexer{
+		name:            "go",
+		keywords:        keywordSet("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var true false nil iota"),
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		quotes:          "\"'`",
+		multiLineQuotes: "`",
+	}
+	lexerC = &lexer{
+		name:         "c",
+		keywords:     keywordSet("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL #include #define #ifdef #ifndef #endif #if #else #elif #undef #pragma"),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	lexerCPP = &lexer{
+		name:         "cpp",
+		keywords:     keywordSet("auto bool break case catch char class const constexpr continue default delete do double else enum explicit extern false float for friend goto if inline int long namespace new nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while #include #define #ifdef #ifndef #endif #if #else #elif #pragma"),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	lexerJava = &lexer{
+		name:         "java",
+		keywords:     keywordSet("abstract boolean break byte case catch char class continue default do double else enum extends final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch synchronized this throw throws true false try void volatile while var"),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	lexerJavaScript = &lexer{
+		name:            "javascript",
+		keywords:        keywordSet("async await break case catch class const continue debugger default delete do else export extends false finally for from function if import in instanceof let new null of return static super switch this throw true try typeof undefined var void while yield interface type enum implements"),
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		quotes:          "\"'`",
+		multiLineQuotes: "`",
+	}
+	lexerPython = &lexer{
+		name:         "python",
+		keywords:     keywordSet("and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield self print"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+		tripleQuotes: true,
+	}
+	lexerRuby = &lexer{
+		name:         "ruby",
+		keywords:     keywordSet("alias and begin break case class def defined? do else elsif end ensure false for if in module next nil not or redo require rescue retry return self super then true undef unless until when while yield attr_reader attr_accessor puts"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	lexerShell = &lexer{
+		name:         "shell",
+		keywords:     keywordSet("if then else elif fi for while until do done case esac in function return local export echo exit set unset source"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	lexerVim = &lexer{
+		name:              "vim",
+		keywords:          keywordSet("let unlet const if elseif else endif for endfor while endwhile try catch finally endtry function function! endfunction func endfunc return call execute echo echomsg set setlocal map noremap nnoremap inoremap vnoremap xnoremap onoremap cnoremap autocmd augroup END command command! syntax highlight filetype source runtime silent normal def enddef vim9script"),
+		lineStartComments: []string{"\""},
+		lineComments:      []string{"#"},
+		quotes:            "\"'",
+	}
+	lexerRust = &lexer{
+		name:         "rust",
+		keywords:     keywordSet("as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"",
+	}
+	lexerPHP = &lexer{
+		name:         "php",
+		keywords:     keywordSet("abstract and array as break case catch class const continue default do echo else elseif extends false final for foreach function global if implements include interface namespace new null or private protected public require require_once return static switch this throw true try use var while <?php ?>"),
+		lineComments: []string{"//", "#"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	lexerPerl = &lexer{
+		name:         "perl",
+		keywords:     keywordSet("my our local sub if elsif else unless while until for foreach last next redo return use require package print undef"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	lexerLua = &lexer{
+		name:         "lua",
+		keywords:     keywordSet("and break do else elseif end false for function goto if in local nil not or repeat return then true until while"),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"--[[", "]]"},
+		quotes:       "\"'",
+	}
+	lexerSQL = &lexer{
+		name:         "sql",
+		keywords:     keywordSet("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit as null is in like distinct union all primary key"),
+		ignoreCase:   true,
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "'\"",
+	}
+	lexerJSON = &lexer{
+		name:     "json",
+		keywords: keywordSet("true false null"),
+		quotes:   "\"",
+	}
+	lexerYAML = &lexer{
+		name:         "yaml",
+		keywords:     keywordSet("true false null yes no"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	lexerCSS = &lexer{
+		name:         "css",
+		keywords:     keywordSet("important inherit initial none auto"),
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+)
+
+// lexersByName maps names of languages, which are also used for filetypes of
+// Slack and code fences, to lexers.
+var lexersByName = map[string]*lexer{
+	"go":         lexerGo,
+	"golang":     lexerGo,
+	"c":          lexerC,
+	"cpp":        lexerCPP,
+	"c++":        lexerCPP,
+	"java":       lexerJava,
+	"javascript": lexerJavaScript,
+	"js":         lexerJavaScript,
+	"typescript": lexerJavaScript,
+	"ts":         lexerJavaScript,
+	"python":     lexerPython,
+	"py":         lexerPython,
+	"ruby":       lexerRuby,
+	"rb":         lexerRuby,
+	"shell":      lexerShell,
+	"sh":         lexerShell,
+	"bash":       lexerShell,
+	"zsh":        lexerShell,
+	"vim":        lexerVim,
+	"vimscript":  lexerVim,
+	"rust":       lexerRust,
+	"php":        lexerPHP,
+	"perl":       lexerPerl,
+	"lua":        lexerLua,
+	"sql":        lexerSQL,
+	"json":       lexerJSON,
+	"yaml":       lexerYAML,
+	"css":        lexerCSS,
+}
+
+// lexersByExt maps extensions of file names to lexers, for files whose
+// filetype is "text" like Vim script.
+var lexersByExt = map[string]*lexer{
+	".go":   lexerGo,
+	".c":    lexerC,
+	".h":    lexerC,
+	".cpp":  lexerCPP,
+	".cc":   lexerCPP,
+	".java": lexerJava,
+	".js":   lexerJavaScript,
+	".ts":   lexerJavaScript,
+	".py":   lexerPython,
+	".rb":   lexerRuby,
+	".sh":   lexerShell,
+	".vim":  lexerVim,
+	".rs":   lexerRust,
+	".php":  lexerPHP,
+	".pl":   lexerPerl,
+	".lua":  lexerLua,
+	".sql":  lexerSQL,
+	".json": lexerJSON,
+	".yml":  lexerYAML,
+	".yaml": lexerYAML,
+	".css":  lexerCSS,
+}
+
+// lexerForFile returns a lexer for an attached file, by its filetype, its
+// name or its contents.
+func lexerForFile(filetype, name, src string) *lexer {
+	if l, ok := lexersByName[filetype]; ok {
+		return l
+	}
+	base := strings.ToLower(path.Base(name))
+	if l, ok := lexersByExt[path.Ext(base)]; ok {
+		return l
+	}
+	if base == ".vimrc" || base == "_vimrc" || base == ".gvimrc" || base == "vimrc" {
+		return lexerVim
+	}
+	if filetype == "text" || filetype == "" {
+		return detectLexer(src)
+	}
+	return nil
+}
+
+// languageHint is a pattern which suggests a language of code.
+type languageHint struct {
+	re *regexp.Regexp
+	l  *lexer
+}
+
+var reShebang = regexp.MustCompile(`^#!\s*(?:\S*/)?(?:env\s+)?(\S+)`)
+
+// languageHints are patterns to detect a language of a code block, which
+// doesn't have any information about its language. Each matched line is a
+// point for the language.
+var languageHints = []languageHint{
+	{regexp.MustCompile(`^package \w+$|^func (\(\w+ \*?\w+\) )?\w+\(|:= |^import \($`), lexerGo},
+	{regexp.MustCompile(`^#include [<"]|^int main\(`), lexerC},
+	{regexp.MustCompile(`^(public |private )?(static )?class \w+|System\.out\.print|public static void main`), lexerJava},
+	{regexp.MustCompile(`\b(const|let) \w+ = |=> \{|^import .* from ['"]|console\.log\(|function\s*\w*\(.*\)\s*\{|\brequire\(['"]`), lexerJavaScript},
+	{regexp.MustCompile(`^\s*def \w+\(.*\):$|^\s*class \w+(\(.*\))?:$|^from [\w.]+ import |^import \w+$|^\s*(if|for|while|elif|else|try|except).*:$`), lexerPython},
+	{regexp.MustCompile(`^\s*def \w+[^:]*$|^\s*end$|^\s*require ['"]|\.each do\b|\bputs\b`), lexerRuby},
+	{regexp.MustCompile(`^\s*(let [gswbtlav]:|let &|function!?\s|endfunction|endfunc|endif|endfor|augroup|autocmd|au!|[nvxoic]?(nore)?map\s|set(local)?\s+\w+[?=!]?|call \w|execute |syntax |highlight )|^\s*"`), lexerVim},
+	{regexp.MustCompile(`^\s*\$ |^\s*(echo|export|cd|sudo|apt|brew|git|make|curl) |\$\{?\w+\}?|^\s*fi$|^\s*done$`), lexerShell},
+	{regexp.MustCompile(`^\s*fn \w+|^\s*let mut |^use \w+::|println!\(`), lexerRust},
+	{regexp.MustCompile(`^<\?php|\$\w+->`), lexerPHP},
+	{regexp.MustCompile(`(?i)^\s*(select .* from|insert into|update \w+ set|create table|delete from)\b`), lexerSQL},
+}
+
+// detectLexer guesses a language of code. It returns nil when the language is
+// unknown or ambiguous.
+func detectLexer(code string) *lexer {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil
+	}
+	lines := strings.Split(code, "\n")
+	first := strings.TrimSpace(lines[0])
+	if m := reShebang.FindStringSubmatch(first); m != nil {
+		name := m[1]
+		switch {
+		case strings.HasPrefix(name, "python"):
+			name = "python"
+		case name == "node":
+			name = "javascript"
+		}
+		if l, ok := lexersByName[name]; ok {
+			return l
+		}
+	}
+	// 1行目に言語名のみが書かれていることがある
+	if l, ok := lexersByName[strings.ToLower(first)]; ok && len(lines) > 1 {
+		return l
+	}
+	if (first[0] == '{' || first[0] == '[') && strings.Contains(code, `":`) {
+		return lexerJSON
+	}
+
+	scores := map[*lexer]int{}
+	for _, line := range lines {
+		for _, h := range languageHints {
+			if h.re.MatchString(line) {
+				scores[h.l]++
+			}
+		}
+	}
+	var (
+		best      *lexer
+		bestScore int
+		tie       bool
+	)
+	for l, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = l, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	if tie {
+		return nil
+	}
+	return best
+}
+
+// highlight converts code to HTML with span elements for tokens. escape is
+// used to escape texts.
+func (l *lexer) highlight(code string, escape func(string) string) string {
+	b := &strings.Builder{}
+	plain := 0
+	flushTo := func(i int) {
+		if plain < i {
+			b.WriteString(escape(code[plain:i]))
+		}
+	}
+	writeToken := func(class string, start, end int) {
+		flushTo(start)
+		b.WriteString("<span class='hl-" + class + "'>" + escape(code[start:end]) + "</span>")
+		plain = end
+	}
+
+	lineStart := true
+	for i := 0; i < len(code); {
+		ch := code[i]
+		if ch == '\n' {
+			lineStart = true
+			i++
+			continue
+		}
+		if ch == ' ' || ch == '\t' {
+			i++
+			continue
+		}
+		atLineStart := lineStart
+		lineStart = false
+
+		if end, ok := l.scanComment(code, i, atLineStart); ok {
+			writeToken("comment", i, end)
+			i = end
+			continue
+		}
+		if strings.IndexByte(l.quotes, ch) >= 0 {
+			end := l.scanString(code, i)
+			writeToken("string", i, end)
+			i = end
+			continue
+		}
+		if isDigit(ch) && (i == 0 || !isWordChar(code[i-1])) {
+			end := i + 1
+			for end < len(code) && (isWordChar(code[end]) || code[end] == '.') {
+				end++
+			}
+			writeToken("number", i, end)
+			i = end
+			continue
+		}
+		if isWordChar(ch) || ch == '#' || ch == '<' || ch == '?' {
+			end := i + 1
+			for end < len(code) && (isWordChar(code[end]) || code[end] == '!' || code[end] == '?') {
+				end++
+			}
+			word := code[i:end]
+			if l.ignoreCase {
+				word = strings.ToLower(word)
+			}
+			if l.keywords[word] {
+				writeToken("keyword", i, end)
+				i = end
+				continue
+			}
+			// キーワードでない場合は末尾の!や?を除いて再度調べる
+			for end > i+1 && (code[end-1] == '!' || code[end-1] == '?') {
+				end--
+			}
+			if l.keywords[code[i:end]] {
+				writeToken("keyword", i, end)
+			}
+			i = end
+			continue
+		}
+		i++
+	}
+	flushTo(len(code))
+	return b.String()
+}
+
+// scanComment returns the end of a comment at i.
+func (l *lexer) scanComment(code string, i int, atLineStart bool) (int, bool) {
+	rest := code[i:]
+	if start := l.blockComment[0]; start != "" && strings.HasPrefix(rest, start) {
+		n := strings.Index(rest[len(start):], l.blockComment[1])
+		if n < 0 {
+			return len(code), true
+		}
+		return i + len(start) + n + len(l.blockComment[1]), true
+	}
+	prefixes := l.lineComments
+	if atLineStart {
+		prefixes = append(prefixes[:len(prefixes):len(prefixes)], l.lineStartComments...)
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(rest, p) {
+			// shellなどの#は単語の途中では始まらない
+			if p == "#" && i > 0 && !isSpace(code[i-1]) {
+				continue
+			}
+			if n := strings.IndexByte(rest, '\n'); n >= 0 {
+				return i + n, true
+			}
+			return len(code), true
+		}
+	}
+	return 0, false
+}
+
+// scanString returns the end of a string which starts at i.
+func (l *lexer) scanString(code string, i int) int {
+	q := code[i]
+	if l.tripleQuotes {
+		triple := strings.Repeat(string(q), 3)
+		if strings.HasPrefix(code[i:], triple) {
+			n := strings.Index(code[i+3:], triple)
+			if n < 0 {
+				return len(code)
+			}
+			return i + 3 + n + 3
+		}
+	}
+	multiLine := strings.IndexByte(l.multiLineQuotes, q) >= 0
+	for j := i + 1; j < len(code); j++ {
+		switch code[j] {
+		case '\\':
+			// Goの`...`とVim scriptの'...'ではバックスラッシュはエスケープではない
+			if q != '`' && !(q == '\'' && l == lexerVim) {
+				j++
+			}
+		case '\n':
+			if !multiLine {
+				return j
+			}
+		case q:
+			return j + 1
+		}
+	}
+	return len(code)
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || isDigit(ch) || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n'
+}
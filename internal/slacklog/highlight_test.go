@@ -0,0 +1,160 @@
+package slacklog
+
+import (
+	"html"
+	"testing"
+)
+
+func TestDetectLexer(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"empty", "", ""},
+		{"plain text", "hello world\nthis is not code", ""},
+		{"go", "package main\n\nfunc main() {\n\tx := 1\n}", "go"},
+		{"vim", "let g:foo = 1\nfunction! Bar() abort\nendfunction", "vim"},
+		{"vim mappings", "nnoremap <Leader>w :w<CR>\nset number", "vim"},
+		{"python", "import os\n\ndef main():\n    print(os.getcwd())", "python"},
+		{"javascript", "const x = require('x');\nconsole.log(x);", "javascript"},
+		{"shell", "$ git clone https://github.com/vim/vim\n$ cd vim", "shell"},
+		{"shebang", "#!/usr/bin/env python3\nprint(1)", "python"},
+		{"shebang sh", "#!/bin/sh\nls", "shell"},
+		{"language name", "vim\necho 'hello'", "vim"},
+		{"json", "{\n  \"a\": 1\n}", "json"},
+		{"sql", "SELECT * FROM users WHERE id = 1", "sql"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ""
+			if l := detectLexer(tc.in); l != nil {
+				got = l.name
+			}
+			if got != tc.want {
+				t.Errorf("detectLexer(%q) mismatch: want=%q got=%q", tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLexerForFile(t *testing.T) {
+	for _, tc := range []struct {
+		filetype, name, src, want string
+	}{
+		{"go", "main.go", "", "go"},
+		{"javascript", "a.js", "", "javascript"},
+		{"text", "foo.vim", "", "vim"},
+		{"text", ".vimrc", "", "vim"},
+		{"text", "memo.txt", "package main\nfunc main() {}", "go"},
+		{"text", "memo.txt", "just a memo", ""},
+		{"markdown", "README.md", "# title", ""},
+	} {
+		got := ""
+		if l := lexerForFile(tc.filetype, tc.name, tc.src); l != nil {
+			got = l.name
+		}
+		if got != tc.want {
+			t.Errorf("lexerForFile(%q, %q) mismatch: want=%q got=%q", tc.filetype, tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestLexer_highlight(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		l    *lexer
+		in   string
+		want string
+	}{
+		{
+			"go",
+			lexerGo,
+			"func f() { // <c>\n\treturn \"a\\\"b\" + 12\n}",
+			"<span class='hl-keyword'>func</span> f() { <span class='hl-comment'>// &lt;c&gt;</span>\n\t<span class='hl-keyword'>return</span> <span class='hl-string'>&#34;a\\&#34;b&#34;</span> + <span class='hl-number'>12</span>\n}",
+		},
+		{
+			"go raw string",
+			lexerGo,
+			"`a\nb`",
+			"<span class='hl-string'>`a\nb`</span>",
+		},
+		{
+			"identifiers with keywords",
+			lexerGo,
+			"format iffy x1",
+			"format iffy x1",
+		},
+		{
+			"vim comment and string",
+			lexerVim,
+			"\" comment\nlet s = \"str\"\nfunction! F()",
+			"<span class='hl-comment'>&#34; comment</span>\n<span class='hl-keyword'>let</span> s = <span class='hl-string'>&#34;str&#34;</span>\n<span class='hl-keyword'>function!</span> F()",
+		},
+		{
+			"vim literal string",
+			lexerVim,
+			`echo 'a\'`,
+			`<span class='hl-keyword'>echo</span> <span class='hl-string'>&#39;a\&#39;</span>`,
+		},
+		{
+			"python triple quotes",
+			lexerPython,
+			"def f():\n    \"\"\"doc\n\"\"\"",
+			"<span class='hl-keyword'>def</span> f():\n    <span class='hl-string'>&#34;&#34;&#34;doc\n&#34;&#34;&#34;</span>",
+		},
+		{
+			"shell hash in word",
+			lexerShell,
+			"echo $# # count",
+			"<span class='hl-keyword'>echo</span> $# <span class='hl-comment'># count</span>",
+		},
+		{
+			"sql ignores case",
+			lexerSQL,
+			"Select 1",
+			"<span class='hl-keyword'>Select</span> <span class='hl-number'>1</span>",
+		},
+		{
+			"unclosed string",
+			lexerC,
+			"\"abc\nint",
+			"<span class='hl-string'>&#34;abc</span>\n<span class='hl-keyword'>int</span>",
+		},
+		{
+			"japanese",
+			lexerGo,
+			"// 日本語\nx := \"値\"",
+			"<span class='hl-comment'>// 日本語</span>\nx := <span class='hl-string'>&#34;値&#34;</span>",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.l.highlight(tc.in, html.EscapeString); got != tc.want {
+				t.Errorf("highlight(%q) mismatch:\nwant: %s\n got: %s", tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTextConverter_highlight(t *testing.T) {
+	c := newTestTextConverter()
+	c.SetHighlight(true)
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{
+			"```package main\nfunc main() {}```",
+			"<pre class='slacklog-highlight' data-lang='go'><span class='hl-keyword'>package</span> main\n<span class='hl-keyword'>func</span> main() {}</pre>",
+		},
+		{
+			"```{{ not code }}```",
+			"<pre>&#123;&#123; not code }}</pre>",
+		},
+		{
+			"```let g:x = '{{'\nset nu```",
+			"<pre class='slacklog-highlight' data-lang='vim'><span class='hl-keyword'>let</span> g:x = <span class='hl-string'>&#39;&#123;&#123;&#39;</span>\n<span class='hl-keyword'>set</span> nu</pre>",
+		},
+	} {
+		if got := c.ToHTML(tc.in); got != tc.want {
+			t.Errorf("ToHTML(%q) mismatch:\nwant: %s\n got: %s", tc.in, tc.want, got)
+		}
+	}
+}
@@ -2,200 +2,956 @@ package slacklog
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf16"
+
+	"github.com/slack-go/slack"
 )
 
 const gramN = 2
 
+// legacyIndexStateFilename : 以前のIndexer.Updateが出力先ディレクトリに保存し
+// ていた、索引の状態のファイル名。出力先は公開されるため、見つけた場合は削除
+// する。
+const legacyIndexStateFilename = ".index_state.json"
+
+// indexStateVersion : 索引の形式、もしくは索引に含める内容を変えた場合はこの値
+// を増やす。値が異なる場合は索引を全て作り直す。
+const indexStateVersion = 4
+
+// indexFileMagic and indexFormatVersion are the header of index files.
+// search.jsは形式の異なる索引ファイルを読まないため、索引ファイルの形式を変え
+// た場合はindexFormatVersionも増やす。
+const (
+	indexFileMagic     = "SLIX"
+	indexFormatVersion = 1
+)
+
+// indexState : 前回の索引の作成時に索引したメッセージファイルを保持する。
+// Indexer.Updateは変更されたファイルのみを読み込み、既存の索引ファイルに反映
+// する。
+type indexState struct {
+	Version int `json:"version"`
+	// OutDir is the absolute path of the output directory, and
+	// ChannelFileHash is the hash of "channel" file in it. They check that
+	// the index in the output directory is the one which is updated last.
+	OutDir          string `json:"out_dir"`
+	ChannelFileHash string `json:"channel_file_hash"`
+	// key: channel ID, value: channel number in "channel" file
+	Channels map[string]int `json:"channels"`
+	// key: user ID, value: user number in "user" file
+	Users map[string]int `json:"users"`
+	// key: channel ID, file name ("{year}-{month}-{day}.json")
+	Files map[string]map[string]*indexedFile `json:"files"`
+}
+
+// indexedFile : 索引したメッセージファイルと、索引に追加した内容。
+type indexedFile struct {
+	Hash string `json:"hash"`
+	// Messages are timestamps of messages in the file.
+	Messages []string `json:"messages"`
+	// Events are timestamps of messages which are changed or deleted by
+	// events in the file.
+	Events []string `json:"events,omitempty"`
+	// Keys are grams in the messages, which index files have postings of
+	// the messages.
+	Keys []string `json:"keys"`
+	// Snippets are hashes of downloaded snippets attached to the messages.
+	// The key is the path of the snippet, and the value is empty when it is
+	// not downloaded.
+	Snippets map[string]string `json:"snippets,omitempty"`
+}
+
+func newIndexState() *indexState {
+	return &indexState{
+		Version:  indexStateVersion,
+		Channels: map[string]int{},
+		Users:    map[string]int{},
+		Files:    map[string]map[string]*indexedFile{},
+	}
+}
+
+// readIndexState reads indexState in path. It returns nil when the file
+// doesn't exist or its version is old.
+func readIndexState(path string) (*indexState, error) {
+	var state indexState
+	err := ReadFileAsJSON(path, true, &state)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if state.Version != indexStateVersion || state.Channels == nil || state.Users == nil || state.Files == nil {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// matches returns true when the index in outDir is the one which is updated
+// with the state.
+func (state *indexState) matches(outDir string) bool {
+	if state.OutDir != outDir {
+		return false
+	}
+	sum, err := hashFile(filepath.Join(outDir, "channel"))
+	return err == nil && sum == state.ChannelFileHash
+}
+
+func (state *indexState) write(path string) error {
+	return writeFileAtomically(path, func(fw *bufio.Writer) error {
+		return json.NewEncoder(fw).Encode(state)
+	})
+}
+
+// writeFileAtomically writes a file by write into a temporary file in the
+// same directory, and renames it to path. path has either old or new
+// contents, even when writing is interrupted.
+func writeFileAtomically(path string, write func(fw *bufio.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	// リネームした後は何もしない
+	defer os.Remove(tmpPath)
+
+	fw := bufio.NewWriter(f)
+	if err := write(fw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := fw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// TempFileは0600で作成するため、公開できるようにする
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// indexDoc : 索引ファイル中のメッセージ。
+type indexDoc struct {
+	channelNumber int
+	ts            string
+}
+
+// indexField : 索引した文字列の、メッセージ中での種類。索引ファイルにも出力
+// され、search.jsで一致した箇所の表示に用いる。
+type indexField int
+
+const (
+	// fieldText is the text of the message.
+	fieldText indexField = iota
+	// fieldAttachment is titles, texts and fallbacks of attachments.
+	fieldAttachment
+	// fieldFile is names and titles of uploaded files.
+	fieldFile
+	// fieldSnippet is contents of snippets downloaded in filesDir.
+	fieldSnippet
+	// fieldBlocks is texts in Block Kit blocks, except rich_text blocks.
+	fieldBlocks
+)
+
+// Indexer : 検索用の索引を作成する。
 type Indexer struct {
 	s              *LogStore
+	filesDir       string
 	gramIndex      messageIndex
 	channelNumbers map[int]Channel
+	full           bool
+	statePath      string
+	state          *indexState
+	// removed are messages which postings are removed from index files, and
+	// touched are keys of the index files.
+	removed map[indexDoc]struct{}
+	touched map[string]struct{}
 }
 
+// NewIndexer creates an Indexer.
 func NewIndexer(s *LogStore) *Indexer {
 	return &Indexer{
 		s:              s,
 		gramIndex:      messageIndex{},
 		channelNumbers: map[int]Channel{},
+		removed:        map[indexDoc]struct{}{},
+		touched:        map[string]struct{}{},
 	}
 }
 
-func (idx *Indexer) Build() error {
-	channelNumber := 0
-	for _, c := range idx.s.GetChannels() {
-		channelNumber++
-		idx.channelNumbers[channelNumber] = c
-		msgs, err := idx.s.GetAllMessages(c.ID)
+// SetFilesDir sets the directory which files are downloaded by
+// download-files, to index contents of snippets. Snippets are not indexed
+// unless it is set.
+func (idx *Indexer) SetFilesDir(filesDir string) {
+	idx.filesDir = filesDir
+}
+
+// SetFullRebuild makes Update rebuild the whole index, ignoring the state of
+// the last update.
+func (idx *Indexer) SetFullRebuild(full bool) {
+	idx.full = full
+}
+
+// SetStatePath sets the path of the file to save the state of the update,
+// which has indexed message files and grams in them. It should be out of the
+// output directory, which is published. The whole index is rebuilt every
+// time unless it is set.
+func (idx *Indexer) SetStatePath(path string) {
+	idx.statePath = path
+}
+
+// Update builds the index of messages in outDir. Only message files which
+// are added or changed since the last update are read, and postings of their
+// messages are merged into existing index files. Postings of messages which
+// are edited or deleted are replaced. When the state of the last update is
+// not found, or it is not for the index in outDir, all index files are
+// rebuilt. Each file is replaced atomically, and the state is saved after
+// all index files are written.
+func (idx *Indexer) Update(outDir string) error {
+	absOutDir, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+	var state *indexState
+	if idx.statePath != "" && !idx.full {
+		state, err = readIndexState(idx.statePath)
 		if err != nil {
 			return err
 		}
-		for _, m := range msgs {
-			runes := []rune(m.Text)
-			textLen := len(runes)
-			for i := range runes {
-				for n := 1; n <= gramN; n++ {
-					if textLen <= i+n-1 {
-						break
-					}
-					key := string(runes[i : i+n])
-					idx.gramIndex.Add(key, channelNumber, m, i)
-				}
-			}
+	}
+	if state == nil || !state.matches(absOutDir) {
+		if err := removeIndexFiles(outDir); err != nil {
+			return err
 		}
+		state = newIndexState()
 	}
-	return nil
-}
+	state.OutDir = absOutDir
+	idx.state = state
 
-func (idx *Indexer) Output(outDir string) error {
-	channelFilepath := filepath.Join(outDir, "channel")
-	err := idx.writeChannelFile(channelFilepath, idx.channelNumbers)
-	if err != nil {
+	legacyPath := filepath.Join(outDir, legacyIndexStateFilename)
+	if err := os.Remove(legacyPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	for key, mPositions := range idx.gramIndex {
-		s := outDir
-		for _, u := range utf16.Encode([]rune(key)) {
-			s = filepath.Join(s, fmt.Sprintf("%02x", u>>8), fmt.Sprintf("%02x", u&0xff))
+	channels := idx.s.GetChannels()
+	current := make(map[string]struct{}, len(channels))
+	for _, c := range channels {
+		current[c.ID] = struct{}{}
+	}
+	// 対象外になったチャンネルは索引から削除する
+	lastNumber := 0
+	for id, number := range state.Channels {
+		if _, ok := current[id]; !ok {
+			for _, f := range state.Files[id] {
+				idx.removePostings(number, f)
+			}
+			delete(state.Channels, id)
+			delete(state.Files, id)
+			continue
 		}
-		err := idx.writeIndexFile(s+".index", mPositions)
-		if err != nil {
+		if number > lastNumber {
+			lastNumber = number
+		}
+	}
+	for _, c := range channels {
+		number, ok := state.Channels[c.ID]
+		if !ok {
+			lastNumber++
+			number = lastNumber
+			state.Channels[c.ID] = number
+		}
+		idx.channelNumbers[number] = c
+		if err := idx.updateChannel(c.ID, number); err != nil {
 			return err
 		}
 	}
-	return nil
-}
 
-func (idx *Indexer) writeChannelFile(path string, channelNumbers map[int]Channel) error {
-	err := os.MkdirAll(filepath.Dir(path), 0o777)
+	if err := idx.output(outDir); err != nil {
+		return err
+	}
+	if idx.statePath == "" {
+		return nil
+	}
+	sum, err := hashFile(filepath.Join(outDir, "channel"))
 	if err != nil {
 		return err
 	}
+	state.ChannelFileHash = sum
+	return state.write(idx.statePath)
+}
 
-	f, err := os.Create(path)
+// updateChannel indexes message files of the channel which are added or
+// changed, and files which have messages changed by events in them.
+func (idx *Indexer) updateChannel(channelID string, channelNumber int) error {
+	hashes, err := idx.s.logFileHashes(channelID)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	files, ok := idx.state.Files[channelID]
+	if !ok {
+		files = map[string]*indexedFile{}
+		idx.state.Files[channelID] = files
+	}
 
-	fw := bufio.NewWriter(f)
-	for channelNumber, channel := range channelNumbers {
-		_, err := fw.Write([]byte(fmt.Sprintf("%d\t%s\t%s\n", channelNumber, channel.ID, channel.Name)))
+	read := map[string]Messages{}
+	readFile := func(name string) (Messages, error) {
+		if msgs, ok := read[name]; ok {
+			return msgs, nil
+		}
+		msgs, err := idx.s.readLogFile(channelID, name)
+		if err != nil {
+			return nil, err
+		}
+		read[name] = msgs
+		return msgs, nil
+	}
+
+	dirty := map[string]struct{}{}
+	for name, sum := range hashes {
+		if f, ok := files[name]; !ok || f.Hash != sum || idx.snippetsChanged(f) {
+			dirty[name] = struct{}{}
+		}
+	}
+
+	// 変更されたファイルに含まれる、もしくは含まれていたイベントの対象のメッ
+	// セージを含むファイルも索引し直す
+	var targets []string
+	for name, f := range files {
+		if _, ok := dirty[name]; ok {
+			targets = append(targets, f.Events...)
+		} else if _, ok := hashes[name]; !ok {
+			targets = append(targets, f.Events...)
+		}
+	}
+	for name := range dirty {
+		msgs, err := readFile(name)
 		if err != nil {
 			return err
 		}
+		for _, msg := range msgs {
+			if msg.isEvent() {
+				targets = append(targets, msg.targetTimestamp())
+			}
+		}
+	}
+	owners := map[string]string{}
+	for name, f := range files {
+		for _, ts := range f.Messages {
+			owners[ts] = name
+		}
+	}
+	for _, ts := range targets {
+		if name, ok := owners[ts]; ok {
+			if _, ok := hashes[name]; ok {
+				dirty[name] = struct{}{}
+			}
+		}
 	}
 
-	err = fw.Flush()
-	if err != nil {
-		return err
+	for name, f := range files {
+		if _, ok := hashes[name]; !ok {
+			idx.removePostings(channelNumber, f)
+			delete(files, name)
+		}
+	}
+	if len(dirty) == 0 {
+		return nil
 	}
 
+	// 索引し直すメッセージに適用するイベントを集める
+	reindexed := map[string]struct{}{}
+	for name := range dirty {
+		msgs, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			reindexed[msg.Timestamp] = struct{}{}
+		}
+	}
+	eventFiles := map[string]struct{}{}
+	for name := range dirty {
+		eventFiles[name] = struct{}{}
+	}
+	for name, f := range files {
+		for _, ts := range f.Events {
+			if _, ok := reindexed[ts]; ok {
+				eventFiles[name] = struct{}{}
+				break
+			}
+		}
+	}
+	events := map[string]Messages{}
+	for name := range eventFiles {
+		msgs, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if msg.isEvent() {
+				ts := msg.targetTimestamp()
+				events[ts] = append(events[ts], msg)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(dirty))
+	for name := range dirty {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if f, ok := files[name]; ok {
+			idx.removePostings(channelNumber, f)
+		}
+		msgs, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		f := &indexedFile{Hash: hashes[name]}
+		keys := map[string]struct{}{}
+		snippets := map[string]string{}
+		for _, m := range msgs {
+			if m.isEvent() {
+				f.Events = append(f.Events, m.targetTimestamp())
+				continue
+			}
+			if evs := events[m.Timestamp]; len(evs) > 0 {
+				evs.Sort()
+				for _, ev := range evs {
+					m.apply(ev)
+				}
+			}
+			f.Messages = append(f.Messages, m.Timestamp)
+			// 中断された更新で書き出された投稿を重複させないよう、既存の投稿は
+			// 置き換える
+			idx.removed[indexDoc{channelNumber: channelNumber, ts: m.Timestamp}] = struct{}{}
+			idx.addMessage(channelNumber, m, keys, snippets)
+		}
+		if len(snippets) > 0 {
+			f.Snippets = snippets
+		}
+		f.Keys = make([]string, 0, len(keys))
+		for key := range keys {
+			f.Keys = append(f.Keys, key)
+		}
+		sort.Strings(f.Keys)
+		files[name] = f
+	}
 	return nil
 }
 
-func (idx *Indexer) writeIndexFile(path string, mPositions messagePositions) error {
-	err := os.MkdirAll(filepath.Dir(path), 0o777)
+// addMessage adds postings of grams in fields of the message, and adds the
+// grams to keys. Paths and hashes of read snippets are added to snippets.
+func (idx *Indexer) addMessage(channelNumber int, m *Message, keys map[string]struct{}, snippets map[string]string) {
+	pk := postingKey{ts: m.Timestamp, user: idx.userNumber(m)}
+	pk.field = fieldText
+	idx.addField(channelNumber, pk, []string{m.Text}, keys)
+
+	var texts []string
+	for _, a := range m.Attachments {
+		texts = append(texts, a.Title, a.Pretext, a.Text)
+		if a.Fallback != a.Text && a.Fallback != a.Title {
+			texts = append(texts, a.Fallback)
+		}
+	}
+	pk.field = fieldAttachment
+	idx.addField(channelNumber, pk, texts, keys)
+
+	texts = nil
+	var contents []string
+	for _, f := range m.Files {
+		texts = append(texts, f.Name)
+		if f.Title != f.Name {
+			texts = append(texts, f.Title)
+		}
+		path, ok := idx.snippetPath(f)
+		if !ok {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			// ダウンロードされた時に索引し直す
+			snippets[path] = ""
+			continue
+		}
+		snippets[path] = hashBytes(b)
+		contents = append(contents, string(b))
+	}
+	pk.field = fieldFile
+	idx.addField(channelNumber, pk, texts, keys)
+	pk.field = fieldSnippet
+	idx.addField(channelNumber, pk, contents, keys)
+
+	pk.field = fieldBlocks
+	idx.addField(channelNumber, pk, blockTexts(m.Blocks), keys)
+}
+
+// userNumber returns the number of the user who posts the message, assigning
+// a new number to the user at the first time. Messages posted by bots are
+// numbered by the user of the bot if it is in users.json. It returns 0 when
+// the message has no user.
+func (idx *Indexer) userNumber(m *Message) int {
+	id := m.User
+	if id == "" {
+		id = m.BotID
+	}
+	if id == "" {
+		return 0
+	}
+	if u, ok := idx.s.GetUserByID(id); ok {
+		id = u.ID
+	}
+	if number, ok := idx.state.Users[id]; ok {
+		return number
+	}
+	number := len(idx.state.Users) + 1
+	idx.state.Users[id] = number
+	return number
+}
+
+// addField adds postings of grams in texts of the field in pk. Positions in
+// the second and later texts follow the previous text and a separator, so
+// grams across texts are never matched.
+func (idx *Indexer) addField(channelNumber int, pk postingKey, texts []string, keys map[string]struct{}) {
+	offset := 0
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		runes := []rune(text)
+		textLen := len(runes)
+		for i := range runes {
+			for n := 1; n <= gramN; n++ {
+				if textLen <= i+n-1 {
+					break
+				}
+				key := string(runes[i : i+n])
+				idx.gramIndex.Add(key, channelNumber, pk, offset+i)
+				keys[key] = struct{}{}
+			}
+		}
+		offset += textLen + 1
+	}
+}
+
+// snippetPath returns the path of the downloaded file, if the file is a
+// snippet which is embedded in pages.
+func (idx *Indexer) snippetPath(f slack.File) (string, bool) {
+	if idx.filesDir == "" || !HostBySlack(f) || f.Mimetype != "text/plain" || f.Size > maxEmbeddedFileSize {
+		return "", false
+	}
+	return filepath.Join(idx.filesDir, f.ID, LocalName(f, f.URLPrivate, "")), true
+}
+
+// snippetsChanged returns true when any snippet attached to messages in the
+// file is downloaded or changed after it is indexed.
+func (idx *Indexer) snippetsChanged(f *indexedFile) bool {
+	for path, sum := range f.Snippets {
+		cur, err := hashFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return true
+		}
+		if cur != sum {
+			return true
+		}
+	}
+	return false
+}
+
+// removePostings marks postings of messages in the file to be removed.
+func (idx *Indexer) removePostings(channelNumber int, f *indexedFile) {
+	for _, ts := range f.Messages {
+		idx.removed[indexDoc{channelNumber: channelNumber, ts: ts}] = struct{}{}
+	}
+	for _, key := range f.Keys {
+		idx.touched[key] = struct{}{}
+	}
+}
+
+// output writes "channel" file, "user" file and index files which are
+// changed.
+func (idx *Indexer) output(outDir string) error {
+	channelFilepath := filepath.Join(outDir, "channel")
+	err := idx.writeChannelFile(channelFilepath, idx.channelNumbers)
 	if err != nil {
 		return err
 	}
 
-	f, err := os.Create(path)
+	userFilepath := filepath.Join(outDir, "user")
+	err = idx.writeUserFile(userFilepath, idx.state.Users)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	fw := bufio.NewWriter(f)
-	for channelNumber, mposMap := range mPositions {
-		_, err := fw.Write(vintBytes(channelNumber))
+	keys := make(map[string]struct{}, len(idx.gramIndex)+len(idx.touched))
+	for key := range idx.gramIndex {
+		keys[key] = struct{}{}
+	}
+	for key := range idx.touched {
+		keys[key] = struct{}{}
+	}
+	for key := range keys {
+		path := indexFilePath(outDir, key)
+		mPositions, err := readIndexFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if mPositions == nil {
+			mPositions = messagePositions{}
+		}
+		for channelNumber, mposMap := range mPositions {
+			for pk := range mposMap {
+				if _, ok := idx.removed[indexDoc{channelNumber: channelNumber, ts: pk.ts}]; ok {
+					delete(mposMap, pk)
+				}
+			}
+			if len(mposMap) == 0 {
+				delete(mPositions, channelNumber)
+			}
+		}
+		mPositions.merge(idx.gramIndex[key])
+		if len(mPositions) == 0 {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		err = idx.writeIndexFile(path, mPositions)
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// indexFilePath returns the path of the index file for the key, like
+// "outDir/00/61/00/62.index" for "ab".
+func indexFilePath(outDir, key string) string {
+	s := outDir
+	for _, u := range utf16.Encode([]rune(key)) {
+		s = filepath.Join(s, fmt.Sprintf("%02x", u>>8), fmt.Sprintf("%02x", u&0xff))
+	}
+	return s + ".index"
+}
 
-		_, err = fw.Write(vintBytes(len(mposMap)))
+// removeIndexFiles removes all index files in outDir.
+func removeIndexFiles(outDir string) error {
+	err := filepath.Walk(outDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		// 中断された書き込みの一時ファイルも削除する
+		if !info.IsDir() && (strings.HasSuffix(path, ".index") || strings.Contains(info.Name(), ".index.tmp")) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
 
-		for ts, positions := range mposMap {
-			tsParts := strings.SplitN(ts, ".", 2)
-			if len(tsParts) != 2 {
-				channel := idx.channelNumbers[channelNumber]
-				return fmt.Errorf("Invalid timestamp %s (%s)", ts, channel.ID)
-			}
+func (idx *Indexer) writeChannelFile(path string, channelNumbers map[int]Channel) error {
+	numbers := make([]int, 0, len(channelNumbers))
+	for channelNumber := range channelNumbers {
+		numbers = append(numbers, channelNumber)
+	}
+	sort.Ints(numbers)
 
-			tsSec, err := strconv.Atoi(tsParts[0])
+	return writeFileAtomically(path, func(fw *bufio.Writer) error {
+		for _, channelNumber := range numbers {
+			channel := channelNumbers[channelNumber]
+			_, err := fw.Write([]byte(fmt.Sprintf("%d\t%s\t%s\n", channelNumber, channel.ID, channel.Name)))
 			if err != nil {
 				return err
 			}
-			err = binary.Write(fw, binary.BigEndian, uint32(tsSec))
+		}
+		return nil
+	})
+}
+
+// writeUserFile writes "user" file, which lines are the number, ID, name
+// and display name of users separated by tabs. Names are empty when the user
+// is not in users.json.
+func (idx *Indexer) writeUserFile(path string, userNumbers map[string]int) error {
+	ids := make([]string, 0, len(userNumbers))
+	for id := range userNumbers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return userNumbers[ids[i]] < userNumbers[ids[j]]
+	})
+
+	return writeFileAtomically(path, func(fw *bufio.Writer) error {
+		for _, id := range ids {
+			var name, displayName string
+			if u, ok := idx.s.GetUserByID(id); ok {
+				name = u.Name
+				displayName = idx.s.GetDisplayNameByUserID(id)
+			}
+			_, err := fw.Write([]byte(fmt.Sprintf("%d\t%s\t%s\t%s\n", userNumbers[id], id, tabless(name), tabless(displayName))))
 			if err != nil {
 				return err
 			}
+		}
+		return nil
+	})
+}
+
+// tabless replaces tabs and newlines in s, which separate fields and lines
+// in "channel" and "user" files, with spaces.
+func tabless(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
 
-			tsMicrosec, err := strconv.Atoi(tsParts[1])
+func (idx *Indexer) writeIndexFile(path string, mPositions messagePositions) error {
+	// 差分を小さくするため、チャンネル番号及びタイムスタンプの順に出力する
+	numbers := make([]int, 0, len(mPositions))
+	for channelNumber := range mPositions {
+		numbers = append(numbers, channelNumber)
+	}
+	sort.Ints(numbers)
+
+	return writeFileAtomically(path, func(fw *bufio.Writer) error {
+		_, err := fw.WriteString(indexFileMagic)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(vintBytes(indexFormatVersion))
+		if err != nil {
+			return err
+		}
+		for _, channelNumber := range numbers {
+			mposMap := mPositions[channelNumber]
+			_, err := fw.Write(vintBytes(channelNumber))
 			if err != nil {
 				return err
 			}
-			_, err = fw.Write(vintBytes(tsMicrosec))
+
+			_, err = fw.Write(vintBytes(len(mposMap)))
 			if err != nil {
 				return err
 			}
 
-			if len(positions) == 0 {
-				channel := idx.channelNumbers[channelNumber]
-				return fmt.Errorf("Empty positions: %s: %s: %s", path, channel.ID, ts)
+			pks := make([]postingKey, 0, len(mposMap))
+			for pk := range mposMap {
+				pks = append(pks, pk)
 			}
-			for _, pos := range positions {
-				_, err = fw.Write(vintBytes(pos + 1))
+			sort.Slice(pks, func(i, j int) bool {
+				if pks[i].ts != pks[j].ts {
+					return pks[i].ts < pks[j].ts
+				}
+				if pks[i].field != pks[j].field {
+					return pks[i].field < pks[j].field
+				}
+				return pks[i].user < pks[j].user
+			})
+			for _, pk := range pks {
+				ts := pk.ts
+				positions := mposMap[pk]
+				tsParts := strings.SplitN(ts, ".", 2)
+				if len(tsParts) != 2 {
+					channel := idx.channelNumbers[channelNumber]
+					return fmt.Errorf("Invalid timestamp %s (%s)", ts, channel.ID)
+				}
+
+				tsSec, err := strconv.Atoi(tsParts[0])
+				if err != nil {
+					return err
+				}
+				err = binary.Write(fw, binary.BigEndian, uint32(tsSec))
+				if err != nil {
+					return err
+				}
+
+				tsMicrosec, err := strconv.Atoi(tsParts[1])
+				if err != nil {
+					return err
+				}
+				_, err = fw.Write(vintBytes(tsMicrosec))
+				if err != nil {
+					return err
+				}
+
+				_, err = fw.Write(vintBytes(int(pk.field)))
+				if err != nil {
+					return err
+				}
+
+				_, err = fw.Write(vintBytes(pk.user))
+				if err != nil {
+					return err
+				}
+
+				if len(positions) == 0 {
+					channel := idx.channelNumbers[channelNumber]
+					return fmt.Errorf("Empty positions: %s: %s: %s", path, channel.ID, ts)
+				}
+				for _, pos := range positions {
+					_, err = fw.Write(vintBytes(pos + 1))
+					if err != nil {
+						return err
+					}
+				}
+				err = fw.WriteByte(0)
 				if err != nil {
 					return err
 				}
-			}
-			err = fw.WriteByte(0)
-			if err != nil {
-				return err
 			}
 		}
-	}
 
-	err = fw.Flush()
-	if err != nil {
-		return err
-	}
-
-	return nil
+		return nil
+	})
 }
 
 type messageIndex map[string]messagePositions
 
-func (mi messageIndex) Add(key string, channelNumber int, mes *Message, pos int) {
+func (mi messageIndex) Add(key string, channelNumber int, pk postingKey, pos int) {
 	mp, ok := mi[key]
 	if !ok {
 		mp = messagePositions{}
 		mi[key] = mp
 	}
-	mp.Add(channelNumber, mes, pos)
+	mp.Add(channelNumber, pk, pos)
 }
 
-type messagePositions map[int]map[string][]int
+// postingKey : 索引ファイル中の、メッセージのフィールド毎の出現位置のキー。
+// userはメッセージを投稿したユーザの"user"ファイル中の番号で、投稿者での絞り
+// 込みに用いる。
+type postingKey struct {
+	ts    string
+	field indexField
+	user  int
+}
+
+type messagePositions map[int]map[postingKey][]int
 
-func (mp messagePositions) Add(channelNumber int, mes *Message, pos int) {
+func (mp messagePositions) Add(channelNumber int, pk postingKey, pos int) {
 	mposMap, ok := mp[channelNumber]
 	if !ok {
-		mposMap = map[string][]int{}
+		mposMap = map[postingKey][]int{}
 		mp[channelNumber] = mposMap
 	}
 
-	mposMap[mes.Timestamp] = append(mposMap[mes.Timestamp], pos)
+	mposMap[pk] = append(mposMap[pk], pos)
+}
+
+// merge adds all postings in other.
+func (mp messagePositions) merge(other messagePositions) {
+	for channelNumber, otherMap := range other {
+		mposMap, ok := mp[channelNumber]
+		if !ok {
+			mposMap = map[postingKey][]int{}
+			mp[channelNumber] = mposMap
+		}
+		for pk, positions := range otherMap {
+			mposMap[pk] = append(mposMap[pk], positions...)
+		}
+	}
+}
+
+// readIndexFile reads postings in the index file written by writeIndexFile.
+func readIndexFile(path string) (messagePositions, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, []byte(indexFileMagic)) {
+		return nil, fmt.Errorf("%s: not an index file", path)
+	}
+	r := bytes.NewReader(b[len(indexFileMagic):])
+	version, err := readVInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if version != indexFormatVersion {
+		return nil, fmt.Errorf("%s: unsupported index format version %d", path, version)
+	}
+	mp := messagePositions{}
+	for r.Len() > 0 {
+		channelNumber, err := readVInt(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		count, err := readVInt(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		mposMap, ok := mp[channelNumber]
+		if !ok {
+			mposMap = map[postingKey][]int{}
+			mp[channelNumber] = mposMap
+		}
+		for i := 0; i < count; i++ {
+			var tsSec uint32
+			if err := binary.Read(r, binary.BigEndian, &tsSec); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			tsMicrosec, err := readVInt(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			field, err := readVInt(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			user, err := readVInt(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			pk := postingKey{ts: fmt.Sprintf("%d.%06d", tsSec, tsMicrosec), field: indexField(field), user: user}
+			for {
+				pos, err := readVInt(r)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+				if pos == 0 {
+					break
+				}
+				mposMap[pk] = append(mposMap[pk], pos-1)
+			}
+		}
+	}
+	return mp, nil
+}
+
+// readVInt reads a number written by vintBytes.
+func readVInt(r io.ByteReader) (int, error) {
+	n := 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		n = n<<7 | int(b&0b01111111)
+		if b&0b10000000 == 0 {
+			return n, nil
+		}
+	}
 }
 
 func vintBytes(n int) []byte {
@@ -0,0 +1,274 @@
+package slacklog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readDirFiles reads all files in dir. The key is the relative path.
+func readDirFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = readString(t, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func updateTestIndex(t *testing.T, dataDir, outDir string, full bool) {
+	t.Helper()
+
+	updateTestIndexWithFiles(t, dataDir, "", outDir, full)
+}
+
+func updateTestIndexWithFiles(t *testing.T, dataDir, filesDir, outDir string, full bool) {
+	t.Helper()
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewIndexer(s)
+	idx.SetFilesDir(filesDir)
+	idx.SetFullRebuild(full)
+	idx.SetStatePath(testIndexStatePath(outDir))
+	if err := idx.Update(outDir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testIndexStatePath returns the path of the state for the index in outDir,
+// which is out of outDir.
+func testIndexStatePath(outDir string) string {
+	return outDir + "_state.json"
+}
+
+func TestIndexer_Update_incremental(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	outDir := filepath.Join(tmpPath, "index")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+
+	updateTestIndex(t, dataDir, outDir, false)
+	mp, err := readIndexFile(indexFilePath(outDir, "he"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(messagePositions{1: {
+		{ts: "1580000000.000100", field: fieldText, user: 1}: {0},
+		{ts: "1580000200.000300", field: fieldText, user: 2}: {20},
+	}}, mp); diff != "" {
+		t.Errorf("unexpected postings of \"he\": -want +got\n%s", diff)
+	}
+	wantUsers := "1\tU001\talice\tAlice\n2\tU002\tbob\tbob\n"
+	if got := readString(t, filepath.Join(outDir, "user")); got != wantUsers {
+		t.Errorf("unexpected user file: want %q, got %q", wantUsers, got)
+	}
+
+	// 編集・削除されたメッセージは索引し直される
+	err = ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-02-04.json"), []byte(`[
+ {"type":"message","subtype":"message_changed","hidden":true,"ts":"1580780000.000200","message":{"type":"message","user":"U001","text":"goodbye","ts":"1580000000.000100","thread_ts":"1580000000.000100","edited":{"user":"U001","ts":"1580780000.000000"}}},
+ {"type":"message","subtype":"message_deleted","hidden":true,"deleted_ts":"1580700000.000100","ts":"1580790000.000300"},
+ {"type":"message","user":"U002","text":"hello again","ts":"1580790100.000100"}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateTestIndex(t, dataDir, outDir, false)
+
+	mp, err = readIndexFile(indexFilePath(outDir, "he"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(messagePositions{1: {
+		{ts: "1580000200.000300", field: fieldText, user: 2}: {20},
+		{ts: "1580790100.000100", field: fieldText, user: 2}: {0},
+	}}, mp); diff != "" {
+		t.Errorf("unexpected postings of \"he\": -want +got\n%s", diff)
+	}
+	if _, err := os.Stat(indexFilePath(outDir, "fe")); !os.IsNotExist(err) {
+		t.Errorf("index file of \"fe\" in a deleted message is not removed: %v", err)
+	}
+
+	// 全体を作り直した場合と同じになる
+	fullDir := filepath.Join(tmpPath, "full")
+	updateTestIndex(t, dataDir, fullDir, true)
+	if diff := cmp.Diff(readDirFiles(t, fullDir), readDirFiles(t, outDir)); diff != "" {
+		t.Errorf("incremental index differs from full index: -full +incremental\n%s", diff)
+	}
+
+	if err := os.Remove(filepath.Join(dataDir, "C001", "2020-02-04.json")); err != nil {
+		t.Fatal(err)
+	}
+	updateTestIndex(t, dataDir, outDir, false)
+	updateTestIndex(t, dataDir, fullDir, true)
+	if diff := cmp.Diff(readDirFiles(t, fullDir), readDirFiles(t, outDir)); diff != "" {
+		t.Errorf("incremental index differs from full index after removing a file: -full +incremental\n%s", diff)
+	}
+}
+
+func TestIndexer_Update_interrupted(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	outDir := filepath.Join(tmpPath, "index")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+	// 以前のバージョンが出力先に保存した状態は削除される
+	if err := os.MkdirAll(outDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	legacyPath := filepath.Join(outDir, legacyIndexStateFilename)
+	if err := ioutil.WriteFile(legacyPath, []byte("{}"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	updateTestIndex(t, dataDir, outDir, false)
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Errorf("legacy state in the output dir is not removed: %v", err)
+	}
+	statePath := testIndexStatePath(outDir)
+	state := readString(t, statePath)
+
+	// 索引ファイルを書き出した後、状態を保存する前に中断された場合も、次回の
+	// 更新で投稿は重複しない
+	err := ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-02-04.json"), []byte(`[
+ {"type":"message","user":"U002","text":"hello again","ts":"1580790100.000100"}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateTestIndex(t, dataDir, outDir, false)
+	if err := ioutil.WriteFile(statePath, []byte(state), 0666); err != nil {
+		t.Fatal(err)
+	}
+	updateTestIndex(t, dataDir, outDir, false)
+
+	fullDir := filepath.Join(tmpPath, "full")
+	updateTestIndex(t, dataDir, fullDir, true)
+	if diff := cmp.Diff(readDirFiles(t, fullDir), readDirFiles(t, outDir)); diff != "" {
+		t.Errorf("index after interrupted update differs from full index: -full +incremental\n%s", diff)
+	}
+
+	// 状態と異なる出力先の索引は作り直す
+	otherDir := filepath.Join(tmpPath, "other")
+	copyDir(t, outDir, otherDir)
+	if err := os.Remove(indexFilePath(otherDir, "he")); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewIndexer(s)
+	idx.SetStatePath(statePath)
+	if err := idx.Update(otherDir); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(readDirFiles(t, fullDir), readDirFiles(t, otherDir)); diff != "" {
+		t.Errorf("index in another dir is not rebuilt: -full +other\n%s", diff)
+	}
+}
+
+func TestIndexer_Update_fields(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	filesDir := filepath.Join(tmpPath, "files")
+	outDir := filepath.Join(tmpPath, "index")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+	err := ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-02-04.json"), []byte(`[
+ {"type":"message","user":"U001","text":"see xy","ts":"1580790100.000100",
+  "attachments":[{"title":"xyz title","text":"body","fallback":"body"}],
+  "files":[{"id":"F001","name":"memo.txt","title":"qxy","mimetype":"text/plain","size":10,"url_private":"https://files.slack.com/files-pri/T000-F001/memo.txt"}],
+  "blocks":[{"type":"section","text":{"type":"mrkdwn","text":"axy"}},{"type":"rich_text","elements":[]}]}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updateTestIndexWithFiles(t, dataDir, filesDir, outDir, false)
+	want := messagePositions{1: {
+		{ts: "1580790100.000100", field: fieldText, user: 1}:       {4},
+		{ts: "1580790100.000100", field: fieldAttachment, user: 1}: {0},
+		{ts: "1580790100.000100", field: fieldFile, user: 1}:       {10},
+		{ts: "1580790100.000100", field: fieldBlocks, user: 1}:     {1},
+	}}
+	mp, err := readIndexFile(indexFilePath(outDir, "xy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, mp); diff != "" {
+		t.Errorf("unexpected postings of \"xy\": -want +got\n%s", diff)
+	}
+
+	// ダウンロードされたスニペットは次回の更新で索引される
+	if err := os.MkdirAll(filepath.Join(filesDir, "F001"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(filesDir, "F001", "memo.txt"), []byte("bxy"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	updateTestIndexWithFiles(t, dataDir, filesDir, outDir, false)
+	want[1][postingKey{ts: "1580790100.000100", field: fieldSnippet, user: 1}] = []int{1}
+	mp, err = readIndexFile(indexFilePath(outDir, "xy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, mp); diff != "" {
+		t.Errorf("unexpected postings of \"xy\" with snippet: -want +got\n%s", diff)
+	}
+}
+
+func TestReadIndexFile_version(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+	}{
+		{"no header", []byte{1, 1, 0, 0, 0, 1, 0, 0, 1, 1, 0}},
+		{"newer version", append([]byte(indexFileMagic), indexFormatVersion+1)},
+	} {
+		path := filepath.Join(tmpPath, "test.index")
+		if err := ioutil.WriteFile(path, tc.content, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readIndexFile(path); err == nil {
+			t.Errorf("%s: readIndexFile should fail", tc.name)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package slacklog
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// JSONRenderer : ログデータをJSON形式で出力するRenderer。
+// 他のツールからアーカイブを利用するためのもので、メッセージは変換せずにその
+// まま出力する。
+type JSONRenderer struct{}
+
+var _ Renderer = (*JSONRenderer)(nil)
+
+// NewJSONRenderer creates a JSONRenderer.
+func NewJSONRenderer() *JSONRenderer {
+	return &JSONRenderer{}
+}
+
+type jsonChannel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type jsonMonth struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+}
+
+func newJSONChannel(channel Channel) jsonChannel {
+	return jsonChannel{ID: channel.ID, Name: channel.Name}
+}
+
+func newJSONMonth(key MessageMonthKey) jsonMonth {
+	return jsonMonth{Year: key.year, Month: key.month}
+}
+
+// Name returns "json".
+func (r *JSONRenderer) Name() string {
+	return "json"
+}
+
+// Filename returns "index.json".
+func (r *JSONRenderer) Filename() string {
+	return "index.json"
+}
+
+// Inputs returns nothing.
+func (r *JSONRenderer) Inputs() []string {
+	return nil
+}
+
+// RenderIndex writes a list of channels.
+func (r *JSONRenderer) RenderIndex(path string, channels []Channel) error {
+	SortChannel(channels)
+	list := make([]jsonChannel, 0, len(channels))
+	for _, channel := range channels {
+		list = append(list, newJSONChannel(channel))
+	}
+	return writeJSON(path, map[string]interface{}{
+		"channels": list,
+	})
+}
+
+// RenderChannelIndex writes a list of months in the channel.
+func (r *JSONRenderer) RenderChannelIndex(path string, channel Channel, keys []MessageMonthKey) error {
+	months := make([]jsonMonth, 0, len(keys))
+	for _, key := range keys {
+		months = append(months, newJSONMonth(key))
+	}
+	return writeJSON(path, map[string]interface{}{
+		"channel": newJSONChannel(channel),
+		"months":  months,
+	})
+}
+
+// RenderMonth writes messages in the month.
+func (r *JSONRenderer) RenderMonth(path string, channel Channel, key MessageMonthKey, msgs Messages) error {
+	return writeJSON(path, map[string]interface{}{
+		"channel":  newJSONChannel(channel),
+		"month":    newJSONMonth(key),
+		"messages": msgs,
+	})
+}
+
+// RenderThread writes messages in the thread.
+func (r *JSONRenderer) RenderThread(path string, channel Channel, key MessageMonthKey, root *Message, replies Messages) error {
+	return writeJSON(path, map[string]interface{}{
+		"channel": newJSONChannel(channel),
+		"month":   newJSONMonth(key),
+		"root":    root,
+		"replies": replies,
+	})
+}
+
+// writeJSON writes v as JSON to a file.
+func writeJSON(filename string, v interface{}) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,222 @@
+package slacklog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Kinds of LintProblem.
+const (
+	LintFilename  = "filename"
+	LintJSON      = "json"
+	LintTimestamp = "timestamp"
+	LintDate      = "date"
+	LintDuplicate = "duplicate"
+	LintThread    = "thread"
+	LintUser      = "user"
+	LintFile      = "file"
+)
+
+// maxDownloadFileSize : download-filesがダウンロードする添付ファイルの最大サ
+// イズ。これ以上のファイルは存在しなくても問題としない。
+const maxDownloadFileSize = 104857600
+
+// LintProblem : ログデータに見つかった問題。
+type LintProblem struct {
+	Kind    string `json:"kind"`
+	Channel string `json:"channel,omitempty"`
+	File    string `json:"file,omitempty"`
+	Ts      string `json:"ts,omitempty"`
+	Message string `json:"message"`
+}
+
+// String returns the problem in a human readable form like
+// "C001/2020-01-26.json: 1580000000.000100: [thread] ...".
+func (p LintProblem) String() string {
+	s := ""
+	if p.Channel != "" {
+		s += p.Channel
+		if p.File != "" {
+			s += "/" + p.File
+		}
+		s += ": "
+	}
+	if p.Ts != "" {
+		s += p.Ts + ": "
+	}
+	return s + "[" + p.Kind + "] " + p.Message
+}
+
+// strayFileLister is implemented by logSource which can have files not
+// matching reMsgFilename in the channel.
+type strayFileLister interface {
+	// strayFileNames returns names of files in the channel which are not read
+	// as message files.
+	strayFileNames(channelID string) ([]string, error)
+}
+
+func (src *jsonLogSource) strayFileNames(channelID string) ([]string, error) {
+	names, err := readDirNames(filepath.Join(src.dir, channelID))
+	if err != nil {
+		return nil, err
+	}
+	var stray []string
+	for _, name := range names {
+		if !reMsgFilename.MatchString(name) {
+			stray = append(stray, name)
+		}
+	}
+	return stray, nil
+}
+
+// LintLogData : LogStoreのログデータを検査し、見つかった問題を返す。
+// filesDirはdownload-filesで添付ファイルをダウンロードしたディレクトリで、
+// 空の場合は添付ファイルの存在を検査しない。
+// 問題はチャンネル毎にファイル順に並ぶ。
+func LintLogData(s *LogStore, filesDir string) ([]LintProblem, error) {
+	l := &linter{
+		s:        s,
+		filesDir: filesDir,
+		users:    map[string]struct{}{},
+		files:    map[string]struct{}{},
+	}
+	for _, ch := range s.GetChannels() {
+		if err := l.lintChannel(ch.ID); err != nil {
+			return nil, err
+		}
+	}
+	return l.problems, nil
+}
+
+type linter struct {
+	s        *LogStore
+	filesDir string
+	problems []LintProblem
+	// users and files are IDs already reported, to report them once.
+	users map[string]struct{}
+	files map[string]struct{}
+}
+
+func (l *linter) report(kind, channelID, file, ts, format string, a ...interface{}) {
+	l.problems = append(l.problems, LintProblem{
+		Kind:    kind,
+		Channel: channelID,
+		File:    file,
+		Ts:      ts,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) lintChannel(channelID string) error {
+	src := l.s.src
+	if sl, ok := src.(strayFileLister); ok {
+		names, err := sl.strayFileNames(channelID)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, name := range names {
+			l.report(LintFilename, channelID, name, "", "file name is not {year}-{month}-{day}.json, it is not read")
+		}
+	}
+	names, err := src.logFileNames(channelID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// key: ts, value: name of the file which has the message
+	seen := map[string]string{}
+	// key: ts of the root, value: a reply
+	replies := map[string]*Message{}
+	replyFiles := map[string]string{}
+	for _, name := range names {
+		date, err := time.Parse("2006-01-02.json", name)
+		if err != nil {
+			l.report(LintFilename, channelID, name, "", "invalid date in file name: %s", err)
+		}
+		msgs, _, err := src.readLogFile(channelID, name)
+		if err != nil {
+			l.report(LintJSON, channelID, name, "", "%s", err)
+			continue
+		}
+		for _, msg := range msgs {
+			ts := msg.Timestamp
+			t, err := parseTimestamp(ts, l.s.Location())
+			if err != nil {
+				l.report(LintTimestamp, channelID, name, ts, "%s", err)
+			} else if !date.IsZero() && t.Format("2006-01-02") != date.Format("2006-01-02") {
+				l.report(LintDate, channelID, name, ts, "the message is posted on %s", t.Format("2006-01-02"))
+			}
+			if prev, ok := seen[ts]; ok {
+				l.report(LintDuplicate, channelID, name, ts, "the timestamp is also in %s", prev)
+			} else {
+				seen[ts] = name
+			}
+			if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != ts {
+				if _, ok := replies[msg.ThreadTimestamp]; !ok {
+					replies[msg.ThreadTimestamp] = msg
+					replyFiles[msg.ThreadTimestamp] = name
+				}
+			}
+			l.lintUsers(channelID, name, msg)
+			l.lintFiles(channelID, name, msg)
+		}
+	}
+
+	roots := make([]string, 0, len(replies))
+	for root := range replies {
+		if _, ok := seen[root]; !ok {
+			roots = append(roots, root)
+		}
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		l.report(LintThread, channelID, replyFiles[root], replies[root].Timestamp, "the root message %s of the thread is not found", root)
+	}
+	return nil
+}
+
+// lintUsers reports users and bots which post the message but are not in
+// users.json.
+func (l *linter) lintUsers(channelID, name string, msg *Message) {
+	for _, id := range []string{msg.User, msg.BotID} {
+		if id == "" {
+			continue
+		}
+		if _, ok := l.s.GetUserByID(id); ok {
+			continue
+		}
+		if _, ok := l.users[id]; ok {
+			continue
+		}
+		l.users[id] = struct{}{}
+		l.report(LintUser, channelID, name, msg.Timestamp, "user %s is not found in users.json", id)
+	}
+}
+
+// lintFiles reports attached files which are not downloaded in filesDir.
+// Files which download-files doesn't download are ignored.
+func (l *linter) lintFiles(channelID, name string, msg *Message) {
+	if l.filesDir == "" {
+		return
+	}
+	for _, f := range msg.Files {
+		if !HostBySlack(f) || f.Size >= maxDownloadFileSize {
+			continue
+		}
+		if _, ok := l.files[f.ID]; ok {
+			continue
+		}
+		path := filepath.Join(l.filesDir, f.ID, LocalName(f, f.URLPrivate, ""))
+		if fileExists(path) {
+			continue
+		}
+		l.files[f.ID] = struct{}{}
+		l.report(LintFile, channelID, name, msg.Timestamp, "file %s is not found: %s", f.ID, path)
+	}
+}
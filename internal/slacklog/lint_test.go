@@ -0,0 +1,78 @@
+package slacklog
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLintLogData(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	filesDir := filepath.Join(tmpPath, "files")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := LintLogData(s, filesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems in testdata: %v", problems)
+	}
+
+	for name, content := range map[string]string{
+		"2020-02-10.json": `[
+ {"type":"message","user":"U001","text":"wrong date","ts":"1580000000.000900"},
+ {"type":"message","user":"U003","text":"unknown user","ts":"1581300000.000100"},
+ {"type":"message","user":"U002","text":"dup","ts":"1580700000.000100"},
+ {"type":"message","user":"U002","text":"orphan","ts":"1581300100.000100","thread_ts":"1581000000.000100"},
+ {"type":"message","user":"U002","text":"bad ts","ts":"1581300200"},
+ {"type":"message","user":"U001","text":"file","ts":"1581300300.000100","files":[{"id":"F001","name":"a.txt","url_private":"https://files.slack.com/files-pri/T000-F001/a.txt"}]}
+]`,
+		"2020-02-11.json": `[{"type":"message",`,
+		"notes.txt":       `memo`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dataDir, "C001", name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err = NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err = LintLogData(s, filesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][3]string
+	for _, p := range problems {
+		got = append(got, [3]string{p.Kind, p.File, p.Ts})
+	}
+	want := [][3]string{
+		{LintFilename, "notes.txt", ""},
+		{LintDate, "2020-02-10.json", "1580000000.000900"},
+		{LintUser, "2020-02-10.json", "1581300000.000100"},
+		{LintDate, "2020-02-10.json", "1580700000.000100"},
+		{LintDuplicate, "2020-02-10.json", "1580700000.000100"},
+		{LintTimestamp, "2020-02-10.json", "1581300200"},
+		{LintFile, "2020-02-10.json", "1581300300.000100"},
+		{LintJSON, "2020-02-11.json", ""},
+		{LintThread, "2020-02-10.json", "1581300100.000100"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected problems: -want +got\n%s", diff)
+	}
+}
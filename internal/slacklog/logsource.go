@@ -0,0 +1,90 @@
+package slacklog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// logSource : LogStoreがメッセージを読み込む元。メッセージファイルは
+// slacklog_dataと同様にチャンネル毎・日毎の単位で扱う。
+type logSource interface {
+	// logFileNames returns names of message files of the channel, in date
+	// order.
+	logFileNames(channelID string) ([]string, error)
+	// readLogFile reads all messages in the message file of the channel. It
+	// also returns the size of the file, which is used to estimate memory
+	// usage.
+	readLogFile(channelID, name string) (Messages, int64, error)
+	// logFileHashes returns hashes of contents of message files of the
+	// channel. The key is the name of the file.
+	logFileHashes(channelID string) (map[string]string, error)
+	// metadataHashes returns hashes of data which are shared by all
+	// channels: users, user groups, channels and emojis.
+	metadataHashes() ([]sourceHash, error)
+}
+
+// sourceHash is a hash of named data in logSource.
+type sourceHash struct {
+	name string
+	hash string
+}
+
+// jsonLogSource reads JSON files in slacklog_data directory.
+type jsonLogSource struct {
+	dir string
+	// emojiPath is path of JSON file for EmojiTable.
+	emojiPath string
+}
+
+func (src *jsonLogSource) logFileNames(channelID string) ([]string, error) {
+	return LogFileNames(filepath.Join(src.dir, channelID))
+}
+
+func (src *jsonLogSource) readLogFile(channelID, name string) (Messages, int64, error) {
+	path := filepath.Join(src.dir, channelID, name)
+	var msgs Messages
+	if err := ReadFileAsJSON(path, true, &msgs); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		size = fi.Size()
+	}
+	return msgs, size, nil
+}
+
+func (src *jsonLogSource) logFileHashes(channelID string) (map[string]string, error) {
+	names, err := src.logFileNames(channelID)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(names))
+	for _, name := range names {
+		sum, err := hashFile(filepath.Join(src.dir, channelID, name))
+		if err != nil {
+			return nil, err
+		}
+		hashes[name] = sum
+	}
+	return hashes, nil
+}
+
+func (src *jsonLogSource) metadataHashes() ([]sourceHash, error) {
+	paths := []string{
+		filepath.Join(src.dir, "users.json"),
+		filepath.Join(src.dir, "usergroups.json"),
+	}
+	paths = append(paths, conversationPaths(src.dir)...)
+	paths = append(paths, src.emojiPath)
+	hashes := make([]sourceHash, 0, len(paths))
+	for _, path := range paths {
+		// 存在しないファイルは空として扱う
+		sum, err := hashFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		hashes = append(hashes, sourceHash{name: path, hash: sum})
+	}
+	return hashes, nil
+}
@@ -0,0 +1,195 @@
+package slacklog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// manifestFilename : HTMLGenerator.Generate()が出力先ディレクトリに保存するマ
+// ニフェストのファイル名。
+const manifestFilename = ".slacklog_manifest.json"
+
+// manifestVersion : マニフェストの形式、もしくは生成するページの構造を変えた場
+// 合はこの値を増やす。値が異なるマニフェストは無視され、全てのページが再生成さ
+// れる。
+const manifestVersion = 8
+
+// Manifest : 前回の生成時に用いた入力のハッシュ値を保持する。
+// HTMLGeneratorは今回の入力とManifestを比較し、入力に変更のあったページのみを
+// 再生成する。
+type Manifest struct {
+	Version int `json:"version"`
+	// GlobalHash は全てのページに影響する入力(テンプレート、設定、ユーザ・チャ
+	// ンネル・絵文字データ)から計算したハッシュ値。
+	GlobalHash string `json:"global_hash"`
+	// key: channel ID
+	Channels map[string]*ChannelManifest `json:"channels"`
+}
+
+// ChannelManifest : チャンネル毎のメッセージファイルのハッシュ値を保持する。
+type ChannelManifest struct {
+	// key: file name ("{year}-{month}-{day}.json")
+	// value: hash of the file
+	Files map[string]string `json:"files"`
+	// key: month ("{year}-{month}")
+	// value: timestamps of threads which have messages in the month
+	Threads map[string][]string `json:"threads,omitempty"`
+}
+
+// NewManifest creates an empty Manifest.
+func NewManifest() *Manifest {
+	return &Manifest{
+		Version:  manifestVersion,
+		Channels: map[string]*ChannelManifest{},
+	}
+}
+
+// ReadManifest : pathに指定したマニフェストを読み込む。
+// ファイルが存在しない場合や形式が古い場合は空のManifestを返す。
+func ReadManifest(path string) (*Manifest, error) {
+	var m Manifest
+	err := ReadFileAsJSON(path, true, &m)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewManifest(), nil
+		}
+		return nil, err
+	}
+	if m.Version != manifestVersion || m.Channels == nil {
+		return NewManifest(), nil
+	}
+	return &m, nil
+}
+
+// Write writes the manifest to path.
+func (m *Manifest) Write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// SameFiles checks both manifests have same channels and same files.
+func (m *Manifest) SameFiles(other *Manifest) bool {
+	if len(m.Channels) != len(other.Channels) {
+		return false
+	}
+	for id, cm := range m.Channels {
+		ocm, ok := other.Channels[id]
+		if !ok || len(cm.Files) != len(ocm.Files) {
+			return false
+		}
+		for name, sum := range cm.Files {
+			if ocm.Files[name] != sum {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Months returns a set of MessageMonthKey for the files in the manifest.
+func (cm *ChannelManifest) Months() map[MessageMonthKey]struct{} {
+	months := map[MessageMonthKey]struct{}{}
+	if cm == nil {
+		return months
+	}
+	for name := range cm.Files {
+		if key, ok := logFileMonthKey(name); ok {
+			months[key] = struct{}{}
+		}
+	}
+	return months
+}
+
+// monthName returns a key of ChannelManifest.Threads for the month.
+func monthName(key MessageMonthKey) string {
+	return key.Year() + "-" + key.Month()
+}
+
+// hashFile returns SHA-256 hash of the file as hex string.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashBytes returns SHA-256 hash of b as hex string, same as hashFile.
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// inputHasher calculates a hash value from multiple inputs.
+type inputHasher struct {
+	h hash.Hash
+}
+
+func newInputHasher() *inputHasher {
+	return &inputHasher{h: sha256.New()}
+}
+
+// addString adds a named string value to the hash.
+func (ih *inputHasher) addString(name, value string) {
+	io.WriteString(ih.h, name)
+	ih.h.Write([]byte{0})
+	io.WriteString(ih.h, value)
+	ih.h.Write([]byte{0})
+}
+
+// addFile adds contents of the file to the hash. A file which doesn't exist
+// is treated as empty.
+func (ih *inputHasher) addFile(path string) error {
+	sum, err := hashFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ih.addString(path, sum)
+	return nil
+}
+
+// addPath adds contents of the file or all files under the directory to the
+// hash.
+func (ih *inputHasher) addPath(root string) error {
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := ih.addFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ih *inputHasher) sum() string {
+	return hex.EncodeToString(ih.h.Sum(nil))
+}
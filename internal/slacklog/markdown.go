@@ -0,0 +1,90 @@
+package slacklog
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MarkdownExporter : ログデータをチャンネル・月毎のMarkdownファイルとして出力
+// する。
+// スレッドの返信は先頭メッセージの直後に引用として出力する。
+type MarkdownExporter struct {
+	s *LogStore
+	c *TextConverter
+	// baseURL is root path for public site, configured by `BASEURL` environment variable.
+	baseURL string
+}
+
+// NewMarkdownExporter creates a MarkdownExporter.
+func NewMarkdownExporter(s *LogStore) *MarkdownExporter {
+	return &MarkdownExporter{
+		s:       s,
+		c:       newStoreTextConverter(s),
+		baseURL: os.Getenv("BASEURL"),
+	}
+}
+
+// Export はoutDirにログデータをMarkdownに変換した結果を出力する。
+// 出力するファイルは outDir/${channel_name}/${YYYY}-${MM}.md となる。
+func (e *MarkdownExporter) Export(outDir string) error {
+	for _, channel := range e.s.GetChannels() {
+		dir := filepath.Join(outDir, channel.Name)
+		err := e.s.EachMonth(channel.ID, func(key MessageMonthKey, msgs Messages) error {
+			if err := os.MkdirAll(dir, 0777); err != nil {
+				return fmt.Errorf("could not create %s directory: %w", dir, err)
+			}
+			path := filepath.Join(dir, key.Year()+"-"+key.Month()+".md")
+			return e.exportMonth(path, channel, key, msgs)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *MarkdownExporter) exportMonth(path string, channel Channel, key MessageMonthKey, msgs Messages) error {
+	return writeLines(path, func(w *bufio.Writer) {
+		fmt.Fprintf(w, "# %s %s\n", channel.DisplayName(), e.s.locale.formatMonth(key))
+		for _, msg := range msgs {
+			if !msg.isVisible() {
+				continue
+			}
+			w.WriteString("\n")
+			e.writeMessage(w, channel, key, msg, "")
+			thread, ok := e.s.GetThread(channel.ID, msg.Timestamp)
+			if !ok || !msg.IsRootOfThread() {
+				continue
+			}
+			sep := "\n"
+			for _, reply := range thread.Replies() {
+				if !reply.isVisible() {
+					continue
+				}
+				w.WriteString(sep)
+				sep = ">\n"
+				e.writeMessage(w, channel, key, reply, "> ")
+			}
+		}
+	})
+}
+
+// writeMessage writes a message as a Markdown block, each line is prefixed
+// by quote.
+func (e *MarkdownExporter) writeMessage(w *bufio.Writer, channel Channel, key MessageMonthKey, msg *Message, quote string) {
+	name := msg.Username
+	if name == "" {
+		name = e.s.GetDisplayNameByUserID(msg.User)
+	}
+	t := e.s.tsToDateTime(msg.Timestamp).Format("2006-01-02 15:04:05")
+	url := fmt.Sprintf("%s/%s/%s/%s/#ts-%s", e.baseURL, channel.ID, key.Year(), key.Month(), msg.Timestamp)
+	fmt.Fprintf(w, "%s**%s** [%s](%s)\n", quote, html.EscapeString(name), t, url)
+	fmt.Fprintf(w, "%s\n", strings.TrimRight(quote, " "))
+	for _, line := range strings.Split(e.c.ToMarkdown(msg.Text), "\n") {
+		fmt.Fprintf(w, "%s\n", strings.TrimRight(quote+line, " "))
+	}
+}
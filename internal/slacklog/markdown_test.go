@@ -0,0 +1,68 @@
+package slacklog
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextConverter_ToMarkdown(t *testing.T) {
+	c := NewTextConverter(map[string]string{"U001": "alice"}, map[string]string{"party": ".gif"})
+	c.baseURL = "https://example.org"
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"line1\nline2", "line1\\\nline2"},
+		{"<https://vim-jp.org/>", "<https://vim-jp.org/>"},
+		{"<https://vim-jp.org/|vim-jp>", "[vim-jp](https://vim-jp.org/)"},
+		{"`a ~b~ <c>`", "`a ~b~ <c>`"},
+		{"~del~", "~~del~~"},
+		{"<@U001> <@U999>", "[@alice](https://example.org/users/U001/) &lt;@U999&gt;"},
+		{"<#C001|general>", "[#general](https://example.org/C001/)"},
+		{":party: :smile: :unknown:", "![:party:](https://example.org/emojis/party.gif) 😄 :unknown:"},
+		{"a &lt;b&gt; &amp; c", "a &lt;b&gt; &amp; c"},
+		{"see\n```\nif a < b {\n}\n```\ndone", "see\n\n```\nif a < b {\n}\n```\n\ndone"},
+		{"*bold* _italic_ 2*3*4", "**bold** _italic_ 2\\*3\\*4"},
+		{"&gt; quoted\n&gt; *lines*\nafter", "> quoted\\\n> **lines**\n\nafter"},
+		{"• a\n    ◦ b\n• c", "- a\n  - b\n- c"},
+		{"1. a\n2. b", "1. a\n2. b"},
+		{"```~x~```", "```\n~x~\n```"},
+		{"<!date^1392734382^{date_short}^https://example.com/a(1)|Feb 18>", "[2014/02/18](https://example.com/a%281%29)"},
+		{"<!date^1392734382^{date_short}^javascript:alert(1)|Feb 18>", "2014/02/18"},
+	} {
+		if got := c.ToMarkdown(tc.in); got != tc.want {
+			t.Errorf("ToMarkdown(%q) mismatch:\nwant: %q\n got: %q", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestMarkdownExporter_Export(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	g := newTestGenerator(t, "testdata/generator/slacklog_data")
+	if err := NewMarkdownExporter(g.s).Export(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	month := readString(t, filepath.Join(tmpPath, "general", "2020-01.md"))
+	for _, want := range []string{
+		"# #general 2020年01月\n",
+		"**Alice** [2020-01-26 09:53:20](/C001/2020/01/#ts-1580000000.000100)\n",
+		// replies are quoted, including one posted in the next month.
+		"\n> **bob** [2020-01-26 09:55:00](/C001/2020/01/#ts-1580000100.000200)\n",
+		"> ```\n",
+		"\n> late reply\n",
+	} {
+		if !strings.Contains(month, want) {
+			t.Errorf("markdown doesn't contain %q:\n%s", want, month)
+		}
+	}
+	if !fileExists(filepath.Join(tmpPath, "general", "2020-02.md")) {
+		t.Error("markdown for 2020-02 is not exported")
+	}
+}
@@ -1,6 +1,7 @@
 package slacklog
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -49,6 +50,15 @@ type MessageTable struct {
 	MsgsMap   MessagesMap
 	// key: file path
 	loadedFiles map[string]struct{}
+	// byTs has all added messages including replies in threads, to apply
+	// events. key: timestamp
+	byTs map[string]*Message
+	// events are message_changed and message_deleted events which messages
+	// are not found in the table.
+	events Messages
+	// channelEvents are messages which change the channel, like topic. See
+	// Message.isChannelEvent.
+	channelEvents Messages
 }
 
 // NewMessageTable : MessageTableを生成する。
@@ -61,6 +71,7 @@ func NewMessageTable() *MessageTable {
 		ThreadMap:     map[string]*Thread{},
 		MsgsMap:       MessagesMap{},
 		loadedFiles:   map[string]struct{}{},
+		byTs:          map[string]*Message{},
 	}
 }
 
@@ -70,18 +81,10 @@ func NewMessageTable() *MessageTable {
 // デフォルトでは特定のサブタイプを持つメッセージのみをmsgMapに登録するが、
 // readAllMessages が true である場合はすべてのメッセージを登録する。
 func (m *MessageTable) ReadLogDir(path string, readAllMessages bool) error {
-	dir, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer dir.Close()
-	names, err := dir.Readdirnames(0)
+	names, err := readDirNames(path)
 	if err != nil {
 		return err
 	}
-	// ReadLogFile()は日付順に処理する必要があり、そのためにファイル名でソート
-	// している
-	sort.Strings(names)
 	for _, name := range names {
 		if err := m.ReadLogFile(filepath.Join(path, name), readAllMessages); err != nil {
 			return err
@@ -90,9 +93,57 @@ func (m *MessageTable) ReadLogDir(path string, readAllMessages bool) error {
 	return nil
 }
 
+// readDirNames : pathに指定したディレクトリに存在するファイル名を返す。
+// ReadLogFile()は日付順に処理する必要があり、そのためにファイル名でソートして
+// いる。
+func readDirNames(path string) ([]string, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // "{year}-{month}-{day}.json"
 var reMsgFilename = regexp.MustCompile(`^(\d{4})-(\d{2})-\d{2}\.json$`)
 
+// LogFileNames : pathに指定したディレクトリに存在するメッセージデータのファイ
+// ル名を日付順に返す。
+// ReadLogDir()が読み込むファイルのうち、ファイル名が"{year}-{month}-{day}.json"
+// の形式であるもののみを返す。
+func LogFileNames(path string) ([]string, error) {
+	names, err := readDirNames(path)
+	if err != nil {
+		return nil, err
+	}
+	var logNames []string
+	for _, name := range names {
+		if reMsgFilename.MatchString(name) {
+			logNames = append(logNames, name)
+		}
+	}
+	return logNames, nil
+}
+
+// logFileMonthKey returns MessageMonthKey for a log file name.
+func logFileMonthKey(name string) (MessageMonthKey, bool) {
+	match := reMsgFilename.FindStringSubmatch(name)
+	if len(match) == 0 {
+		return MessageMonthKey{}, false
+	}
+	key, err := NewMessageMonthKey(match[1], match[2])
+	if err != nil {
+		return MessageMonthKey{}, false
+	}
+	return key, true
+}
+
 // ReadLogFile : pathに指定したJSON形式のメッセージデータを読み込む。
 // すでにそのファイルが読み込み済みの場合は処理をスキップする。
 // readAllMessagesがfalseである場合は特定のサブタイプを持つメッセージのみをmsgMapに登録する。
@@ -117,12 +168,35 @@ func (m *MessageTable) ReadLogFile(path string, readAllMessages bool) error {
 		return fmt.Errorf("failed to unmarshal %s: %w", path, err)
 	}
 
+	key, err := NewMessageMonthKey(match[1], match[2])
+	if err != nil {
+		return err
+	}
+	m.addMessages(key, msgs, readAllMessages)
+
+	// loaded marker
+	m.loadedFiles[path] = struct{}{}
+	return nil
+}
+
+// addMessages adds messages in a message file of the month.
+// readAllMessagesがfalseである場合は特定のサブタイプを持つメッセージのみをmsgMapに登録する。
+// message_changed及びmessage_deletedは、既に追加されたメッセージに投稿された順
+// に適用する。
+func (m *MessageTable) addMessages(key MessageMonthKey, msgs Messages, readAllMessages bool) {
 	// assort messages, visible and threaded.
-	var visibleMsgs Messages
+	var visibleMsgs, events Messages
 	for _, msg := range msgs {
+		if msg.isEvent() {
+			events = append(events, msg)
+		}
+		if msg.isChannelEvent() {
+			m.channelEvents = append(m.channelEvents, msg)
+		}
 		if !readAllMessages && !msg.isVisible() {
 			continue
 		}
+		m.byTs[msg.Timestamp] = msg
 
 		// スレッドに所属してるメッセージは ThreadMap へスレッド毎に分別しておく
 		threadTs := msg.ThreadTimestamp
@@ -147,14 +221,17 @@ func (m *MessageTable) ReadLogFile(path string, readAllMessages bool) error {
 		visibleMsgs = append(visibleMsgs, msg)
 	}
 
-	key, err := NewMessageMonthKey(match[1], match[2])
-	if err != nil {
-		return err
-	}
 	if len(visibleMsgs) != 0 {
 		m.MsgsMap[key] = append(m.MsgsMap[key], visibleMsgs...)
 	}
 
+	events.Sort()
+	for _, ev := range events {
+		if !m.applyEvent(ev) {
+			m.events = append(m.events, ev)
+		}
+	}
+
 	for _, msgs := range m.MsgsMap {
 		msgs.Sort()
 		var lastUser string
@@ -170,10 +247,24 @@ func (m *MessageTable) ReadLogFile(path string, readAllMessages bool) error {
 	for _, thread := range m.ThreadMap {
 		thread.replies.Sort()
 	}
+}
 
-	// loaded marker
-	m.loadedFiles[path] = struct{}{}
-	return nil
+// applyEvent applies a message_changed or message_deleted event to the
+// message in the table. It returns false when the message is not found.
+func (m *MessageTable) applyEvent(ev *Message) bool {
+	target, ok := m.byTs[ev.targetTimestamp()]
+	if !ok {
+		return false
+	}
+	target.apply(ev)
+	return true
+}
+
+// applyEvents applies events which are found in other tables.
+func (m *MessageTable) applyEvents(events Messages) {
+	for _, ev := range events {
+		m.applyEvent(ev)
+	}
 }
 
 // MessageMonthKey is a key for messages.
@@ -260,6 +351,22 @@ func (k MessageMonthKey) PrevMonth() string {
 type Message struct {
 	slack.Message
 
+	// Blocks holds "blocks" as is, instead of slack.Message.Blocks which
+	// can't keep contents of rich_text blocks. See Block.
+	Blocks json.RawMessage `json:"blocks,omitempty"`
+
+	// SubMessage is the new version of the message in message_changed event.
+	// It shadows slack.Message.SubMessage to keep "blocks" as is.
+	SubMessage *Message `json:"message,omitempty"`
+
+	// History holds previous versions of the edited message, older first,
+	// which are replayed from message_changed events.
+	History Messages `json:"-"`
+
+	// Deleted shows the message is deleted by message_deleted event, or
+	// changed to a tombstone. Contents of the message are removed.
+	Deleted bool `json:"-"`
+
 	// Trail shows the user of message is same as the previous one.
 	// FIXME: 本来はココに書いてはいけない
 	Trail bool `json:"-"`
@@ -274,6 +381,77 @@ func (m *Message) isVisible() bool {
 		m.SubType == "thread_broadcast"
 }
 
+// channelEventSubtypes are subtypes of messages which change the channel.
+// "group_" ones are for private channels.
+var channelEventSubtypes = map[string]struct{}{
+	"channel_topic":     {},
+	"channel_purpose":   {},
+	"channel_name":      {},
+	"channel_archive":   {},
+	"channel_unarchive": {},
+	"group_topic":       {},
+	"group_purpose":     {},
+	"group_name":        {},
+	"group_archive":     {},
+	"group_unarchive":   {},
+}
+
+// isChannelEvent returns true when the message changes topic, purpose or
+// name of the channel, or archives the channel.
+func (m *Message) isChannelEvent() bool {
+	_, ok := channelEventSubtypes[m.SubType]
+	return ok
+}
+
+// isEvent returns true when the message is message_changed or
+// message_deleted event, which changes another message.
+func (m *Message) isEvent() bool {
+	return (m.SubType == "message_changed" && m.SubMessage != nil) ||
+		(m.SubType == "message_deleted" && m.DeletedTimestamp != "")
+}
+
+// targetTimestamp returns the timestamp of the message which is changed by
+// the event.
+func (m *Message) targetTimestamp() string {
+	if m.SubType == "message_deleted" {
+		return m.DeletedTimestamp
+	}
+	return m.SubMessage.Timestamp
+}
+
+// apply applies a message_changed or message_deleted event: updates contents
+// of the message keeping the previous version in History, or removes them.
+func (m *Message) apply(ev *Message) {
+	if ev.SubType == "message_deleted" || ev.SubMessage.SubType == "tombstone" {
+		m.Deleted = true
+		m.Text = ""
+		m.Blocks = nil
+		m.Attachments = nil
+		m.Files = nil
+		m.History = nil
+		return
+	}
+	prev := &Message{}
+	prev.Timestamp = m.Timestamp
+	prev.User = m.User
+	prev.Text = m.Text
+	prev.Blocks = m.Blocks
+	prev.Attachments = m.Attachments
+	prev.Files = m.Files
+	prev.Edited = m.Edited
+	m.History = append(m.History, prev)
+
+	sub := ev.SubMessage
+	m.Text = sub.Text
+	m.Blocks = sub.Blocks
+	m.Attachments = sub.Attachments
+	m.Files = sub.Files
+	m.Edited = sub.Edited
+	if m.Edited == nil {
+		m.Edited = &slack.Edited{Timestamp: ev.Timestamp}
+	}
+}
+
 // isBotMessage : メッセージがBotからの物かを判定する。
 func (m *Message) isBotMessage() bool {
 	return m.SubType == "bot_message" ||
@@ -0,0 +1,122 @@
+package slacklog
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultMemoryLimitMB : Config.MemoryLimitMB が指定されていない場合の、読み込
+// んだメッセージを保持するメモリの上限(MB)。
+const defaultMemoryLimitMB = 512
+
+// jsonMemoryRatio : メッセージのJSONファイルを読み込んだ際のメモリ使用量の、
+// ファイルサイズに対するおおよその比率。キャッシュのサイズの見積りに用いる。
+const jsonMemoryRatio = 3
+
+type monthCacheKey struct {
+	channelID string
+	month     MessageMonthKey
+}
+
+type monthCacheEntry struct {
+	key  monthCacheKey
+	mt   *MessageTable
+	size int64
+}
+
+// monthCache : チャンネル・月毎に読み込んだMessageTableを保持する。
+// 保持しているMessageTableの推定サイズの合計がlimitを超えた場合は、最も長い間
+// 使われていないものから破棄する。
+type monthCache struct {
+	mu    sync.Mutex
+	limit int64
+	size  int64
+	// lru has *monthCacheEntry, the front is the most recently used.
+	lru     *list.List
+	entries map[monthCacheKey]*list.Element
+}
+
+func newMonthCache(limit int64) *monthCache {
+	return &monthCache{
+		limit:   limit,
+		lru:     list.New(),
+		entries: map[monthCacheKey]*list.Element{},
+	}
+}
+
+// get returns a cached MessageTable, and marks it as recently used.
+func (c *monthCache) get(key monthCacheKey) (*MessageTable, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*monthCacheEntry).mt, true
+}
+
+// put adds a MessageTable which estimated size is size, and evicts least
+// recently used ones to keep the limit. The last added one is never evicted,
+// even if it exceeds the limit by itself.
+func (c *monthCache) put(key monthCacheKey, mt *MessageTable, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// 並行して読み込まれた場合は先に登録されたものを置き換える
+		c.size -= e.Value.(*monthCacheEntry).size
+		c.lru.Remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&monthCacheEntry{key: key, mt: mt, size: size})
+	c.size += size
+	for c.size > c.limit && c.lru.Len() > 1 {
+		e := c.lru.Back()
+		entry := e.Value.(*monthCacheEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+	}
+}
+
+// removeChannel removes all MessageTables of the channel.
+func (c *monthCache) removeChannel(channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if key.channelID != channelID {
+			continue
+		}
+		c.size -= e.Value.(*monthCacheEntry).size
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// len returns the number of cached MessageTables.
+func (c *monthCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// channelLog : チャンネルのメッセージファイルの一覧と、月及びスレッドの索引を
+// 保持する。メッセージ自体はmonthCacheに保持し、必要になった時に読み込む。
+type channelLog struct {
+	mu sync.Mutex
+	// files are names of message files for each month, nil until listed.
+	files map[MessageMonthKey][]string
+	// indexed is true when months and threads are indexed.
+	indexed bool
+	// months are months which have visible messages, in ascending order.
+	months   []MessageMonthKey
+	monthSet map[MessageMonthKey]struct{}
+	// key: thread timestamp
+	// value: months which have the root message or replies of the thread
+	threads map[string][]MessageMonthKey
+	// events are message_changed and message_deleted events, which are in
+	// other months than the messages they change.
+	// key: timestamp of the changed message
+	events map[string]Messages
+	// history has messages which change the channel, in ascending order.
+	history Messages
+}
@@ -0,0 +1,451 @@
+package slacklog
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mrkdwnKind : mrkdwnNodeの種類。
+type mrkdwnKind int
+
+const (
+	// mrkdwnText is a plain text in Text.
+	mrkdwnText mrkdwnKind = iota
+	// mrkdwnLineBreak is a line break between lines of a paragraph.
+	mrkdwnLineBreak
+	// mrkdwnBold is `*bold*`, its contents are in Children.
+	mrkdwnBold
+	// mrkdwnItalic is `_italic_`, its contents are in Children.
+	mrkdwnItalic
+	// mrkdwnStrike is `~strike~`, its contents are in Children.
+	mrkdwnStrike
+	// mrkdwnCode is an inline code in Text.
+	mrkdwnCode
+	// mrkdwnPreformatted is a code block in Text.
+	mrkdwnPreformatted
+	// mrkdwnQuote is a block quote, its contents are in Children.
+	mrkdwnQuote
+	// mrkdwnList is a bullet or an ordered list, its items are in Children.
+	mrkdwnList
+	// mrkdwnListItem is an item of a list, its contents and nested lists are
+	// in Children.
+	mrkdwnListItem
+	// mrkdwnLink is `<URL|label>`. Children is empty when it has no label.
+	mrkdwnLink
+	// mrkdwnUser is `<@ID>` or `<@ID|label>`, a mention to a user.
+	mrkdwnUser
+	// mrkdwnChannel is `<#ID|name>` or `<#ID>`, a link to a channel.
+	mrkdwnChannel
+	// mrkdwnEmoji is `:name:`, Text includes colons.
+	mrkdwnEmoji
+	// mrkdwnBroadcast is `<!here>`, `<!channel>` or `<!everyone>`, Text is
+	// "here", "channel" or "everyone".
+	mrkdwnBroadcast
+	// mrkdwnUserGroup is `<!subteam^ID>` or `<!subteam^ID|@handle>`, a mention
+	// to a user group.
+	mrkdwnUserGroup
+	// mrkdwnDate is `<!date^timestamp^format|fallback>` or
+	// `<!date^timestamp^format^link|fallback>`. URL is the timestamp, Text is
+	// the format, Link is the optional link and Raw is the fallback text.
+	mrkdwnDate
+)
+
+// mrkdwnNode : Slackのmrkdwnを解析した結果の構文木の要素。
+type mrkdwnNode struct {
+	Kind mrkdwnKind
+	// Text is a text for mrkdwnText, mrkdwnCode and mrkdwnPreformatted, a
+	// label for mrkdwnUser, mrkdwnChannel and mrkdwnUserGroup, a name for
+	// mrkdwnEmoji and mrkdwnBroadcast, and a format for mrkdwnDate.
+	// Entities in the source text are already decoded.
+	Text string
+	// URL is a URL for mrkdwnLink, an ID for mrkdwnUser, mrkdwnChannel and
+	// mrkdwnUserGroup, or a timestamp for mrkdwnDate.
+	URL string
+	// Raw is the source text of mrkdwnUser, mrkdwnChannel and
+	// mrkdwnUserGroup, or the fallback text of mrkdwnDate.
+	Raw string
+	// Link is a link of mrkdwnDate.
+	Link string
+	// Ordered is true for an ordered mrkdwnList.
+	Ordered  bool
+	Children []*mrkdwnNode
+}
+
+// isBlock returns true for a node which is rendered as a block, not in a
+// line.
+func (n *mrkdwnNode) isBlock() bool {
+	switch n.Kind {
+	case mrkdwnPreformatted, mrkdwnQuote, mrkdwnList:
+		return true
+	}
+	return false
+}
+
+// parseMrkdwn parses text in Slack mrkdwn, and returns sequence of nodes.
+// The sequence consists of inline nodes separated by mrkdwnLineBreak, and
+// block nodes.
+//
+// https://api.slack.com/reference/surfaces/formatting
+func parseMrkdwn(text string) []*mrkdwnNode {
+	var nodes []*mrkdwnNode
+	for text != "" {
+		start, end := findCodeFence(text, 0)
+		if start < 0 {
+			break
+		}
+		closeStart, closeEnd := findCodeFence(text, end)
+		if closeStart < 0 {
+			// 閉じられていないコードブロックは通常のテキストとして扱う
+			break
+		}
+		before := strings.TrimSuffix(text[:start], "\n")
+		nodes = append(nodes, parseMrkdwnLines(before)...)
+		code := text[end:closeStart]
+		code = strings.TrimPrefix(code, "\n")
+		code = strings.TrimSuffix(code, "\n")
+		nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnPreformatted, Text: html.UnescapeString(code)})
+		text = strings.TrimPrefix(text[closeEnd:], "\n")
+	}
+	return append(nodes, parseMrkdwnLines(text)...)
+}
+
+// findCodeFence finds "```" (or full width "｀｀｀") in text from offset, and
+// returns its start and end. It returns -1 when not found.
+func findCodeFence(text string, offset int) (int, int) {
+	start, end := -1, -1
+	for _, fence := range []string{"```", "｀｀｀"} {
+		if i := strings.Index(text[offset:], fence); i >= 0 && (start < 0 || offset+i < start) {
+			start, end = offset+i, offset+i+len(fence)
+		}
+	}
+	return start, end
+}
+
+var reListItem = regexp.MustCompile(`^([ \t\x{3000}]*)([•◦▪▫‣-]|(\d+)[.)])[ \t]+(.*)$`)
+
+// mrkdwnListLine is a line which is an item of a list.
+type mrkdwnListLine struct {
+	indent  int
+	ordered bool
+	text    string
+}
+
+func parseListLine(line string) (mrkdwnListLine, bool) {
+	m := reListItem.FindStringSubmatch(line)
+	if m == nil {
+		return mrkdwnListLine{}, false
+	}
+	indent := 0
+	for _, r := range m[1] {
+		switch r {
+		case '\t':
+			indent += 4
+		case '　':
+			indent += 2
+		default:
+			indent++
+		}
+	}
+	return mrkdwnListLine{indent: indent, ordered: m[3] != "", text: m[4]}, true
+}
+
+// cutQuoteMarker removes a quote marker ("&gt;" or ">") at the head of line.
+// When multi is true, it removes a multi-line quote marker ("&gt;&gt;&gt;" or
+// ">>>") instead.
+func cutQuoteMarker(line string, multi bool) (string, bool) {
+	markers := []string{"&gt;", ">"}
+	if multi {
+		markers = []string{"&gt;&gt;&gt;", ">>>"}
+	}
+	for _, m := range markers {
+		if strings.HasPrefix(line, m) {
+			return strings.TrimPrefix(line[len(m):], " "), true
+		}
+	}
+	return "", false
+}
+
+// parseMrkdwnLines parses text which doesn't contain code blocks.
+func parseMrkdwnLines(text string) []*mrkdwnNode {
+	if text == "" {
+		return nil
+	}
+	var nodes []*mrkdwnNode
+	lines := strings.Split(text, "\n")
+	// inLine is true when the last node is a part of a line.
+	inLine := false
+	for i := 0; i < len(lines); {
+		if rest, ok := cutQuoteMarker(lines[i], true); ok {
+			rest = strings.Join(append([]string{rest}, lines[i+1:]...), "\n")
+			nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnQuote, Children: parseMrkdwnLines(rest)})
+			break
+		}
+		if _, ok := cutQuoteMarker(lines[i], false); ok {
+			var quoted []string
+			for ; i < len(lines); i++ {
+				rest, ok := cutQuoteMarker(lines[i], false)
+				if !ok {
+					break
+				}
+				quoted = append(quoted, rest)
+			}
+			nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnQuote, Children: parseMrkdwnLines(strings.Join(quoted, "\n"))})
+			inLine = false
+			continue
+		}
+		if _, ok := parseListLine(lines[i]); ok {
+			var items []mrkdwnListLine
+			for ; i < len(lines); i++ {
+				item, ok := parseListLine(lines[i])
+				if !ok {
+					break
+				}
+				// 種類の異なる項目は別のリストとする
+				if len(items) > 0 && item.indent <= items[0].indent && item.ordered != items[0].ordered {
+					break
+				}
+				items = append(items, item)
+			}
+			nodes = append(nodes, buildMrkdwnList(items))
+			inLine = false
+			continue
+		}
+		if inLine {
+			nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnLineBreak})
+		}
+		nodes = append(nodes, parseMrkdwnInline(lines[i])...)
+		inLine = true
+		i++
+	}
+	return nodes
+}
+
+// buildMrkdwnList builds a list from lines. A line which is indented deeper
+// than the previous line becomes an item of a nested list.
+func buildMrkdwnList(items []mrkdwnListLine) *mrkdwnNode {
+	type level struct {
+		indent int
+		list   *mrkdwnNode
+	}
+	root := &mrkdwnNode{Kind: mrkdwnList, Ordered: items[0].ordered}
+	stack := []level{{indent: items[0].indent, list: root}}
+	for _, item := range items {
+		for len(stack) > 1 && item.indent < stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		top := stack[len(stack)-1]
+		if item.indent > top.indent && len(top.list.Children) > 0 {
+			parent := top.list.Children[len(top.list.Children)-1]
+			nested := &mrkdwnNode{Kind: mrkdwnList, Ordered: item.ordered}
+			parent.Children = append(parent.Children, nested)
+			top = level{indent: item.indent, list: nested}
+			stack = append(stack, top)
+		}
+		top.list.Children = append(top.list.Children, &mrkdwnNode{
+			Kind:     mrkdwnListItem,
+			Children: parseMrkdwnInline(item.text),
+		})
+	}
+	return root
+}
+
+var reEmojiAt = regexp.MustCompile(`^:[^\s!"#$%&()=^/?\\\[\]<>,.;@{}~:]+:`)
+
+// isWordRune returns true for a letter or a digit. A style marker adjacent to
+// them is not a marker, like "snake_case_name".
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// canOpenStyle returns true when s[i] can be an opening marker of a style.
+func canOpenStyle(s string, i int) bool {
+	if i > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:i])
+		if isWordRune(r) || r == rune(s[i]) {
+			return false
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(s[i+1:])
+	return i+1 < len(s) && !unicode.IsSpace(r) && r != rune(s[i])
+}
+
+// findStyleCloser finds a closing marker for the style from s[start:], and
+// returns its index. It returns -1 when not found.
+func findStyleCloser(s string, start int, marker byte) int {
+	for j := start; j < len(s); j++ {
+		switch s[j] {
+		case '<':
+			if _, end, ok := parseMrkdwnAngle(s, j); ok {
+				j = end - 1
+			}
+			continue
+		case '`':
+			if k := strings.IndexByte(s[j+1:], '`'); k > 0 {
+				j += k + 1
+			}
+			continue
+		case marker:
+		default:
+			continue
+		}
+		if j == start {
+			continue
+		}
+		prev, _ := utf8.DecodeLastRuneInString(s[:j])
+		next, _ := utf8.DecodeRuneInString(s[j+1:])
+		if unicode.IsSpace(prev) || (j+1 < len(s) && isWordRune(next)) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+var styleKinds = map[byte]mrkdwnKind{
+	'*': mrkdwnBold,
+	'_': mrkdwnItalic,
+	'~': mrkdwnStrike,
+}
+
+// findCodeSpanEnd finds a closing backquote (or full width "｀") for an inline
+// code from s[start:], and returns the start and the end of it.
+func findCodeSpanEnd(s string, start int) (int, int) {
+	for j := start; j < len(s); {
+		r, size := utf8.DecodeRuneInString(s[j:])
+		if r == '`' || r == '｀' {
+			if j == start {
+				return -1, -1
+			}
+			return j, j + size
+		}
+		j += size
+	}
+	return -1, -1
+}
+
+// parseMrkdwnInline parses a line.
+func parseMrkdwnInline(s string) []*mrkdwnNode {
+	var (
+		nodes []*mrkdwnNode
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnText, Text: html.UnescapeString(text.String())})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '<':
+			if n, end, ok := parseMrkdwnAngle(s, i); ok {
+				flush()
+				nodes = append(nodes, n)
+				i = end
+				continue
+			}
+		case r == '`' || r == '｀':
+			if j, end := findCodeSpanEnd(s, i+size); j >= 0 {
+				flush()
+				nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnCode, Text: html.UnescapeString(s[i+size : j])})
+				i = end
+				continue
+			}
+		case r == ':':
+			if loc := reEmojiAt.FindStringIndex(s[i:]); loc != nil {
+				flush()
+				nodes = append(nodes, &mrkdwnNode{Kind: mrkdwnEmoji, Text: s[i : i+loc[1]]})
+				i += loc[1]
+				continue
+			}
+		case r == '*' || r == '_' || r == '~':
+			if canOpenStyle(s, i) {
+				if j := findStyleCloser(s, i+1, s[i]); j >= 0 {
+					flush()
+					nodes = append(nodes, &mrkdwnNode{
+						Kind:     styleKinds[s[i]],
+						Children: parseMrkdwnInline(s[i+1 : j]),
+					})
+					i = j + 1
+					continue
+				}
+			}
+		}
+		text.WriteString(s[i : i+size])
+		i += size
+	}
+	flush()
+	return nodes
+}
+
+// parseMrkdwnAngle parses a special token enclosed by "<" and ">" at s[i].
+// It returns the node and the end of the token. When the token is not
+// supported, it returns false and the token is treated as a plain text.
+func parseMrkdwnAngle(s string, i int) (*mrkdwnNode, int, bool) {
+	k := strings.IndexAny(s[i+1:], "<>\n")
+	if k < 0 || s[i+1+k] != '>' {
+		return nil, 0, false
+	}
+	end := i + 1 + k + 1
+	raw := s[i:end]
+	body, label := s[i+1:end-1], ""
+	if p := strings.IndexByte(body, '|'); p >= 0 {
+		body, label = body[:p], body[p+1:]
+	}
+	label = html.UnescapeString(label)
+
+	switch {
+	case strings.HasPrefix(body, "@") && len(body) > 1:
+		return &mrkdwnNode{Kind: mrkdwnUser, URL: body[1:], Text: label, Raw: html.UnescapeString(raw)}, end, true
+	case strings.HasPrefix(body, "#") && len(body) > 1:
+		return &mrkdwnNode{Kind: mrkdwnChannel, URL: body[1:], Text: label, Raw: html.UnescapeString(raw)}, end, true
+	case isSafeLinkURL(body):
+		n := &mrkdwnNode{Kind: mrkdwnLink, URL: html.UnescapeString(body)}
+		if label != "" {
+			n.Children = []*mrkdwnNode{{Kind: mrkdwnText, Text: label}}
+		}
+		return n, end, true
+	case strings.HasPrefix(body, "!"):
+		return parseMrkdwnCommand(body[1:], label, html.UnescapeString(raw)), end, true
+	}
+	return nil, 0, false
+}
+
+// parseMrkdwnCommand parses a special command `<!command|label>`. An unknown
+// command is shown as its label, or as is when it has no label.
+//
+// https://api.slack.com/reference/surfaces/formatting#special-mentions
+func parseMrkdwnCommand(body, label, raw string) *mrkdwnNode {
+	args := strings.Split(body, "^")
+	switch args[0] {
+	case "here", "channel", "everyone":
+		return &mrkdwnNode{Kind: mrkdwnBroadcast, Text: args[0]}
+	case "subteam":
+		if len(args) >= 2 && args[1] != "" {
+			return &mrkdwnNode{Kind: mrkdwnUserGroup, URL: args[1], Text: label, Raw: raw}
+		}
+	case "date":
+		if len(args) >= 3 {
+			n := &mrkdwnNode{Kind: mrkdwnDate, URL: args[1], Text: html.UnescapeString(args[2]), Raw: label}
+			if len(args) >= 4 && isSafeLinkURL(args[3]) {
+				n.Link = html.UnescapeString(args[3])
+			}
+			return n
+		}
+	}
+	if label != "" {
+		return &mrkdwnNode{Kind: mrkdwnText, Text: label}
+	}
+	return &mrkdwnNode{Kind: mrkdwnText, Text: raw}
+}
+
+// isSafeLinkURL returns true when u can be a link in pages, which is a http,
+// https or mailto URL. Links of other schemes like "javascript:" are shown as
+// texts.
+func isSafeLinkURL(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "mailto:")
+}
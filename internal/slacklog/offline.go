@@ -0,0 +1,202 @@
+package slacklog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxInlineFileSize : オフライン用HTMLにdata URIとして埋め込む添付画像の最大
+// サイズ。これより大きな画像はサイトへのリンクのままとなる。
+const maxInlineFileSize = 512 * 1024
+
+// OfflineExporter : チャンネル(またはその一部の期間)のログを、サイトにアクセス
+// できない人にも渡せる1つのHTMLファイルとして出力する。
+// channel_per_month のテンプレートを用い、CSSはstyle要素として、カスタム絵文字
+// と小さな添付画像はdata URIとして埋め込む。スクリプトは読み込まず、コードは
+// 生成時にハイライトする。サイトへのリンクは含めない。
+type OfflineExporter struct {
+	g *HTMLGenerator
+	// emojisDir is a directory which download-emoji saved emojis to.
+	emojisDir string
+	// cssPaths are paths or URLs of CSS files, like primer.css, site.css and
+	// highlight.css.
+	cssPaths []string
+
+	// dataURIs caches data URIs, key is the path of the file.
+	dataURIs map[string]string
+}
+
+// NewOfflineExporter creates an OfflineExporter. Templates and files are
+// read from the directories which g is configured with. g is changed to
+// highlight code, as scripts for it are not loaded.
+func NewOfflineExporter(g *HTMLGenerator, emojisDir string, cssPaths []string) *OfflineExporter {
+	g.cfg.Highlight = true
+	g.c.SetHighlight(true)
+	return &OfflineExporter{
+		g:         g,
+		emojisDir: emojisDir,
+		cssPaths:  cssPaths,
+	}
+}
+
+// Export はchannelのメッセージの内、fromからtoまで(toは含まない)に投稿された
+// ものをpathにHTMLとして出力する。fromまたはtoがゼロ値の場合、その方向の期間
+// は制限しない。
+func (e *OfflineExporter) Export(path string, channel Channel, from, to time.Time) error {
+	var msgs Messages
+	err := e.g.s.EachMonth(channel.ID, func(_ MessageMonthKey, mm Messages) error {
+		for _, msg := range mm {
+			t := e.g.s.tsToDateTime(msg.Timestamp)
+			if (!from.IsZero() && t.Before(from)) || (!to.IsZero() && !t.Before(to)) {
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("no messages in %s for the period", channel.DisplayName())
+	}
+
+	css, err := e.readCSS()
+	if err != nil {
+		return err
+	}
+
+	ct, err := e.g.channelTemplates(channel)
+	if err != nil {
+		return err
+	}
+	l := e.g.s.locale
+	first := e.g.s.tsToDateTime(msgs[0].Timestamp)
+	last := e.g.s.tsToDateTime(msgs[len(msgs)-1].Timestamp)
+	params := make(map[string]interface{})
+	params["baseURL"] = e.g.baseURL
+	params["filesBaseURL"] = e.g.filesBaseURL
+	params["channel"] = channel
+	params["monthKey"] = e.g.s.tsMonthKey(msgs[0].Timestamp)
+	params["period"] = l.formatDate(first) + " - " + l.formatDate(last)
+	params["msgs"] = msgs
+	params["offline"] = true
+	params["highlight"] = true
+	params["inlineCSS"] = css
+
+	var buf bytes.Buffer
+	if err := ct.month.Execute(&buf, params); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(e.inlineImages(buf.String())), 0666)
+}
+
+// readCSS reads and concatenates CSS files in cssPaths. A URL is fetched.
+func (e *OfflineExporter) readCSS() (string, error) {
+	var b strings.Builder
+	for _, path := range e.cssPaths {
+		css, err := readPathOrURL(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read CSS: %w", err)
+		}
+		b.Write(css)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// readPathOrURL reads contents of a file, or fetches them when path is a URL
+// of http or https.
+func readPathOrURL(path string) ([]byte, error) {
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		return ioutil.ReadFile(path)
+	}
+	resp, err := http.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+var reSrcAttr = regexp.MustCompile(`src=("[^"]*"|'[^']*')`)
+
+// inlineImages replaces src attributes which refer emojis or attached files in
+// the site, with data URIs.
+func (e *OfflineExporter) inlineImages(s string) string {
+	return reSrcAttr.ReplaceAllStringFunc(s, func(attr string) string {
+		q := attr[4:5]
+		u := html.UnescapeString(attr[5 : len(attr)-1])
+		data, ok := e.dataURI(u)
+		if !ok {
+			return attr
+		}
+		return "src=" + q + data + q
+	})
+}
+
+// dataURI returns a data URI for the file which u refers to. It returns false
+// when u doesn't refer a local file, or the file should not be inlined.
+func (e *OfflineExporter) dataURI(u string) (string, bool) {
+	var (
+		path  string
+		limit int64
+	)
+	if p := strings.TrimPrefix(u, e.g.baseURL+"/emojis/"); p != u {
+		path = e.localPath(e.emojisDir, p)
+	} else if p := strings.TrimPrefix(u, e.g.filesBaseURL+"/"); p != u {
+		path = e.localPath(e.g.filesDir, p)
+		limit = maxInlineFileSize
+	}
+	if path == "" {
+		return "", false
+	}
+	if data, ok := e.dataURIs[path]; ok {
+		return data, data != ""
+	}
+	if e.dataURIs == nil {
+		e.dataURIs = map[string]string{}
+	}
+
+	var data string
+	fi, err := os.Stat(path)
+	if err == nil && (limit == 0 || fi.Size() <= limit) {
+		if b, err := ioutil.ReadFile(path); err == nil {
+			typ := mime.TypeByExtension(filepath.Ext(path))
+			if typ == "" {
+				typ = http.DetectContentType(b)
+			}
+			data = "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(b)
+		}
+	}
+	e.dataURIs[path] = data
+	return data, data != ""
+}
+
+// localPath converts an escaped URL path to a path under dir. It returns an
+// empty string for an invalid path.
+func (e *OfflineExporter) localPath(dir, p string) string {
+	p, err := url.PathUnescape(p)
+	if err != nil || p == "" {
+		return ""
+	}
+	p = filepath.Clean(filepath.FromSlash(p))
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "..") {
+		return ""
+	}
+	return filepath.Join(dir, p)
+}
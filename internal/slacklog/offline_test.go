@@ -0,0 +1,111 @@
+package slacklog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOfflineExporter_Export(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	emojisDir := filepath.Join(tmpPath, "emojis")
+	if err := os.MkdirAll(emojisDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	gif := "GIF89a\x01\x00\x01\x00\x00\x00\x00;"
+	if err := ioutil.WriteFile(filepath.Join(emojisDir, "partyparrot.gif"), []byte(gif), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	primerPath := filepath.Join(tmpPath, "primer.css")
+	if err := ioutil.WriteFile(primerPath, []byte(".primer-rule{}"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newTestGenerator(t, "testdata/generator/slacklog_data")
+	e := NewOfflineExporter(g, emojisDir, []string{primerPath, "../../static/assets/css/site.css", "../../static/assets/css/highlight.css"})
+	channel, ok := g.s.FindChannel("general")
+	if !ok {
+		t.Fatal("channel not found")
+	}
+	output := filepath.Join(tmpPath, "general.html")
+	to := time.Date(2020, 2, 1, 0, 0, 0, 0, g.s.Location())
+	if err := e.Export(output, *channel, time.Time{}, to); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readString(t, output)
+	for _, want := range []string{
+		"<style>\n",
+		".primer-rule{}",
+		".slacklog-highlight .hl-keyword",
+		"2020年1月26日 - 2020年1月26日",
+		`src='data:image/gif;base64,R0lGODlhAQABAAAAADs='`,
+		// replies of the thread are included even if they are out of range.
+		`id="ts-1580700100.000200"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("exported page doesn't contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{
+		"/assets/css/site.css",
+		"https://unpkg.com/",
+		"<script",
+		`href="/C001/`,
+		"/threads/",
+		`id="ts-1580700000.000100"`,
+	} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("exported page contains %q", unwanted)
+		}
+	}
+}
+
+func TestOfflineExporter_dataURI(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	for name, size := range map[string]int{
+		"small.png": 10,
+		"large.png": maxInlineFileSize + 1,
+	} {
+		dir := filepath.Join(tmpPath, "F001")
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := &HTMLGenerator{filesDir: tmpPath, filesBaseURL: "/files", c: newTestTextConverter()}
+	e := NewOfflineExporter(g, tmpPath, nil)
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{"/files/F001/small.png", true},
+		{"/files/F001/large.png", false},
+		{"/files/F001/missing.png", false},
+		{"/files/../F001/small.png", false},
+		{"https://example.com/image.png", false},
+	} {
+		data, ok := e.dataURI(tc.url)
+		if ok != tc.ok {
+			t.Errorf("dataURI(%q) returns %t, want %t", tc.url, ok, tc.ok)
+		}
+		if ok && !strings.HasPrefix(data, "data:image/png;base64,") {
+			t.Errorf("dataURI(%q) returns unexpected data: %s", tc.url, data)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package slacklog
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultWorkspaceDomain is the domain of the Slack workspace, used when
+// Config.WorkspaceDomain is empty.
+const DefaultWorkspaceDomain = "vim-jp.slack.com"
+
+// Permalink : Slackのメッセージのパーマリンクを解析した結果。
+// https://${domain}/archives/${channel_id}/p${ts}?thread_ts=${thread_ts}
+type Permalink struct {
+	ChannelID string
+	Timestamp string
+	// ThreadTimestamp is the timestamp of the parent message, when the
+	// message is a reply in a thread.
+	ThreadTimestamp string
+}
+
+var rePermalinkPath = regexp.MustCompile(`^/archives/([A-Z0-9]+)/p(\d+)(\d{6})/?$`)
+
+// ParsePermalink parses a permalink of a message in the workspace of domain.
+// It returns false when rawURL is not a permalink.
+func ParsePermalink(rawURL, domain string) (*Permalink, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || !strings.EqualFold(u.Host, domain) {
+		return nil, false
+	}
+	m := rePermalinkPath.FindStringSubmatch(u.Path)
+	if m == nil {
+		return nil, false
+	}
+	p := &Permalink{
+		ChannelID: m[1],
+		Timestamp: m[2] + "." + m[3],
+	}
+	if ts := u.Query().Get("thread_ts"); ts != "" && ts != p.Timestamp {
+		p.ThreadTimestamp = ts
+	}
+	return p, true
+}
+
+// ArchivePath returns the path of the page which shows the message, relative
+// to the root of the site: the thread page for a reply, or the month page for
+// other messages. The month is decided in loc.
+func (p *Permalink) ArchivePath(loc *time.Location) string {
+	if p.ThreadTimestamp != "" {
+		return "/" + p.ChannelID + "/threads/" + p.ThreadTimestamp + "/#ts-" + p.Timestamp
+	}
+	key := tsMonthKey(p.Timestamp, loc)
+	return "/" + p.ChannelID + "/" + key.Year() + "/" + key.Month() + "/#ts-" + p.Timestamp
+}
@@ -0,0 +1,75 @@
+package slacklog
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePermalink(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want *Permalink
+	}{
+		{"https://vim-jp.slack.com/archives/C001/p1580000000000100", &Permalink{ChannelID: "C001", Timestamp: "1580000000.000100"}},
+		{"https://VIM-JP.slack.com/archives/C001/p1580000000000100/", &Permalink{ChannelID: "C001", Timestamp: "1580000000.000100"}},
+		{"https://vim-jp.slack.com/archives/C001/p1580000000000200?thread_ts=1580000000.000100&cid=C001", &Permalink{ChannelID: "C001", Timestamp: "1580000000.000200", ThreadTimestamp: "1580000000.000100"}},
+		{"https://vim-jp.slack.com/archives/C001/p1580000000000100?thread_ts=1580000000.000100", &Permalink{ChannelID: "C001", Timestamp: "1580000000.000100"}},
+		{"https://vim-jp.slack.com/archives/C001", nil},
+		{"https://vim-jp.slack.com/files/U001/F001/a.png", nil},
+		{"https://example.slack.com/archives/C001/p1580000000000100", nil},
+		{"ftp://vim-jp.slack.com/archives/C001/p1580000000000100", nil},
+	} {
+		got, ok := ParsePermalink(tc.in, "vim-jp.slack.com")
+		if ok != (tc.want != nil) {
+			t.Errorf("ParsePermalink(%q) returns %t", tc.in, ok)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("ParsePermalink(%q) mismatch: -want +got\n%s", tc.in, diff)
+		}
+	}
+}
+
+func TestTextConverter_permalink(t *testing.T) {
+	c := newTestTextConverter()
+	var general Channel
+	general.ID = "C001"
+	general.Name = "general"
+	c.SetChannels([]Channel{general})
+	c.SetWorkspaceDomain("vim-jp.slack.com")
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{
+			"<https://vim-jp.slack.com/archives/C001/p1580000000000100>",
+			"<a href='https://example.org/C001/2020/01/#ts-1580000000.000100'>https://example.org/C001/2020/01/#ts-1580000000.000100</a>",
+		},
+		{
+			"<https://vim-jp.slack.com/archives/C001/p1580000000000200?thread_ts=1580000000.000100&amp;cid=C001|reply>",
+			"<a href='https://example.org/C001/threads/1580000000.000100/#ts-1580000000.000200'>reply</a>",
+		},
+		{
+			"<https://vim-jp.slack.com/archives/C999/p1580000000000100>",
+			"<a href='https://vim-jp.slack.com/archives/C999/p1580000000000100'>https://vim-jp.slack.com/archives/C999/p1580000000000100</a>",
+		},
+	} {
+		if got := c.ToHTML(tc.in); got != tc.want {
+			t.Errorf("ToHTML(%q) mismatch:\nwant: %s\n got: %s", tc.in, tc.want, got)
+		}
+	}
+
+	blocks := `[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+		{"type":"link","url":"https://vim-jp.slack.com/archives/C001/p1580000000000100","text":"msg"}
+	]}]}]`
+	want := "<a href='https://example.org/C001/2020/01/#ts-1580000000.000100'>msg</a>"
+	if got, _ := c.BlocksToHTML([]byte(blocks)); got != want {
+		t.Errorf("BlocksToHTML mismatch:\nwant: %s\n got: %s", want, got)
+	}
+
+	wantMd := "[msg](https://example.org/C001/2020/01/#ts-1580000000.000100)"
+	if got := c.ToMarkdown("<https://vim-jp.slack.com/archives/C001/p1580000000000100|msg>"); got != wantMd {
+		t.Errorf("ToMarkdown mismatch:\nwant: %s\n got: %s", wantMd, got)
+	}
+}
@@ -0,0 +1,479 @@
+package slacklog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Renderer : Generatorが辿ったLogStoreのデータを、特定の形式で出力する。
+// 各メソッドのpathには出力先のファイルのパスが渡される。ファイル名は
+// Filename()の値となり、ディレクトリはGeneratorが作成する。
+type Renderer interface {
+	// Name returns name of the output format, such as "html".
+	Name() string
+	// Filename returns name of the file for each page, such as "index.html".
+	Filename() string
+	// Inputs returns paths of files or directories, which affect all
+	// outputs, such as templates.
+	Inputs() []string
+
+	// RenderIndex renders the top index which lists channels.
+	RenderIndex(path string, channels []Channel) error
+	// RenderChannelIndex renders an index of the channel which lists months.
+	RenderChannelIndex(path string, channel Channel, keys []MessageMonthKey) error
+	// RenderMonth renders messages of the channel in the month.
+	RenderMonth(path string, channel Channel, key MessageMonthKey, msgs Messages) error
+	// RenderThread renders a thread. key is the month of the root message.
+	RenderThread(path string, channel Channel, key MessageMonthKey, root *Message, replies Messages) error
+}
+
+// SiteRenderer : チャンネル・月毎のページ以外に、サイト全体から生成する出力を
+// 持つRendererが実装する。
+type SiteRenderer interface {
+	// RenderSite renders outputs for the whole site, after all channels are
+	// rendered. force is true when any of inputs have been changed from the
+	// last generation.
+	RenderSite(outDir string, channels []Channel, force bool) error
+}
+
+// Generator : LogStoreのデータを辿り、Rendererを用いて出力する。
+// 前回の生成時のマニフェストと比較し、入力に変更のあった部分のみを出力する。
+type Generator struct {
+	s   *LogStore
+	cfg Config
+	r   Renderer
+
+	// fullRebuild makes Generate() regenerate all pages, ignoring the manifest.
+	fullRebuild bool
+}
+
+// NewGenerator : Generatorを生成する。
+func NewGenerator(s *LogStore, cfg *Config, r Renderer) *Generator {
+	return &Generator{
+		s:   s,
+		cfg: *cfg,
+		r:   r,
+	}
+}
+
+// SetFullRebuild : trueを指定すると、Generate()は前回の生成結果を考慮せずに全
+// てのページを再生成する。
+func (gen *Generator) SetFullRebuild(full bool) {
+	gen.fullRebuild = full
+}
+
+// Generate はoutDirにログデータの変換結果を生成する。
+// 目標とする構造は以下となる。index.htmlの部分はRenderer.Filename()となる:
+//   - outDir/
+//     - index.html // Renderer.RenderIndex()
+//     - ${channel_id}/ // generateChannelDir()
+//       - index.html // Renderer.RenderChannelIndex()
+//       - ${YYYY}/
+//         - ${MM}/
+//           - index.html // Renderer.RenderMonth()
+//       - threads/
+//         - ${thread_ts}/
+//           - index.html // Renderer.RenderThread()
+//     - .slacklog_manifest.json // Manifest
+//
+// 前回の生成時のマニフェストが存在する場合は、入力に変更のあったページのみを
+// 再生成する。
+func (gen *Generator) Generate(outDir string) error {
+	if err := os.MkdirAll(outDir, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", outDir, err)
+	}
+
+	manifestPath := filepath.Join(outDir, manifestFilename)
+	next := NewManifest()
+	globalHash, err := gen.globalHash()
+	if err != nil {
+		return err
+	}
+	next.GlobalHash = globalHash
+	prev, err := gen.previousManifest(manifestPath, globalHash)
+	if err != nil {
+		return err
+	}
+
+	channels := gen.s.GetChannels()
+
+	createdChannels := []Channel{}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i := range channels {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cm, err := gen.generateChannelDir(
+				filepath.Join(outDir, channels[i].ID),
+				channels[i],
+				prev.Channels[channels[i].ID],
+			)
+			if err != nil {
+				log.Printf("generateChannelDir(%s) failed: %s", channels[i].ID, err)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			if cm != nil {
+				mu.Lock()
+				createdChannels = append(createdChannels, channels[i])
+				next.Channels[channels[i].ID] = cm
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	indexPath := filepath.Join(outDir, gen.r.Filename())
+	if !sameChannelSet(prev, next) || !fileExists(indexPath) {
+		if err := gen.r.RenderIndex(indexPath, createdChannels); err != nil {
+			return err
+		}
+	}
+
+	if sr, ok := gen.r.(SiteRenderer); ok {
+		if err := sr.RenderSite(outDir, createdChannels, !prev.SameFiles(next)); err != nil {
+			return err
+		}
+	}
+
+	if err := next.Write(manifestPath); err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// previousManifest reads the manifest of the last generation, to compare with
+// the current inputs. It returns an empty manifest to regenerate all pages,
+// when full rebuild is specified or inputs which affect all pages are
+// changed.
+func (gen *Generator) previousManifest(path, globalHash string) (*Manifest, error) {
+	if gen.fullRebuild {
+		return NewManifest(), nil
+	}
+	m, err := ReadManifest(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %w", err)
+	}
+	if m.GlobalHash != globalHash {
+		// テンプレートや設定が変わった場合は全て再生成する
+		return NewManifest(), nil
+	}
+	return m, nil
+}
+
+// globalHash calculates a hash of inputs which affect all pages.
+func (gen *Generator) globalHash() (string, error) {
+	ih := newInputHasher()
+	ih.addString("version", strconv.Itoa(manifestVersion))
+	ih.addString("format", gen.r.Name())
+	cfg, err := json.Marshal(gen.cfg)
+	if err != nil {
+		return "", err
+	}
+	ih.addString("config", string(cfg))
+	ih.addString("baseURL", os.Getenv("BASEURL"))
+	ih.addString("filesBaseURL", os.Getenv("FILES_BASEURL"))
+	for _, path := range gen.r.Inputs() {
+		if err := ih.addPath(path); err != nil {
+			return "", err
+		}
+	}
+	hashes, err := gen.s.src.metadataHashes()
+	if err != nil {
+		return "", err
+	}
+	for _, h := range hashes {
+		ih.addString(h.name, h.hash)
+	}
+	return ih.sum(), nil
+}
+
+// sameChannelSet checks both manifests have same channels.
+func sameChannelSet(a, b *Manifest) bool {
+	if len(a.Channels) != len(b.Channels) {
+		return false
+	}
+	for id := range a.Channels {
+		if _, ok := b.Channels[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// generateChannelDir generates pages for the channel, and returns a
+// ChannelManifest for the channel. It returns nil when the channel has no
+// messages.
+// prev is a ChannelManifest for the last generation. Only pages which inputs
+// are changed from prev are regenerated. When prev is nil, all pages are
+// regenerated.
+func (gen *Generator) generateChannelDir(path string, channel Channel, prev *ChannelManifest) (*ChannelManifest, error) {
+	keys, err := gen.s.GetMonthKeys(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return nil, fmt.Errorf("could not create %s directory: %w", path, err)
+	}
+
+	cm, err := gen.newChannelManifest(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	dirty, changed, all, err := gen.dirtyMonths(channel.ID, prev, cm)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := gen.r.Filename()
+	prevMonths := prev.Months()
+	curMonths := cm.Months()
+	keysChanged := len(prevMonths) != len(curMonths)
+	for key := range prevMonths {
+		if _, ok := curMonths[key]; ok {
+			continue
+		}
+		keysChanged = true
+		// 無くなった月のページとその月のスレッドのページは削除する
+		monthPath := filepath.Join(path, key.Year(), key.Month(), filename)
+		if err := os.Remove(monthPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := gen.removeStaleThreads(filepath.Join(path, "threads"), key, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// ピン留めされたメッセージやチャンネルの履歴が変更された場合も一覧を再生
+	// 成する
+	pinsChanged := false
+	for _, pin := range channel.Pins {
+		if _, ok := changed[pin.ID]; ok {
+			pinsChanged = true
+		}
+	}
+	history, err := gen.s.GetChannelHistory(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	historyChanged := false
+	for _, msg := range history {
+		if _, ok := changed[msg.Timestamp]; ok {
+			historyChanged = true
+		}
+	}
+	indexPath := filepath.Join(path, filename)
+	if all || keysChanged || pinsChanged || historyChanged || !fileExists(indexPath) {
+		indexKeys := append([]MessageMonthKey(nil), keys...)
+		sortMessageMonthKeys(indexKeys)
+		if err := gen.r.RenderChannelIndex(indexPath, channel, indexKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range keys {
+		monthDir := filepath.Join(path, key.Year(), key.Month())
+		if _, ok := dirty[key]; !all && !ok && fileExists(filepath.Join(monthDir, filename)) {
+			continue
+		}
+		mm, err := gen.s.GetMonthMessages(channel.ID, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(monthDir, 0777); err != nil {
+			return nil, fmt.Errorf("could not create %s directory: %w", monthDir, err)
+		}
+		if err := gen.r.RenderMonth(filepath.Join(monthDir, filename), channel, key, mm); err != nil {
+			return nil, err
+		}
+		if err := gen.generateThreads(filepath.Join(path, "threads"), channel, key, mm); err != nil {
+			return nil, err
+		}
+	}
+	return cm, nil
+}
+
+// generateThreads generates a page for each thread which root message is in
+// msgs. The pages are put in path/${thread_ts}/ . Pages of other threads in
+// the month, like threads which root or replies are deleted, are removed.
+func (gen *Generator) generateThreads(path string, channel Channel, key MessageMonthKey, msgs Messages) error {
+	generated := map[string]struct{}{}
+	for _, msg := range msgs {
+		if !msg.IsRootOfThread() {
+			continue
+		}
+		thread, ok := gen.s.GetThread(channel.ID, msg.Timestamp)
+		if !ok || thread.ReplyCount() == 0 {
+			continue
+		}
+		threadDir := filepath.Join(path, msg.Timestamp)
+		if err := os.MkdirAll(threadDir, 0777); err != nil {
+			return fmt.Errorf("could not create %s directory: %w", threadDir, err)
+		}
+		err := gen.r.RenderThread(filepath.Join(threadDir, gen.r.Filename()), channel, key, msg, thread.Replies())
+		if err != nil {
+			return err
+		}
+		generated[msg.Timestamp] = struct{}{}
+	}
+	return gen.removeStaleThreads(path, key, generated)
+}
+
+// removeStaleThreads removes directories of threads in path, which root
+// messages are posted in the month, except threads in keep.
+func (gen *Generator) removeStaleThreads(path string, key MessageMonthKey, keep map[string]struct{}) error {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		ts := e.Name()
+		if !e.IsDir() || gen.s.tsMonthKey(ts) != key {
+			continue
+		}
+		if _, ok := keep[ts]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(path, ts)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newChannelManifest creates a ChannelManifest from current message files of
+// the channel.
+func (gen *Generator) newChannelManifest(channelID string) (*ChannelManifest, error) {
+	files, err := gen.s.logFileHashes(channelID)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := gen.s.threadsByMonth(channelID)
+	if err != nil {
+		return nil, err
+	}
+	cm := &ChannelManifest{
+		Files:   files,
+		Threads: make(map[string][]string, len(threads)),
+	}
+	for key, list := range threads {
+		cm.Threads[monthName(key)] = list
+	}
+	return cm, nil
+}
+
+// dirtyMonths compares two ChannelManifests and returns months which pages
+// should be regenerated, and timestamps of messages which may be changed.
+// When all pages should be regenerated, it returns true as third value.
+// 変更されたファイルの月に加えて、そのファイルに含まれる、もしくは前回含まれ
+// ていたスレッドの先頭及び返信が存在する月と、前後の月へのリンクが変わる月を対
+// 象とする。
+func (gen *Generator) dirtyMonths(channelID string, prev, cur *ChannelManifest) (map[MessageMonthKey]struct{}, map[string]struct{}, bool, error) {
+	if prev == nil {
+		return nil, nil, true, nil
+	}
+	for name := range prev.Files {
+		if _, ok := cur.Files[name]; !ok {
+			// 削除されたファイルの内容は分からないので全て再生成する
+			return nil, nil, true, nil
+		}
+	}
+
+	dirty := map[MessageMonthKey]struct{}{}
+	changed := map[string]struct{}{}
+	for name, sum := range cur.Files {
+		if prev.Files[name] == sum {
+			continue
+		}
+		key, ok := logFileMonthKey(name)
+		if !ok {
+			continue
+		}
+		dirty[key] = struct{}{}
+		// 削除された返信のスレッドの先頭がある月も対象とする
+		for _, ts := range prev.Threads[monthName(key)] {
+			dirty[gen.s.tsMonthKey(ts)] = struct{}{}
+		}
+
+		msgs, err := gen.s.readLogFile(channelID, name)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		for _, msg := range msgs {
+			changed[msg.Timestamp] = struct{}{}
+			if msg.isEvent() {
+				changed[msg.targetTimestamp()] = struct{}{}
+				// 変更されたメッセージは他の月にあることがある
+				dirty[gen.s.tsMonthKey(msg.targetTimestamp())] = struct{}{}
+				if sub := msg.SubMessage; sub != nil && sub.ThreadTimestamp != "" {
+					msg = sub
+				} else if prev := msg.PreviousMessage; prev != nil && prev.ThreadTimestamp != "" {
+					dirty[gen.s.tsMonthKey(prev.ThreadTimestamp)] = struct{}{}
+				} else if target, ok := gen.s.GetMessage(channelID, msg.targetTimestamp()); ok && target.ThreadTimestamp != "" {
+					dirty[gen.s.tsMonthKey(target.ThreadTimestamp)] = struct{}{}
+				}
+			}
+			if msg.ThreadTimestamp == "" {
+				continue
+			}
+			dirty[gen.s.tsMonthKey(msg.ThreadTimestamp)] = struct{}{}
+			if t, ok := gen.s.GetThread(channelID, msg.ThreadTimestamp); ok {
+				for _, reply := range t.Replies() {
+					dirty[gen.s.tsMonthKey(reply.Timestamp)] = struct{}{}
+				}
+			}
+		}
+	}
+
+	prevMonths := prev.Months()
+	curMonths := cur.Months()
+	for key := range curMonths {
+		if _, ok := prevMonths[key]; !ok {
+			dirty[key.Prev()] = struct{}{}
+			dirty[key.Next()] = struct{}{}
+		}
+	}
+	for key := range prevMonths {
+		if _, ok := curMonths[key]; !ok {
+			dirty[key.Prev()] = struct{}{}
+			dirty[key.Next()] = struct{}{}
+		}
+	}
+	return dirty, changed, false, nil
+}
+
+// tsMonthKey returns MessageMonthKey for the month which the timestamp
+// belongs to in loc.
+func tsMonthKey(ts string, loc *time.Location) MessageMonthKey {
+	t := TsToDateTime(ts, loc)
+	return MessageMonthKey{year: t.Year(), month: int(t.Month())}
+}
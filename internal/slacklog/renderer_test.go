@@ -0,0 +1,62 @@
+package slacklog
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerator_Generate_text(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	g := newTestGenerator(t, "testdata/generator/slacklog_data")
+	if err := NewGenerator(g.s, &g.cfg, NewTextRenderer(g.s)).Generate(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	month := readString(t, filepath.Join(tmpPath, "C001", "2020", "01", "index.txt"))
+	for _, want := range []string{
+		"2020-01-26 09:53:20 Alice:\n",
+		"@bob see example (https://example.com)",
+		"    2020-02-03 12:21:40 Alice:\n      late reply\n",
+	} {
+		if !strings.Contains(month, want) {
+			t.Errorf("month page doesn't contain %q:\n%s", want, month)
+		}
+	}
+	if !fileExists(filepath.Join(tmpPath, "C001", "threads", "1580000000.000100", "index.txt")) {
+		t.Error("thread page is not generated")
+	}
+}
+
+func TestGenerator_Generate_json(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	g := newTestGenerator(t, "testdata/generator/slacklog_data")
+	if err := NewGenerator(g.s, &g.cfg, NewJSONRenderer()).Generate(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Channel  jsonChannel `json:"channel"`
+		Month    jsonMonth   `json:"month"`
+		Messages []Message   `json:"messages"`
+	}
+	b := readString(t, filepath.Join(tmpPath, "C001", "2020", "02", "index.json"))
+	if err := json.Unmarshal([]byte(b), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Channel.Name != "general" || got.Month.Year != 2020 || got.Month.Month != 2 {
+		t.Errorf("unexpected header: %+v %+v", got.Channel, got.Month)
+	}
+	if len(got.Messages) == 0 || got.Messages[0].Timestamp != "1580700000.000100" {
+		t.Errorf("unexpected messages: %+v", got.Messages)
+	}
+}
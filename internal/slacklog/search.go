@@ -0,0 +1,415 @@
+package slacklog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexReader : build-indexが出力した索引を読み込み、search.jsと同じ方法でメッ
+// セージを検索する。
+type IndexReader struct {
+	dir      string
+	channels map[int]IndexChannel
+	users    map[int]IndexUser
+	// key: gram
+	cache map[string]messagePositions
+}
+
+// IndexChannel : 索引の"channel"ファイル中のチャンネル。
+type IndexChannel struct {
+	Number int
+	ID     string
+	Name   string
+}
+
+// IndexUser : 索引の"user"ファイル中のユーザ。
+type IndexUser struct {
+	Number      int
+	ID          string
+	Name        string
+	DisplayName string
+}
+
+// NewIndexReader reads "channel" and "user" files in the index dir.
+func NewIndexReader(dir string) (*IndexReader, error) {
+	r := &IndexReader{
+		dir:      dir,
+		channels: map[int]IndexChannel{},
+		users:    map[int]IndexUser{},
+		cache:    map[string]messagePositions{},
+	}
+	err := readIndexTable(filepath.Join(dir, "channel"), 3, func(number int, fields []string) {
+		r.channels[number] = IndexChannel{Number: number, ID: fields[1], Name: fields[2]}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readIndexTable(filepath.Join(dir, "user"), 4, func(number int, fields []string) {
+		r.users[number] = IndexUser{Number: number, ID: fields[1], Name: fields[2], DisplayName: fields[3]}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readIndexTable reads lines of tab separated fields in path, which the first
+// field is the number.
+func readIndexTable(path string, n int, fn func(number int, fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) != n {
+			return fmt.Errorf("%s:%d: %d fields are expected, but %d", path, lineNo, n, len(fields))
+		}
+		number, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		fn(number, fields)
+	}
+	return sc.Err()
+}
+
+// Channel returns the channel of the number in the index.
+func (r *IndexReader) Channel(number int) (IndexChannel, bool) {
+	ch, ok := r.channels[number]
+	return ch, ok
+}
+
+// User returns the user of the number in the index.
+func (r *IndexReader) User(number int) (IndexUser, bool) {
+	u, ok := r.users[number]
+	return u, ok
+}
+
+// postings returns postings in the index file of the gram. It returns empty
+// postings when the file doesn't exist.
+func (r *IndexReader) postings(key string) (messagePositions, error) {
+	if mp, ok := r.cache[key]; ok {
+		return mp, nil
+	}
+	mp, err := readIndexFile(indexFilePath(r.dir, key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		mp = messagePositions{}
+	}
+	r.cache[key] = mp
+	return mp, nil
+}
+
+// searchWord returns start positions of the word in fields of messages. The
+// word is split into grams, and positions where all of them are adjacent are
+// returned.
+func (r *IndexReader) searchWord(word string) (messagePositions, error) {
+	runes := []rune(word)
+	var result messagePositions
+	for i := 0; i < len(runes); i += gramN {
+		end := i + gramN
+		if end > len(runes) {
+			end = len(runes)
+		}
+		mp, err := r.postings(string(runes[i:end]))
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = mp
+			continue
+		}
+		next := messagePositions{}
+		for channelNumber, mposMap := range result {
+			curMap := mp[channelNumber]
+			for pk, starts := range mposMap {
+				curPositions := make(map[int]struct{}, len(curMap[pk]))
+				for _, pos := range curMap[pk] {
+					curPositions[pos] = struct{}{}
+				}
+				for _, start := range starts {
+					if _, ok := curPositions[start+i]; ok {
+						next.Add(channelNumber, pk, start)
+					}
+				}
+			}
+		}
+		result = next
+	}
+	return result, nil
+}
+
+// SearchQuery : 検索語と絞り込みの条件。search.jsと同じ構文で、空白で区切った
+// 語と以下の演算子からなる。
+//
+//	from:@user         name or display name of the user who posted
+//	in:#channel        name or ID of the channel
+//	before:YYYY-MM-DD  messages posted before the date
+//	after:YYYY-MM-DD   messages posted after the date
+//
+// from: and in: can be given more than once to match any of them. Dates are
+// in the timezone of the archive.
+type SearchQuery struct {
+	Words []string
+	From  []string
+	In    []string
+	// Before and After are the range of times, After is inclusive and Before
+	// is exclusive. They are zero when not specified.
+	Before time.Time
+	After  time.Time
+}
+
+var reSearchOperator = regexp.MustCompile(`^(from|in|before|after):(.+)$`)
+
+// ParseSearchQuery parses the query. Dates of before: and after: are in loc.
+func ParseSearchQuery(query string, loc *time.Location) (*SearchQuery, error) {
+	q := &SearchQuery{}
+	for _, term := range strings.Fields(query) {
+		m := reSearchOperator.FindStringSubmatch(term)
+		if m == nil {
+			q.Words = append(q.Words, term)
+			continue
+		}
+		op, value := m[1], m[2]
+		switch op {
+		case "from":
+			q.From = append(q.From, strings.ToLower(strings.TrimPrefix(value, "@")))
+		case "in":
+			q.In = append(q.In, strings.ToLower(strings.TrimPrefix(value, "#")))
+		case "before", "after":
+			date, err := time.ParseInLocation("2006-1-2", value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("date must be YYYY-MM-DD: %s", value)
+			}
+			if op == "before" {
+				q.Before = date
+			} else {
+				q.After = date.AddDate(0, 0, 1)
+			}
+		}
+	}
+	if len(q.Words) == 0 {
+		return nil, fmt.Errorf("no words to search in query: %q", query)
+	}
+	return q, nil
+}
+
+func (q *SearchQuery) matchChannel(ch IndexChannel) bool {
+	if len(q.In) == 0 {
+		return true
+	}
+	return containsFold(q.In, ch.ID, ch.Name)
+}
+
+func (q *SearchQuery) matchUser(u IndexUser) bool {
+	if len(q.From) == 0 {
+		return true
+	}
+	return containsFold(q.From, u.ID, u.Name, u.DisplayName)
+}
+
+func (q *SearchQuery) matchTime(t time.Time) bool {
+	return (q.Before.IsZero() || t.Before(q.Before)) && (q.After.IsZero() || !t.Before(q.After))
+}
+
+// containsFold returns true when any of names is in lowered values.
+func containsFold(values []string, names ...string) bool {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		name = strings.ToLower(name)
+		for _, v := range values {
+			if v == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SearchResult : 検索語を全て含むメッセージ。
+type SearchResult struct {
+	Channel   IndexChannel
+	User      IndexUser
+	Timestamp string
+	// matches are start positions and lengths of words in fields.
+	matches map[indexField][]searchMatch
+}
+
+type searchMatch struct {
+	pos int
+	len int
+}
+
+// FieldNames returns names of fields which have the words, like "text" and
+// "attachment".
+func (res *SearchResult) FieldNames() []string {
+	fields := make([]int, 0, len(res.matches))
+	for field := range res.matches {
+		fields = append(fields, int(field))
+	}
+	sort.Ints(fields)
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, indexField(field).String())
+	}
+	return names
+}
+
+// String returns the name of the field.
+func (f indexField) String() string {
+	switch f {
+	case fieldText:
+		return "text"
+	case fieldAttachment:
+		return "attachment"
+	case fieldFile:
+		return "file"
+	case fieldSnippet:
+		return "snippet"
+	case fieldBlocks:
+		return "blocks"
+	}
+	return strconv.Itoa(int(f))
+}
+
+// Snippet returns a part of text of the message around the first match of
+// the words, which are enclosed by open and close. width is the max number of
+// characters in the part. The beginning of text is returned when the words
+// are not in the text.
+func (res *SearchResult) Snippet(text string, width int, open, close string) string {
+	// 索引中の位置と対応させるため、改行は1文字ずつ空白に置き換える
+	runes := []rune(strings.NewReplacer("\r", " ", "\n", " ").Replace(text))
+	matches := append([]searchMatch(nil), res.matches[fieldText]...)
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].pos < matches[j].pos
+	})
+
+	start := 0
+	if len(matches) > 0 {
+		start = matches[0].pos - width/4
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+		if start > end-width {
+			start = end - width
+			if start < 0 {
+				start = 0
+			}
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	pos := start
+	for _, m := range matches {
+		mEnd := m.pos + m.len
+		if m.pos < pos || end < mEnd {
+			continue
+		}
+		b.WriteString(string(runes[pos:m.pos]))
+		b.WriteString(open)
+		b.WriteString(string(runes[m.pos:mEnd]))
+		b.WriteString(close)
+		pos = mEnd
+	}
+	b.WriteString(string(runes[pos:end]))
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+// Search returns messages which have all words and match operators in the
+// query, in descending order of timestamps.
+func (r *IndexReader) Search(q *SearchQuery) ([]*SearchResult, error) {
+	var docs map[indexDoc]*SearchResult
+	for _, word := range q.Words {
+		mp, err := r.searchWord(word)
+		if err != nil {
+			return nil, err
+		}
+		wordLen := len([]rune(word))
+		found := map[indexDoc]*SearchResult{}
+		for channelNumber, mposMap := range mp {
+			for pk, starts := range mposMap {
+				doc := indexDoc{channelNumber: channelNumber, ts: pk.ts}
+				res, ok := found[doc]
+				if !ok {
+					if docs != nil {
+						res, ok = docs[doc]
+						if !ok {
+							continue
+						}
+					} else {
+						res, ok = r.newSearchResult(q, channelNumber, pk)
+						if !ok {
+							continue
+						}
+					}
+					found[doc] = res
+				}
+				for _, start := range starts {
+					res.matches[pk.field] = append(res.matches[pk.field], searchMatch{pos: start, len: wordLen})
+				}
+			}
+		}
+		docs = found
+	}
+
+	results := make([]*SearchResult, 0, len(docs))
+	for _, res := range docs {
+		results = append(results, res)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		ti, tj := TsToDateTime(results[i].Timestamp, time.UTC), TsToDateTime(results[j].Timestamp, time.UTC)
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return results[i].Channel.Number < results[j].Channel.Number
+	})
+	return results, nil
+}
+
+// newSearchResult returns the result of the posting, if it matches operators
+// in the query.
+func (r *IndexReader) newSearchResult(q *SearchQuery, channelNumber int, pk postingKey) (*SearchResult, bool) {
+	ch, ok := r.channels[channelNumber]
+	if !ok || !q.matchChannel(ch) {
+		return nil, false
+	}
+	u := r.users[pk.user]
+	if !q.matchUser(u) {
+		return nil, false
+	}
+	t, err := parseTimestamp(pk.ts, time.UTC)
+	if err != nil || !q.matchTime(t) {
+		return nil, false
+	}
+	return &SearchResult{
+		Channel:   ch,
+		User:      u,
+		Timestamp: pk.ts,
+		matches:   map[indexField][]searchMatch{},
+	}, true
+}
@@ -0,0 +1,116 @@
+package slacklog
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := ParseSearchQuery("hello  from:@Alice in:#general in:C002 before:2020-02-01 after:2020-1-25 world", defaultTimezone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SearchQuery{
+		Words:  []string{"hello", "world"},
+		From:   []string{"alice"},
+		In:     []string{"general", "c002"},
+		Before: time.Date(2020, 2, 1, 0, 0, 0, 0, defaultTimezone()),
+		After:  time.Date(2020, 1, 26, 0, 0, 0, 0, defaultTimezone()),
+	}
+	if diff := cmp.Diff(want, q); diff != "" {
+		t.Errorf("unexpected query: -want +got\n%s", diff)
+	}
+
+	for _, query := range []string{"", "from:@alice", "hello before:2020/01/01"} {
+		if _, err := ParseSearchQuery(query, defaultTimezone()); err == nil {
+			t.Errorf("ParseSearchQuery(%q) should fail", query)
+		}
+	}
+}
+
+func TestIndexReader_Search(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	outDir := filepath.Join(tmpPath, "index")
+	updateTestIndex(t, "testdata/generator/slacklog_data", outDir, true)
+
+	r, err := NewIndexReader(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := r.User(1); !ok || u.ID != "U001" || u.DisplayName != "Alice" {
+		t.Errorf("unexpected user 1: %+v", u)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"he", []string{"1580000200.000300", "1580000000.000100"}},
+		{"hello see", []string{"1580000000.000100"}},
+		{"hello the", nil},
+		{"has joined", []string{"1580000200.000300"}},
+		{"he from:@bob", []string{"1580000200.000300"}},
+		{"he from:@Alice", []string{"1580000000.000100"}},
+		{"he in:#general", []string{"1580000200.000300", "1580000000.000100"}},
+		{"he in:#random", nil},
+		{"he before:2020-01-26", nil},
+		{"message after:2020-02-02", []string{"1580700000.000100"}},
+		{"message after:2020-02-03", nil},
+	} {
+		q, err := ParseSearchQuery(tc.query, defaultTimezone())
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := r.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, res := range results {
+			got = append(got, res.Timestamp)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("unexpected results of %q: -want +got\n%s", tc.query, diff)
+		}
+	}
+
+	q, err := ParseSearchQuery("hello see", defaultTimezone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := r.Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	res := results[0]
+	if res.Channel.ID != "C001" || res.User.ID != "U001" {
+		t.Errorf("unexpected channel or user: %+v %+v", res.Channel, res.User)
+	}
+	if diff := cmp.Diff([]string{"text"}, res.FieldNames()); diff != "" {
+		t.Errorf("unexpected fields: -want +got\n%s", diff)
+	}
+	text := "hello <@U002> see <https://example.com|example>"
+	if got, want := res.Snippet(text, 20, "[", "]"), "[hello] <@U002> [see] <h..."; got != want {
+		t.Errorf("unexpected snippet: want %q, got %q", want, got)
+	}
+}
+
+func TestSearchResult_Snippet_crlf(t *testing.T) {
+	// "bar" is at the 6th character in the text, as the indexer counts "\r\n"
+	// as 2 characters.
+	res := &SearchResult{matches: map[indexField][]searchMatch{
+		fieldText: {{pos: 5, len: 3}},
+	}}
+	if got, want := res.Snippet("foo\r\nbar baz", 20, "[", "]"), "foo  [bar] baz"; got != want {
+		t.Errorf("unexpected snippet: want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,191 @@
+package slacklog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxSitemapURLs : 1つのsitemapに含めることのできるURLの最大数。
+// これを超える場合は複数のsitemapに分割し、sitemap.xmlはそれらを参照する
+// sitemap indexとなる。
+// https://www.sitemaps.org/protocol.html
+const maxSitemapURLs = 50000
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+func sitemapLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// newestTime returns time of the newest message in msgs.
+func newestTime(msgs Messages) time.Time {
+	var newest string
+	for _, msg := range msgs {
+		if msg.Timestamp > newest {
+			newest = msg.Timestamp
+		}
+	}
+	if newest == "" {
+		return time.Time{}
+	}
+	return TsToDateTime(newest, time.UTC)
+}
+
+// generateSitemap generates outDir/sitemap.xml which lists the top index,
+// channel indexes and month pages. lastmod of each page is the time of the
+// newest message in it.
+func (g *HTMLGenerator) generateSitemap(outDir string, channels []Channel) error {
+	SortChannel(channels)
+	var (
+		urls    []sitemapURL
+		newest  time.Time
+		entries []sitemapURL
+	)
+	for _, channel := range channels {
+		var channelNewest time.Time
+		var monthURLs []sitemapURL
+		err := g.s.EachMonth(channel.ID, func(key MessageMonthKey, msgs Messages) error {
+			t := newestTime(msgs)
+			if t.After(channelNewest) {
+				channelNewest = t
+			}
+			monthURLs = append(monthURLs, sitemapURL{
+				Loc:     fmt.Sprintf("%s/%s/%s/%s/", g.baseURL, channel.ID, key.Year(), key.Month()),
+				LastMod: sitemapLastMod(t),
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if channelNewest.After(newest) {
+			newest = channelNewest
+		}
+		entries = append(entries, sitemapURL{
+			Loc:     fmt.Sprintf("%s/%s/", g.baseURL, channel.ID),
+			LastMod: sitemapLastMod(channelNewest),
+		})
+		entries = append(entries, monthURLs...)
+	}
+	urls = append(urls, sitemapURL{
+		Loc:     g.baseURL + "/",
+		LastMod: sitemapLastMod(newest),
+	})
+	urls = append(urls, entries...)
+
+	return g.writeSitemaps(outDir, urls, maxSitemapURLs)
+}
+
+// writeSitemaps writes urls to outDir/sitemap.xml. When the number of urls
+// exceeds limit, the urls are split into outDir/sitemap-${N}.xml and
+// outDir/sitemap.xml becomes a sitemap index.
+func (g *HTMLGenerator) writeSitemaps(outDir string, urls []sitemapURL, limit int) error {
+	if len(urls) <= limit {
+		if err := removeStaleSitemaps(outDir, 0); err != nil {
+			return err
+		}
+		return writeXML(filepath.Join(outDir, "sitemap.xml"), sitemapURLSet{
+			XMLNS: sitemapNS,
+			URLs:  urls,
+		})
+	}
+
+	index := sitemapIndex{XMLNS: sitemapNS}
+	for i := 0; i*limit < len(urls); i++ {
+		end := (i + 1) * limit
+		if end > len(urls) {
+			end = len(urls)
+		}
+		chunk := urls[i*limit : end]
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		err := writeXML(filepath.Join(outDir, name), sitemapURLSet{
+			XMLNS: sitemapNS,
+			URLs:  chunk,
+		})
+		if err != nil {
+			return err
+		}
+		var lastMod string
+		for _, u := range chunk {
+			if u.LastMod > lastMod {
+				lastMod = u.LastMod
+			}
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{
+			Loc:     g.baseURL + "/" + name,
+			LastMod: lastMod,
+		})
+	}
+	if err := removeStaleSitemaps(outDir, len(index.Sitemaps)); err != nil {
+		return err
+	}
+	return writeXML(filepath.Join(outDir, "sitemap.xml"), index)
+}
+
+var reSitemapFilename = regexp.MustCompile(`^sitemap-(\d+)\.xml$`)
+
+// removeStaleSitemaps removes outDir/sitemap-${N}.xml which N is greater than
+// n, which were written by a previous generation with more urls.
+func removeStaleSitemaps(outDir string, n int) error {
+	paths, err := filepath.Glob(filepath.Join(outDir, "sitemap-*.xml"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		match := reSitemapFilename.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			continue
+		}
+		if i, err := strconv.Atoi(match[1]); err != nil || i <= n {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeXML writes v as XML document to a file.
+func writeXML(filename string, v interface{}) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err = f.WriteString("\n")
+	return err
+}
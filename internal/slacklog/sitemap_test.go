@@ -0,0 +1,74 @@
+package slacklog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTMLGenerator_writeSitemaps(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+
+	g := &HTMLGenerator{baseURL: "https://example.com/log"}
+	var urls []sitemapURL
+	for i := 0; i < 5; i++ {
+		urls = append(urls, sitemapURL{
+			Loc:     fmt.Sprintf("https://example.com/log/%d/", i),
+			LastMod: fmt.Sprintf("2020-01-0%dT00:00:00Z", i+1),
+		})
+	}
+	if err := g.writeSitemaps(tmpPath, urls, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal([]byte(readString(t, filepath.Join(tmpPath, "sitemap.xml"))), &index); err != nil {
+		t.Fatal(err)
+	}
+	want := []sitemapURL{
+		{Loc: "https://example.com/log/sitemap-1.xml", LastMod: "2020-01-02T00:00:00Z"},
+		{Loc: "https://example.com/log/sitemap-2.xml", LastMod: "2020-01-04T00:00:00Z"},
+		{Loc: "https://example.com/log/sitemap-3.xml", LastMod: "2020-01-05T00:00:00Z"},
+	}
+	if diff := cmp.Diff(want, index.Sitemaps); diff != "" {
+		t.Fatalf("unexpected sitemap index: -want +got\n%s", diff)
+	}
+
+	var got []sitemapURL
+	for i := 1; i <= 3; i++ {
+		var set sitemapURLSet
+		path := filepath.Join(tmpPath, fmt.Sprintf("sitemap-%d.xml", i))
+		if err := xml.Unmarshal([]byte(readString(t, path)), &set); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, set.URLs...)
+	}
+	if diff := cmp.Diff(urls, got); diff != "" {
+		t.Fatalf("unexpected urls in sitemaps: -want +got\n%s", diff)
+	}
+
+	// a smaller build removes sitemaps which are no longer referred.
+	if err := g.writeSitemaps(tmpPath, urls[:3], 2); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, true, false} {
+		path := filepath.Join(tmpPath, fmt.Sprintf("sitemap-%d.xml", i+1))
+		if got := fileExists(path); got != want {
+			t.Errorf("%s exists: want=%t got=%t", path, want, got)
+		}
+	}
+	if err := g.writeSitemaps(tmpPath, urls[:2], 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if path := filepath.Join(tmpPath, fmt.Sprintf("sitemap-%d.xml", i)); fileExists(path) {
+			t.Errorf("%s is not removed", path)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+//go:build sqlite
+// +build sqlite
+
+package slacklog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// SQLiteのドライバ
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema : ImportSQLiteで作成するデータベースのスキーマ。
+// filesにはメッセージファイル毎のハッシュを保持し、再度インポートした際に変更
+// されたファイルのみを読み込むために用いる。チャンネルIDが空の行は全チャンネ
+// ルで共通のデータ(ユーザ、チャンネル等)を表す。
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	channel_id TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	hash       TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	PRIMARY KEY (channel_id, name)
+);
+CREATE TABLE IF NOT EXISTS messages (
+	channel_id TEXT NOT NULL,
+	file       TEXT NOT NULL,
+	seq        INTEGER NOT NULL,
+	ts         TEXT NOT NULL,
+	thread_ts  TEXT NOT NULL,
+	user       TEXT NOT NULL,
+	subtype    TEXT NOT NULL,
+	text       TEXT NOT NULL,
+	json       TEXT NOT NULL,
+	PRIMARY KEY (channel_id, file, seq)
+);
+CREATE INDEX IF NOT EXISTS messages_ts ON messages (channel_id, ts);
+CREATE INDEX IF NOT EXISTS messages_thread_ts ON messages (channel_id, thread_ts);
+CREATE TABLE IF NOT EXISTS users (
+	seq  INTEGER PRIMARY KEY,
+	id   TEXT NOT NULL,
+	name TEXT NOT NULL,
+	json TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS usergroups (
+	seq    INTEGER PRIMARY KEY,
+	id     TEXT NOT NULL,
+	handle TEXT NOT NULL,
+	json   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS channels (
+	seq  INTEGER PRIMARY KEY,
+	id   TEXT NOT NULL,
+	name TEXT NOT NULL,
+	json TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS emojis (
+	name TEXT PRIMARY KEY,
+	ext  TEXT NOT NULL
+);
+`
+
+// ImportSQLite : dataDirに指定したディレクトリのJSON形式のログデータを、
+// dbPathに指定したSQLiteのデータベースに取り込む。
+// データベースが既に存在する場合は、前回の取り込みから変更されたファイルのみを
+// 読み込み、削除されたファイルのメッセージは削除する。
+// チャンネルはcfg.Channelsに関わらず全て取り込む。
+func ImportSQLite(dataDir string, cfg *Config, dbPath string) error {
+	dsn, err := sqliteDSN(dbPath, "")
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create tables in %s: %w", dbPath, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	im := &sqliteImporter{tx: tx}
+	if err := im.importMetadata(dataDir, filepath.Join(dataDir, cfg.EmojiJSONPath)); err != nil {
+		return err
+	}
+	channels, err := ReadConversations(dataDir)
+	if err != nil {
+		return err
+	}
+	for _, ch := range channels {
+		if err := im.importChannel(dataDir, ch.ID); err != nil {
+			return err
+		}
+	}
+	if err := im.deleteChannels(channels); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqliteImporter struct {
+	tx *sql.Tx
+}
+
+// fileHash returns the hash of the file stored in the database, or an empty
+// string if the file has not been imported.
+func (im *sqliteImporter) fileHash(channelID, name string) (string, error) {
+	var sum string
+	err := im.tx.QueryRow(`SELECT hash FROM files WHERE channel_id = ? AND name = ?`, channelID, name).Scan(&sum)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return sum, err
+}
+
+func (im *sqliteImporter) putFile(channelID, name, sum string, size int64) error {
+	_, err := im.tx.Exec(`INSERT OR REPLACE INTO files (channel_id, name, hash, size) VALUES (?, ?, ?, ?)`, channelID, name, sum, size)
+	return err
+}
+
+// importMetadata imports users, user groups, channels and emojis, which are
+// changed since the last import.
+func (im *sqliteImporter) importMetadata(dataDir, emojiPath string) error {
+	for _, m := range []struct {
+		name     string
+		path     string
+		required bool
+		load     func(path string) error
+		// extra are paths of optional files which are read by load too.
+		extra []string
+	}{
+		{"users", filepath.Join(dataDir, "users.json"), true, im.importUsers, nil},
+		{"usergroups", filepath.Join(dataDir, "usergroups.json"), false, im.importUserGroups, nil},
+		{"channels", filepath.Join(dataDir, "channels.json"), true, im.importChannels, conversationPaths(dataDir)[1:]},
+		{"emojis", emojiPath, false, im.importEmojis, nil},
+	} {
+		sum, err := hashFile(m.path)
+		if err != nil && (m.required || !os.IsNotExist(err)) {
+			return err
+		}
+		for _, path := range m.extra {
+			s, err := hashFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			sum += s
+		}
+		prev, err := im.fileHash("", m.name)
+		if err != nil {
+			return err
+		}
+		if prev == sum && sum != "" {
+			continue
+		}
+		if _, err := im.tx.Exec(`DELETE FROM ` + m.name); err != nil {
+			return err
+		}
+		if sum != "" {
+			if err := m.load(m.path); err != nil {
+				return fmt.Errorf("failed to import %s: %w", m.path, err)
+			}
+		}
+		if err := im.putFile("", m.name, sum, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *sqliteImporter) importUsers(path string) error {
+	var users []User
+	if err := ReadFileAsJSON(path, true, &users); err != nil {
+		return err
+	}
+	for _, u := range users {
+		b, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		if _, err := im.tx.Exec(`INSERT INTO users (id, name, json) VALUES (?, ?, ?)`, u.ID, u.Name, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *sqliteImporter) importUserGroups(path string) error {
+	var groups []UserGroup
+	if err := ReadFileAsJSON(path, true, &groups); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		b, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		if _, err := im.tx.Exec(`INSERT INTO usergroups (id, handle, json) VALUES (?, ?, ?)`, g.ID, g.Handle, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *sqliteImporter) importChannels(path string) error {
+	channels, err := ReadConversations(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	for _, ch := range channels {
+		b, err := json.Marshal(ch)
+		if err != nil {
+			return err
+		}
+		if _, err := im.tx.Exec(`INSERT INTO channels (id, name, json) VALUES (?, ?, ?)`, ch.ID, ch.Name, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *sqliteImporter) importEmojis(path string) error {
+	var nameToExt map[string]string
+	if err := ReadFileAsJSON(path, true, &nameToExt); err != nil {
+		return err
+	}
+	for name, ext := range nameToExt {
+		if _, err := im.tx.Exec(`INSERT INTO emojis (name, ext) VALUES (?, ?)`, name, ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importChannel imports message files of the channel, which are changed
+// since the last import.
+func (im *sqliteImporter) importChannel(dataDir, channelID string) error {
+	dir := filepath.Join(dataDir, channelID)
+	names, err := LogFileNames(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		seen[name] = struct{}{}
+		path := filepath.Join(dir, name)
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		prev, err := im.fileHash(channelID, name)
+		if err != nil {
+			return err
+		}
+		if prev == sum {
+			continue
+		}
+		if err := im.importLogFile(channelID, name, path, sum); err != nil {
+			return err
+		}
+	}
+
+	rows, err := im.tx.Query(`SELECT name FROM files WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := seen[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range removed {
+		if err := im.deleteLogFile(channelID, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *sqliteImporter) importLogFile(channelID, name, path, sum string) error {
+	var raws []json.RawMessage
+	if err := ReadFileAsJSON(path, true, &raws); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	if err := im.deleteLogFile(channelID, name); err != nil {
+		return err
+	}
+	var size int64
+	for i, raw := range raws {
+		var msg Message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %w", path, err)
+		}
+		_, err := im.tx.Exec(`INSERT INTO messages (channel_id, file, seq, ts, thread_ts, user, subtype, text, json) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			channelID, name, i, msg.Timestamp, msg.ThreadTimestamp, msg.User, msg.SubType, msg.Text, string(raw))
+		if err != nil {
+			return err
+		}
+		size += int64(len(raw))
+	}
+	return im.putFile(channelID, name, sum, size)
+}
+
+func (im *sqliteImporter) deleteLogFile(channelID, name string) error {
+	if _, err := im.tx.Exec(`DELETE FROM messages WHERE channel_id = ? AND file = ?`, channelID, name); err != nil {
+		return err
+	}
+	_, err := im.tx.Exec(`DELETE FROM files WHERE channel_id = ? AND name = ?`, channelID, name)
+	return err
+}
+
+// deleteChannels deletes messages of channels which are not in channels.
+func (im *sqliteImporter) deleteChannels(channels []Channel) error {
+	ids := make(map[string]struct{}, len(channels))
+	for _, ch := range channels {
+		ids[ch.ID] = struct{}{}
+	}
+	rows, err := im.tx.Query(`SELECT DISTINCT channel_id FROM files WHERE channel_id != ''`)
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := ids[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range removed {
+		if _, err := im.tx.Exec(`DELETE FROM messages WHERE channel_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := im.tx.Exec(`DELETE FROM files WHERE channel_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteDSN : dbPathを開くためのURI形式のファイル名を返す。"?"や"#"、"%"を含む
+// パスがクエリ等と解釈されないようエスケープする。queryはURIのクエリとなる。
+func sqliteDSN(dbPath, query string) (string, error) {
+	abs, err := filepath.Abs(dbPath)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.ToSlash(abs)
+	if !strings.HasPrefix(path, "/") {
+		// Windowsのドライブ名の前にも"/"が必要
+		path = "/" + path
+	}
+	u := url.URL{Scheme: "file", Path: path, RawQuery: query}
+	return u.String(), nil
+}
+
+// NewSQLiteLogStore : dbPathに指定したSQLiteのデータベースから各テーブルを生成
+// して、LogStoreを生成する。データベースはImportSQLiteで作成する。
+func NewSQLiteLogStore(dbPath string, cfg *Config) (*LogStore, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	dsn, err := sqliteDSN(dbPath, "mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	src := &sqliteLogSource{db: db}
+
+	var users []User
+	if err := src.readRows(`SELECT json FROM users ORDER BY seq`, func() interface{} {
+		users = append(users, User{})
+		return &users[len(users)-1]
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	var groups []UserGroup
+	if err := src.readRows(`SELECT json FROM usergroups ORDER BY seq`, func() interface{} {
+		groups = append(groups, UserGroup{})
+		return &groups[len(groups)-1]
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	var channels []Channel
+	if err := src.readRows(`SELECT json FROM channels ORDER BY seq`, func() interface{} {
+		channels = append(channels, Channel{})
+		return &channels[len(channels)-1]
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	et, err := src.emojiTable()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ut := newUserTable(users)
+	gt := newUserGroupTable(groups)
+	ct := newConversationTable(channels, ut, cfg)
+	return newLogStore(src, ut, gt, ct, et, cfg)
+}
+
+// sqliteLogSource reads a database created by ImportSQLite.
+type sqliteLogSource struct {
+	db *sql.DB
+}
+
+// readRows unmarshals JSON in each row of the query to a value returned by
+// next.
+func (src *sqliteLogSource) readRows(query string, next func() interface{}, args ...interface{}) error {
+	rows, err := src.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(s), next()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (src *sqliteLogSource) emojiTable() (*EmojiTable, error) {
+	rows, err := src.db.Query(`SELECT name, ext FROM emojis`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	et := &EmojiTable{NameToExt: map[string]string{}}
+	for rows.Next() {
+		var name, ext string
+		if err := rows.Scan(&name, &ext); err != nil {
+			return nil, err
+		}
+		et.NameToExt[name] = ext
+	}
+	return et, rows.Err()
+}
+
+func (src *sqliteLogSource) logFileNames(channelID string) ([]string, error) {
+	rows, err := src.db.Query(`SELECT name FROM files WHERE channel_id = ? ORDER BY name`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (src *sqliteLogSource) readLogFile(channelID, name string) (Messages, int64, error) {
+	var size int64
+	err := src.db.QueryRow(`SELECT size FROM files WHERE channel_id = ? AND name = ?`, channelID, name).Scan(&size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s/%s: %w", channelID, name, err)
+	}
+	var msgs Messages
+	err = src.readRows(`SELECT json FROM messages WHERE channel_id = ? AND file = ? ORDER BY seq`, func() interface{} {
+		msg := &Message{}
+		msgs = append(msgs, msg)
+		return msg
+	}, channelID, name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s/%s: %w", channelID, name, err)
+	}
+	return msgs, size, nil
+}
+
+func (src *sqliteLogSource) logFileHashes(channelID string) (map[string]string, error) {
+	rows, err := src.db.Query(`SELECT name, hash FROM files WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hashes := map[string]string{}
+	for rows.Next() {
+		var name, sum string
+		if err := rows.Scan(&name, &sum); err != nil {
+			return nil, err
+		}
+		hashes[name] = sum
+	}
+	return hashes, rows.Err()
+}
+
+func (src *sqliteLogSource) metadataHashes() ([]sourceHash, error) {
+	rows, err := src.db.Query(`SELECT name, hash FROM files WHERE channel_id = '' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hashes []sourceHash
+	for rows.Next() {
+		var h sourceHash
+		if err := rows.Scan(&h.name, &h.hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+func (src *sqliteLogSource) Close() error {
+	return src.db.Close()
+}
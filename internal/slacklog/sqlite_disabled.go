@@ -0,0 +1,20 @@
+//go:build !sqlite
+// +build !sqlite
+
+package slacklog
+
+import "errors"
+
+// errSQLiteDisabled : sqliteタグ無しでビルドした場合にSQLite関連の関数が返す
+// エラー。go-sqlite3はcgoを必要とするため、既定のビルドには含めない。
+var errSQLiteDisabled = errors.New("SQLite is not supported: build with -tags sqlite")
+
+// ImportSQLite : SQLiteに対応していないビルドではエラーを返す。
+func ImportSQLite(dataDir string, cfg *Config, dbPath string) error {
+	return errSQLiteDisabled
+}
+
+// NewSQLiteLogStore : SQLiteに対応していないビルドではエラーを返す。
+func NewSQLiteLogStore(dbPath string, cfg *Config) (*LogStore, error) {
+	return nil, errSQLiteDisabled
+}
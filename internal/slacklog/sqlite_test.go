@@ -0,0 +1,169 @@
+//go:build sqlite
+// +build sqlite
+
+package slacklog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func importTestSQLite(t *testing.T, dataDir, dbPath string) *LogStore {
+	t.Helper()
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportSQLite(dataDir, cfg, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLiteLogStore(dbPath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	return s
+}
+
+// readSiteFiles reads all pages under dir, except the manifest.
+func readSiteFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == manifestFilename {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = readString(t, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSQLiteLogStore(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	js := newTestLogStore(t)
+	s := importTestSQLite(t, "testdata/generator/slacklog_data", filepath.Join(tmpPath, "slacklog.db"))
+
+	keys, err := s.GetMonthKeys("C001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKeys, err := js.GetMonthKeys("C001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantKeys, keys, cmp.AllowUnexported(MessageMonthKey{})); diff != "" {
+		t.Errorf("unexpected keys: -want +got\n%s", diff)
+	}
+	if !s.HasNextMonth("C001", keys[0]) || s.HasPrevMonth("C001", keys[0]) {
+		t.Errorf("unexpected prev/next of %v", keys[0])
+	}
+	if u, ok := s.GetUserByID("U001"); !ok || u.Name != "alice" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+	if diff := cmp.Diff(js.et.NameToExt, s.et.NameToExt); diff != "" {
+		t.Errorf("unexpected emojis: -want +got\n%s", diff)
+	}
+	thread, ok := s.GetThread("C001", "1580000000.000100")
+	if !ok {
+		t.Fatal("thread is not found")
+	}
+	if n := len(thread.Replies()); n != 2 {
+		t.Errorf("unexpected number of replies: %d", n)
+	}
+
+	// 両方のストアから生成したページは同一となる
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]*LogStore{"json": js, "sqlite": s} {
+		g := NewGenerator(store, cfg, NewJSONRenderer())
+		if err := g.Generate(filepath.Join(tmpPath, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff(readSiteFiles(t, filepath.Join(tmpPath, "json")), readSiteFiles(t, filepath.Join(tmpPath, "sqlite"))); diff != "" {
+		t.Errorf("unexpected pages: -json +sqlite\n%s", diff)
+	}
+}
+
+func TestSQLiteLogStore_pathWithQuery(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dir := filepath.Join(tmpPath, "a?b#c%20d")
+	if err := os.Mkdir(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(dir, "slacklog.db")
+	s := importTestSQLite(t, "testdata/generator/slacklog_data", dbPath)
+
+	if u, ok := s.GetUserByID("U001"); !ok || u.Name != "alice" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("database is not created at %s: %v", dbPath, err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(tmpPath, "a*")); len(names) != 1 {
+		t.Errorf("unexpected files are created: %v", names)
+	}
+}
+
+func TestImportSQLite_incremental(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	dbPath := filepath.Join(tmpPath, "slacklog.db")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+	importTestSQLite(t, dataDir, dbPath)
+
+	// 2月のファイルを削除し、1月のファイルを変更する
+	if err := os.Remove(filepath.Join(dataDir, "C001", "2020-02-03.json")); err != nil {
+		t.Fatal(err)
+	}
+	err := ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-01-26.json"), []byte(`[{"type":"message","user":"U001","text":"changed","ts":"1580000000.000100"}]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := importTestSQLite(t, dataDir, dbPath)
+
+	keys, err := s.GetMonthKeys("C001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]MessageMonthKey{{year: 2020, month: 1}}, keys, cmp.AllowUnexported(MessageMonthKey{})); diff != "" {
+		t.Errorf("unexpected keys: -want +got\n%s", diff)
+	}
+	msgs, err := s.GetMonthMessages("C001", keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Text != "changed" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+	if _, ok := s.GetThread("C001", "1580000000.000100"); ok {
+		t.Error("thread should be removed")
+	}
+}
@@ -2,109 +2,459 @@ package slacklog
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
 // LogStore : ログデータを各種テーブルを介して取得するための構造体。
-// MessageTableはチャンネル毎に用意しているためmtsはチャンネルIDをキーとするmap
-// となっている。
+// メッセージはチャンネル・月毎にMessageTableとして必要になった時に読み込み、
+// Config.MemoryLimitMB を超えないよう使われていないものから破棄する。
 type LogStore struct {
-	path string
-	ut   *UserTable
-	ct   *ChannelTable
-	et   *EmojiTable
+	// src is where messages are read from.
+	src logSource
+	ut  *UserTable
+	gt  *UserGroupTable
+	ct  *ChannelTable
+	et  *EmojiTable
 	// key: channel ID
-	mts map[string]*MessageTable
+	logs  map[string]*channelLog
+	cache *monthCache
+	// workspaceDomain is the domain of the Slack workspace.
+	workspaceDomain string
+	// loc and locale are the timezone and the locale of the archive, by
+	// Config.Timezone and Config.Locale.
+	loc    *time.Location
+	locale *locale
 }
 
-// NewLogStore : 各テーブルを生成して、LogStoreを生成する。
+// NewLogStore : dirPathに指定したディレクトリのJSON形式のログデータから各テー
+// ブルを生成して、LogStoreを生成する。
 func NewLogStore(dirPath string, cfg *Config) (*LogStore, error) {
 	ut, err := NewUserTable(filepath.Join(dirPath, "users.json"))
 	if err != nil {
 		return nil, err
 	}
 
-	ct, err := NewChannelTable(filepath.Join(dirPath, "channels.json"), cfg.Channels)
+	gt, err := NewUserGroupTable(filepath.Join(dirPath, "usergroups.json"))
 	if err != nil {
 		return nil, err
 	}
 
-	et, err := NewEmojiTable(filepath.Join(dirPath, cfg.EmojiJSONPath))
+	channels, err := ReadConversations(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	ct := newConversationTable(channels, ut, cfg)
+
+	emojiPath := filepath.Join(dirPath, cfg.EmojiJSONPath)
+	et, err := NewEmojiTable(emojiPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return nil, err
 		}
 		// EmojiTable is not required, so if the file just doesn't exist, continue
 		// processing.
+		et = &EmojiTable{NameToExt: map[string]string{}}
+	}
+
+	src := &jsonLogSource{dir: dirPath, emojiPath: emojiPath}
+	return newLogStore(src, ut, gt, ct, et, cfg)
+}
+
+// OpenLogStore : dbPathが空でなければImportSQLiteで作成したSQLiteのデータベー
+// スから、空であればdirPathのJSON形式のログデータからLogStoreを生成する。
+func OpenLogStore(dirPath, dbPath string, cfg *Config) (*LogStore, error) {
+	if dbPath != "" {
+		return NewSQLiteLogStore(filepath.Clean(dbPath), cfg)
+	}
+	return NewLogStore(dirPath, cfg)
+}
+
+// newLogStore creates a LogStore from tables, which reads messages from src.
+func newLogStore(src logSource, ut *UserTable, gt *UserGroupTable, ct *ChannelTable, et *EmojiTable, cfg *Config) (*LogStore, error) {
+	loc, l, err := cfg.archiveTime()
+	if err != nil {
+		return nil, err
 	}
 
-	mts := make(map[string]*MessageTable, len(ct.Channels))
+	logs := make(map[string]*channelLog, len(ct.Channels))
 	for _, ch := range ct.Channels {
-		mts[ch.ID] = NewMessageTable()
+		logs[ch.ID] = &channelLog{}
+	}
+
+	limit := cfg.MemoryLimitMB
+	if limit <= 0 {
+		limit = defaultMemoryLimitMB
+	}
+
+	domain := cfg.WorkspaceDomain
+	if domain == "" {
+		domain = DefaultWorkspaceDomain
 	}
 
 	return &LogStore{
-		path: dirPath,
-		ut:   ut,
-		ct:   ct,
-		et:   et,
-		mts:  mts,
+		src:             src,
+		ut:              ut,
+		gt:              gt,
+		ct:              ct,
+		et:              et,
+		logs:            logs,
+		cache:           newMonthCache(int64(limit) << 20),
+		workspaceDomain: domain,
+		loc:             loc,
+		locale:          l,
 	}, nil
 }
 
+// Location returns the timezone of the archive, in which dates and times of
+// messages are decided and shown.
+func (s *LogStore) Location() *time.Location {
+	return s.loc
+}
+
+// tsToDateTime converts Ts string to time.Time in the timezone of the
+// archive.
+func (s *LogStore) tsToDateTime(ts string) time.Time {
+	return TsToDateTime(ts, s.loc)
+}
+
+// tsMonthKey returns MessageMonthKey for the month which the timestamp
+// belongs to in the timezone of the archive.
+func (s *LogStore) tsMonthKey(ts string) MessageMonthKey {
+	return tsMonthKey(ts, s.loc)
+}
+
+// WorkspaceDomain returns the domain of the Slack workspace.
+func (s *LogStore) WorkspaceDomain() string {
+	return s.workspaceDomain
+}
+
 // GetChannels gets all stored channgels.
 func (s *LogStore) GetChannels() []Channel {
 	return s.ct.Channels
 }
 
+// FindChannel finds a channel by its ID or name.
+func (s *LogStore) FindChannel(idOrName string) (*Channel, bool) {
+	if c, ok := s.ct.ChannelMap[idOrName]; ok {
+		return c, true
+	}
+	for i, c := range s.ct.Channels {
+		if c.Name == idOrName {
+			return &s.ct.Channels[i], true
+		}
+	}
+	return nil, false
+}
+
 // HasNextMonth returns a channel has next key or not.
 func (s *LogStore) HasNextMonth(channelID string, key MessageMonthKey) bool {
-	if mt, ok := s.mts[channelID]; ok && mt != nil {
-		_, ok := mt.MsgsMap[key.Next()]
-		return ok
-	}
-	return false
+	return s.hasMonth(channelID, key.Next())
 }
 
 // HasPrevMonth returns a channel has previous logs or not.
 func (s *LogStore) HasPrevMonth(channelID string, key MessageMonthKey) bool {
-	if mt, ok := s.mts[channelID]; ok && mt != nil {
-		_, ok := mt.MsgsMap[key.Prev()]
-		return ok
+	return s.hasMonth(channelID, key.Prev())
+}
+
+func (s *LogStore) hasMonth(channelID string, key MessageMonthKey) bool {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
+		return false
 	}
-	return false
+	_, ok := cl.monthSet[key]
+	return ok
 }
 
-// GetMessagesPerMonth gets a messages map for the channel.
-// Messages map have all message split in per month.
-func (s *LogStore) GetMessagesPerMonth(channelID string) (MessagesMap, error) {
-	mt, ok := s.mts[channelID]
-	if !ok {
-		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+// GetMonthKeys returns months which have messages in the channel, in
+// ascending order.
+func (s *LogStore) GetMonthKeys(channelID string) ([]MessageMonthKey, error) {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]MessageMonthKey(nil), cl.months...), nil
+}
+
+// GetMonthMessages returns messages in the channel which are posted in the
+// month, excluding replies in threads.
+func (s *LogStore) GetMonthMessages(channelID string, key MessageMonthKey) (Messages, error) {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
+		return nil, err
+	}
+	mt, err := s.loadMonth(channelID, key, cl)
+	if err != nil {
+		return nil, err
+	}
+	return mt.MsgsMap[key], nil
+}
+
+// GetChannelHistory returns messages which change topic, purpose or name of
+// the channel, or archive the channel, in ascending order.
+func (s *LogStore) GetChannelHistory(channelID string) (Messages, error) {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return cl.history, nil
+}
+
+// GetMessage returns the message of the timestamp in the channel, including
+// replies in threads.
+func (s *LogStore) GetMessage(channelID, ts string) (*Message, bool) {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
+		return nil, false
+	}
+	key := s.tsMonthKey(ts)
+	if _, ok := cl.files[key]; !ok {
+		return nil, false
+	}
+	mt, err := s.loadMonth(channelID, key, cl)
+	if err != nil {
+		return nil, false
+	}
+	if msg, ok := mt.AllMessageMap[ts]; ok {
+		return msg, true
+	}
+	msg, ok := mt.byTs[ts]
+	return msg, ok
+}
+
+// EachMonth calls fn with messages of each month in the channel, in
+// ascending order of months. See GetMonthMessages.
+func (s *LogStore) EachMonth(channelID string, fn func(key MessageMonthKey, msgs Messages) error) error {
+	keys, err := s.GetMonthKeys(channelID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		msgs, err := s.GetMonthMessages(channelID, key)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, msgs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logFileHashes returns hashes of message files of the channel. The key is
+// the name of the file.
+func (s *LogStore) logFileHashes(channelID string) (map[string]string, error) {
+	if _, err := s.channelLog(channelID); err != nil {
+		return nil, err
 	}
-	if err := mt.ReadLogDir(filepath.Join(s.path, channelID), false); err != nil {
+	return s.src.logFileHashes(channelID)
+}
+
+// threadsByMonth returns timestamps of threads which have messages in each
+// month of the channel.
+func (s *LogStore) threadsByMonth(channelID string) (map[MessageMonthKey][]string, error) {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
 		return nil, err
 	}
+	threads := map[MessageMonthKey][]string{}
+	for ts, keys := range cl.threads {
+		for _, key := range keys {
+			threads[key] = append(threads[key], ts)
+		}
+	}
+	for _, list := range threads {
+		sort.Strings(list)
+	}
+	return threads, nil
+}
 
-	return mt.MsgsMap, nil
+// readLogFile reads all messages in the message file of the channel.
+func (s *LogStore) readLogFile(channelID, name string) (Messages, error) {
+	msgs, _, err := s.src.readLogFile(channelID, name)
+	return msgs, err
 }
 
-// GetAllMessages returns all messages as array.
-func (s *LogStore) GetAllMessages(channelID string) (Messages, error) {
-	mt, ok := s.mts[channelID]
+// Close releases resources used to read messages, like a database
+// connection.
+func (s *LogStore) Close() error {
+	if c, ok := s.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *LogStore) channelLog(channelID string) (*channelLog, error) {
+	cl, ok := s.logs[channelID]
 	if !ok {
 		return nil, fmt.Errorf("not found channel: id=%s", channelID)
 	}
-	err := mt.ReadLogDir(filepath.Join(s.path, channelID), true)
+	return cl, nil
+}
+
+// listFiles lists message files of the channel for each month. cl.mu must be
+// locked.
+func (s *LogStore) listFiles(channelID string, cl *channelLog) (map[MessageMonthKey][]string, error) {
+	if cl.files != nil {
+		return cl.files, nil
+	}
+	names, err := s.src.logFileNames(channelID)
+	if err != nil {
+		return nil, err
+	}
+	files := map[MessageMonthKey][]string{}
+	for _, name := range names {
+		key, ok := logFileMonthKey(name)
+		if !ok {
+			continue
+		}
+		files[key] = append(files[key], name)
+	}
+	cl.files = files
+	return files, nil
+}
+
+// indexedChannelLog returns channelLog which months and threads are indexed.
+// To index them, all messages in the channel are read once.
+func (s *LogStore) indexedChannelLog(channelID string) (*channelLog, error) {
+	cl, err := s.channelLog(channelID)
+	if err != nil {
+		return nil, err
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.indexed {
+		return cl, nil
+	}
+	files, err := s.listFiles(channelID, cl)
 	if err != nil {
 		return nil, err
 	}
-	var allMsgs Messages
-	for _, msgs := range mt.MsgsMap {
-		allMsgs = append(allMsgs, msgs...)
+	keys := make([]MessageMonthKey, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].year != keys[j].year {
+			return keys[i].year < keys[j].year
+		}
+		return keys[i].month < keys[j].month
+	})
+
+	cl.months = nil
+	cl.monthSet = map[MessageMonthKey]struct{}{}
+	cl.threads = map[string][]MessageMonthKey{}
+	cl.events = map[string]Messages{}
+	cl.history = nil
+	for _, key := range keys {
+		mt, err := s.loadMonth(channelID, key, cl)
+		if err != nil {
+			return nil, err
+		}
+		cl.history = append(cl.history, mt.channelEvents...)
+		for _, ev := range mt.events {
+			ts := ev.targetTimestamp()
+			cl.events[ts] = append(cl.events[ts], ev)
+		}
+		if len(mt.MsgsMap[key]) > 0 {
+			cl.months = append(cl.months, key)
+			cl.monthSet[key] = struct{}{}
+		}
+		for ts := range mt.ThreadMap {
+			cl.threads[ts] = append(cl.threads[ts], key)
+		}
+	}
+	cl.history.Sort()
+	if len(cl.events) > 0 {
+		// 読み込み済みの月には他の月のイベントが適用されていないため、読み直す
+		s.cache.removeChannel(channelID)
 	}
-	return allMsgs, nil
+	cl.indexed = true
+	return cl, nil
+}
+
+// loadMonth returns a MessageTable which has messages in the files of the
+// month. It is read from the files unless it is cached. cl.files must be
+// listed.
+func (s *LogStore) loadMonth(channelID string, key MessageMonthKey, cl *channelLog) (*MessageTable, error) {
+	ck := monthCacheKey{channelID: channelID, month: key}
+	if mt, ok := s.cache.get(ck); ok {
+		return mt, nil
+	}
+	mt := NewMessageTable()
+	var size int64
+	for _, name := range cl.files[key] {
+		msgs, n, err := s.src.readLogFile(channelID, name)
+		if err != nil {
+			return nil, err
+		}
+		mt.addMessages(key, msgs, false)
+		size += n
+	}
+	for ts, events := range cl.events {
+		if _, ok := mt.byTs[ts]; ok {
+			mt.applyEvents(events)
+		}
+	}
+	s.cache.put(ck, mt, size*jsonMemoryRatio)
+	return mt, nil
+}
+
+// WalkAllMessages calls fn with all messages in each message file of the
+// channel, in date order. Messages which are not shown in pages, like replies
+// in threads or joining the channel, are also included. message_changed and
+// message_deleted events are applied to the messages as pages show them, and
+// the events themselves are not included. The messages are not kept in
+// LogStore.
+func (s *LogStore) WalkAllMessages(channelID string, fn func(msgs Messages) error) error {
+	if _, err := s.channelLog(channelID); err != nil {
+		return err
+	}
+	names, err := s.src.logFileNames(channelID)
+	if err != nil {
+		return err
+	}
+	// 他のファイルのメッセージに対するイベントがあるため、先にイベントのみを
+	// 集める
+	events := map[string]Messages{}
+	for _, name := range names {
+		msgs, _, err := s.src.readLogFile(channelID, name)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if msg.isEvent() {
+				ts := msg.targetTimestamp()
+				events[ts] = append(events[ts], msg)
+			}
+		}
+	}
+	for _, list := range events {
+		list.Sort()
+	}
+	for _, name := range names {
+		msgs, _, err := s.src.readLogFile(channelID, name)
+		if err != nil {
+			return err
+		}
+		replayed := make(Messages, 0, len(msgs))
+		for _, msg := range msgs {
+			if msg.isEvent() {
+				continue
+			}
+			for _, ev := range events[msg.Timestamp] {
+				msg.apply(ev)
+			}
+			replayed = append(replayed, msg)
+		}
+		if err := fn(replayed); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetUserByID gets a user by (user) ID.
@@ -114,6 +464,11 @@ func (s *LogStore) GetUserByID(userID string) (*User, bool) {
 	return u, ok
 }
 
+// GetUsers gets all stored users.
+func (s *LogStore) GetUsers() []User {
+	return s.ut.Users
+}
+
 // GetDisplayNameByUserID gets display name for the user.
 func (s *LogStore) GetDisplayNameByUserID(userID string) string {
 	if user, ok := s.ut.UserMap[userID]; ok {
@@ -136,19 +491,48 @@ func (s *LogStore) GetDisplayNameMap() map[string]string {
 	return ret
 }
 
+// GetUserGroups returns all user groups.
+func (s *LogStore) GetUserGroups() []UserGroup {
+	return s.gt.UserGroups
+}
+
 // GetEmojiMap gets a map from emoji name to its file extension (image type).
 func (s *LogStore) GetEmojiMap() map[string]string {
 	return s.et.NameToExt
 }
 
 // GetThread gets a thread (chain of messages) by channel ID and Ts (thread root's Ts).
+// Replies in other months than the root message are also included.
 func (s *LogStore) GetThread(channelID, ts string) (*Thread, bool) {
-	mt, ok := s.mts[channelID]
-	if !ok {
+	cl, err := s.indexedChannelLog(channelID)
+	if err != nil {
 		return nil, false
 	}
-	if t, ok := mt.ThreadMap[ts]; ok {
-		return t, true
+	months := cl.threads[ts]
+
+	var threads []*Thread
+	for _, key := range months {
+		mt, err := s.loadMonth(channelID, key, cl)
+		if err != nil {
+			return nil, false
+		}
+		if t, ok := mt.ThreadMap[ts]; ok {
+			threads = append(threads, t)
+		}
 	}
-	return nil, false
+	switch len(threads) {
+	case 0:
+		return nil, false
+	case 1:
+		return threads[0], true
+	}
+	merged := &Thread{}
+	for _, t := range threads {
+		if t.rootMsg != nil {
+			merged.rootMsg = t.rootMsg
+		}
+		merged.replies = append(merged.replies, t.replies...)
+	}
+	merged.replies.Sort()
+	return merged, true
 }
@@ -0,0 +1,287 @@
+package slacklog
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestLogStore(t *testing.T) *LogStore {
+	t.Helper()
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore("testdata/generator/slacklog_data", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLogStore_GetMonthKeys(t *testing.T) {
+	s := newTestLogStore(t)
+
+	keys, err := s.GetMonthKeys("C001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MessageMonthKey{{year: 2020, month: 1}, {year: 2020, month: 2}}
+	if diff := cmp.Diff(want, keys, cmp.AllowUnexported(MessageMonthKey{})); diff != "" {
+		t.Errorf("unexpected keys: -want +got\n%s", diff)
+	}
+	if !s.HasNextMonth("C001", want[0]) || s.HasPrevMonth("C001", want[0]) {
+		t.Errorf("unexpected prev/next of %v", want[0])
+	}
+	if s.HasNextMonth("C001", want[1]) || !s.HasPrevMonth("C001", want[1]) {
+		t.Errorf("unexpected prev/next of %v", want[1])
+	}
+	if _, err := s.GetMonthKeys("C999"); err == nil {
+		t.Error("GetMonthKeys should fail for an unknown channel")
+	}
+}
+
+func TestLogStore_evictsMonths(t *testing.T) {
+	s := newTestLogStore(t)
+	// 1ヶ月分しか保持できない
+	s.cache.limit = 1
+
+	jan, err := s.GetMonthMessages("C001", MessageMonthKey{year: 2020, month: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jan) != 1 || jan[0].Timestamp != "1580000000.000100" {
+		t.Fatalf("unexpected messages in January: %+v", jan)
+	}
+
+	// 返信が別の月にあるスレッドも読み込める
+	thread, ok := s.GetThread("C001", "1580000000.000100")
+	if !ok {
+		t.Fatal("thread is not found")
+	}
+	var replies []string
+	for _, msg := range thread.Replies() {
+		replies = append(replies, msg.Timestamp)
+	}
+	if diff := cmp.Diff([]string{"1580000100.000200", "1580700100.000200"}, replies); diff != "" {
+		t.Errorf("unexpected replies: -want +got\n%s", diff)
+	}
+	if thread.RootText() == "" {
+		t.Error("root message of the thread is not found")
+	}
+	if n := s.cache.len(); n != 1 {
+		t.Errorf("cache should have only one month: %d", n)
+	}
+
+	feb, err := s.GetMonthMessages("C001", MessageMonthKey{year: 2020, month: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feb) != 1 || feb[0].Timestamp != "1580700000.000100" {
+		t.Fatalf("unexpected messages in February: %+v", feb)
+	}
+}
+
+func TestLogStore_WalkAllMessages(t *testing.T) {
+	s := newTestLogStore(t)
+
+	var got []string
+	err := s.WalkAllMessages("C001", func(msgs Messages) error {
+		for _, msg := range msgs {
+			got = append(got, msg.Timestamp)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1580000000.000100", "1580000100.000200", "1580000200.000300", "1580700000.000100", "1580700100.000200"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected messages: -want +got\n%s", diff)
+	}
+	if n := s.cache.len(); n != 0 {
+		t.Errorf("WalkAllMessages should not cache messages: %d", n)
+	}
+}
+
+func TestLogStore_WalkAllMessages_events(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	dataDir := filepath.Join(tmpPath, "slacklog_data")
+	copyDir(t, "testdata/generator/slacklog_data", dataDir)
+	// a message with a file, which is deleted in the next month.
+	err := ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-01-27.json"), []byte(`[
+ {"type":"message","user":"U001","text":"file","ts":"1580100000.000100","files":[{"id":"F001","name":"a.png"}]}]
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dataDir, "C001", "2020-02-04.json"), []byte(`[
+ {"type":"message","subtype":"message_deleted","hidden":true,"deleted_ts":"1580100000.000100","ts":"1580800000.000100"}]
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore(dataDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	err = s.WalkAllMessages("C001", func(msgs Messages) error {
+		for _, msg := range msgs {
+			if msg.SubType == "message_deleted" {
+				t.Errorf("event is walked: %s", msg.Timestamp)
+			}
+			if msg.Timestamp != "1580100000.000100" {
+				continue
+			}
+			found = true
+			if !msg.Deleted || len(msg.Files) != 0 {
+				t.Errorf("deleted message keeps files: %+v", msg.Files)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("deleted message is not walked")
+	}
+}
+
+func TestMonthCache_lru(t *testing.T) {
+	c := newMonthCache(3)
+	key := func(m int) monthCacheKey {
+		return monthCacheKey{channelID: "C001", month: MessageMonthKey{year: 2020, month: m}}
+	}
+	c.put(key(1), NewMessageTable(), 1)
+	c.put(key(2), NewMessageTable(), 1)
+	c.put(key(3), NewMessageTable(), 1)
+	// 1月を使うと2月が最も古くなる
+	if _, ok := c.get(key(1)); !ok {
+		t.Fatal("January should be cached")
+	}
+	c.put(key(4), NewMessageTable(), 1)
+	if _, ok := c.get(key(2)); ok {
+		t.Error("February should be evicted")
+	}
+	for _, m := range []int{1, 3, 4} {
+		if _, ok := c.get(key(m)); !ok {
+			t.Errorf("month %d should be cached", m)
+		}
+	}
+	// 上限より大きくても最後に追加したものは保持する
+	c.put(key(5), NewMessageTable(), 10)
+	if n := c.len(); n != 1 {
+		t.Errorf("cache should have only the last month: %d", n)
+	}
+	if _, ok := c.get(key(5)); !ok {
+		t.Error("the last month should be cached")
+	}
+}
+
+func TestLogStore_conversationTypes(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	copyDir(t, "testdata/generator/slacklog_data", tmpPath)
+	for name, content := range map[string]string{
+		"groups.json": `[{"id":"G001","name":"secret","created":1577836800,"creator":"U001","is_archived":false,"members":["U001"]}]`,
+		"mpims.json":  `[{"id":"G002","name":"mpdm-alice--bob--carol-1","created":1577836800,"creator":"U001","is_archived":false,"members":["U001","U002"]}]`,
+		"dms.json":    `[{"id":"D001","created":1577836800,"members":["U001","U002"]}]`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpPath, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{"default", Config{Channels: []string{"*"}}, []string{"#general"}},
+		{"private channels", Config{Channels: []string{"*"}, PrivateChannels: true}, []string{"#general", "🔒secret"}},
+		{"all", Config{Channels: []string{"*"}, PrivateChannels: true, GroupDMs: true, DMs: true}, []string{"alice, bob", "#general", "alice, bob, carol", "🔒secret"}},
+		{"whitelist", Config{Channels: []string{"dm-alice--bob"}, DMs: true}, []string{"alice, bob"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewLogStore(tmpPath, &tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, ch := range s.GetChannels() {
+				got = append(got, ch.DisplayName())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected channels: -want +got\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLogStore_replaysEvents(t *testing.T) {
+	tmpPath := createTmpDir(t)
+	defer t.Cleanup(func() {
+		cleanupTmpDir(t, tmpPath)
+	})
+	copyDir(t, "testdata/generator/slacklog_data", tmpPath)
+	// 新しい順に並んだファイルでも、前のメッセージに適用される
+	err := ioutil.WriteFile(filepath.Join(tmpPath, "C001", "2020-02-04.json"), []byte(`[
+ {"type":"message","subtype":"message_deleted","hidden":true,"deleted_ts":"1580000100.000200","ts":"1580790000.000300"},
+ {"type":"message","subtype":"message_changed","hidden":true,"ts":"1580780000.000200","message":{"type":"message","user":"U002","text":"feb message (fixed)","ts":"1580700000.000100","edited":{"user":"U002","ts":"1580780000.000000"}}},
+ {"type":"message","subtype":"message_changed","hidden":true,"ts":"1580770000.000100","message":{"type":"message","user":"U001","text":"first edit","ts":"1580000000.000100","thread_ts":"1580000000.000100","edited":{"user":"U001","ts":"1580770000.000000"}}}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig("testdata/generator/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLogStore(tmpPath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jan, err := s.GetMonthMessages("C001", MessageMonthKey{year: 2020, month: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jan) != 1 || jan[0].Text != "first edit" || jan[0].Edited == nil {
+		t.Fatalf("the message in January is not changed: %+v", jan)
+	}
+	if len(jan[0].History) != 1 || jan[0].History[0].Text == "first edit" {
+		t.Errorf("unexpected history: %+v", jan[0].History)
+	}
+
+	feb, err := s.GetMonthMessages("C001", MessageMonthKey{year: 2020, month: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feb) != 1 || feb[0].Text != "feb message (fixed)" {
+		t.Errorf("the message in February is not changed: %+v", feb)
+	}
+
+	thread, ok := s.GetThread("C001", "1580000000.000100")
+	if !ok {
+		t.Fatal("thread is not found")
+	}
+	replies := thread.Replies()
+	if len(replies) != 2 || !replies[0].Deleted || replies[0].Text != "" || replies[1].Deleted {
+		t.Errorf("the reply is not deleted: %+v", replies)
+	}
+}
@@ -0,0 +1,113 @@
+package slacklog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TextRenderer : ログデータをプレーンテキスト形式で出力するRenderer。
+type TextRenderer struct {
+	s *LogStore
+	c *TextConverter
+}
+
+var _ Renderer = (*TextRenderer)(nil)
+
+// NewTextRenderer creates a TextRenderer.
+func NewTextRenderer(s *LogStore) *TextRenderer {
+	return &TextRenderer{
+		s: s,
+		c: newStoreTextConverter(s),
+	}
+}
+
+// Name returns "text".
+func (r *TextRenderer) Name() string {
+	return "text"
+}
+
+// Filename returns "index.txt".
+func (r *TextRenderer) Filename() string {
+	return "index.txt"
+}
+
+// Inputs returns nothing.
+func (r *TextRenderer) Inputs() []string {
+	return nil
+}
+
+// RenderIndex writes names of channels.
+func (r *TextRenderer) RenderIndex(path string, channels []Channel) error {
+	SortChannel(channels)
+	return writeLines(path, func(w *bufio.Writer) {
+		for _, channel := range channels {
+			fmt.Fprintf(w, "%s\t%s/\n", channel.DisplayName(), channel.ID)
+		}
+	})
+}
+
+// RenderChannelIndex writes months in the channel.
+func (r *TextRenderer) RenderChannelIndex(path string, channel Channel, keys []MessageMonthKey) error {
+	return writeLines(path, func(w *bufio.Writer) {
+		fmt.Fprintf(w, "%s\n\n", channel.DisplayName())
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s-%s\t%s/%s/\n", key.Year(), key.Month(), key.Year(), key.Month())
+		}
+	})
+}
+
+// RenderMonth writes messages in the month, with replies of threads.
+func (r *TextRenderer) RenderMonth(path string, channel Channel, key MessageMonthKey, msgs Messages) error {
+	return writeLines(path, func(w *bufio.Writer) {
+		fmt.Fprintf(w, "%s %s-%s\n", channel.DisplayName(), key.Year(), key.Month())
+		for _, msg := range msgs {
+			if !msg.isVisible() {
+				continue
+			}
+			w.WriteString("\n")
+			r.writeMessage(w, msg, "")
+			if thread, ok := r.s.GetThread(channel.ID, msg.Timestamp); ok && msg.IsRootOfThread() {
+				for _, reply := range thread.Replies() {
+					r.writeMessage(w, reply, "    ")
+				}
+			}
+		}
+	})
+}
+
+// RenderThread writes messages in the thread.
+func (r *TextRenderer) RenderThread(path string, channel Channel, key MessageMonthKey, root *Message, replies Messages) error {
+	return writeLines(path, func(w *bufio.Writer) {
+		fmt.Fprintf(w, "%s\n\n", channel.DisplayName())
+		r.writeMessage(w, root, "")
+		for _, reply := range replies {
+			r.writeMessage(w, reply, "    ")
+		}
+	})
+}
+
+func (r *TextRenderer) writeMessage(w *bufio.Writer, msg *Message, indent string) {
+	name := msg.Username
+	if name == "" {
+		name = r.s.GetDisplayNameByUserID(msg.User)
+	}
+	t := r.s.tsToDateTime(msg.Timestamp).Format("2006-01-02 15:04:05")
+	fmt.Fprintf(w, "%s%s %s:\n", indent, t, name)
+	for _, line := range strings.Split(r.c.ToPlainText(msg.Text), "\n") {
+		fmt.Fprintf(w, "%s  %s\n", indent, line)
+	}
+}
+
+// writeLines creates a file and writes contents by fn.
+func writeLines(filename string, fn func(w *bufio.Writer)) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fn(w)
+	return w.Flush()
+}
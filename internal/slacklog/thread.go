@@ -12,9 +12,9 @@ type Thread struct {
 	replies Messages
 }
 
-// LastReplyTime returns last replied time for the thread.
-func (th Thread) LastReplyTime() time.Time {
-	return TsToDateTime(th.replies[len(th.replies)-1].Timestamp)
+// LastReplyTime returns last replied time for the thread in loc.
+func (th Thread) LastReplyTime(loc *time.Location) time.Time {
+	return TsToDateTime(th.replies[len(th.replies)-1].Timestamp, loc)
 }
 
 // ReplyCount return counts of replied messages.
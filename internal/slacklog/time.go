@@ -3,48 +3,348 @@ package slacklog
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// TsToDateTime converts Ts string to time.Time.
-func TsToDateTime(ts string) time.Time {
-	t := strings.Split(ts, ".")
-	if len(t) != 2 {
+// TsToDateTime converts Ts string to time.Time in loc.
+func TsToDateTime(ts string, loc *time.Location) time.Time {
+	t, err := parseTimestamp(ts, loc)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
 		return time.Time{}
 	}
+	return t
+}
+
+// parseTimestamp converts Ts string to time.Time in loc. It returns an error
+// for an invalid timestamp.
+func parseTimestamp(ts string, loc *time.Location) (time.Time, error) {
+	t := strings.Split(ts, ".")
+	if len(t) != 2 {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", ts)
+	}
 	sec, err := strconv.ParseInt(t[0], 10, 64)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
-		return time.Time{}
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", ts)
 	}
 	nsec, err := strconv.ParseInt(t[1], 10, 64)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
-		return time.Time{}
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", ts)
+	}
+	return time.Unix(sec, nsec).In(loc), nil
+}
+
+const (
+	// DefaultTimezone is the timezone of the archive when Config.Timezone is
+	// not specified.
+	DefaultTimezone = "Asia/Tokyo"
+	// DefaultLocale is the locale of the archive when Config.Locale is not
+	// specified.
+	DefaultLocale = "ja"
+)
+
+func defaultTimezone() *time.Location {
+	loc, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		// タイムゾーンのデータベースが無い環境では固定のオフセットを用いる
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}
+
+// LoadLocation returns the timezone of the archive by an IANA Time Zone name
+// like "Asia/Tokyo". An empty name means DefaultTimezone.
+func LoadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" || timezone == DefaultTimezone {
+		return defaultTimezone(), nil
 	}
-	japan, err := time.LoadLocation("Asia/Tokyo")
+	loc, err := time.LoadLocation(timezone)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
-		return time.Time{}
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return loc, nil
+}
+
+// loadLocale returns the locale of the archive by its name, "ja" or "en". An
+// empty name means DefaultLocale.
+func loadLocale(name string) (*locale, error) {
+	if name == "" {
+		name = DefaultLocale
+	}
+	l, ok := locales[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown locale: %s", name)
+	}
+	return l, nil
+}
+
+// locale is a set of formats to show times, and labels which are shown in
+// pages.
+type locale struct {
+	// name is the key in locales.
+	name string
+	// date, dateTime and dateTimeSecs are layouts of time.Format with the
+	// year.
+	date         string
+	dateTime     string
+	dateTimeSecs string
+	// monthDayTime is a layout without the year, and dayTime is a layout
+	// without the year and the month. See levelOfDetailTime.
+	monthDayTime string
+	dayTime      string
+	dateShort    string
+	dateLong     func(t time.Time) string
+	month        func(year int, month time.Month) string
+	// labels are formats of texts which are generated by Go, and by the
+	// "label" function in templates. See label().
+	labels map[string]string
+	// search is labels for search.js, which are written to locale.json.
+	search searchLabels
+}
+
+// searchLabels are labels shown by search.js. {name} in them are replaced
+// with values by search.js.
+type searchLabels struct {
+	// Title, Button and Help are texts of search.html. Help is HTML.
+	Title  string `json:"title"`
+	Button string `json:"button"`
+	Help   string `json:"help"`
+	// Fields are names of indexField, in the order of their values.
+	Fields []string `json:"fields"`
+	// NotIndexFile is an error for a file without indexFileMagic. {key}
+	NotIndexFile string `json:"notIndexFile"`
+	// UnsupportedVersion is an error for an index of another format version.
+	// {version}, {key}
+	UnsupportedVersion string `json:"unsupportedVersion"`
+	// InvalidDate is an error for a date of before: and after:. {value}
+	InvalidDate string `json:"invalidDate"`
+	// NoWords is an error for a query without words.
+	NoWords string `json:"noWords"`
+	// Found is the number of found messages. {count}, {seconds}
+	Found string `json:"found"`
+	// Failed is shown for errors. {error}
+	Failed string `json:"failed"`
+}
+
+var japaneseWeekdays = []string{"日", "月", "火", "水", "木", "金", "土"}
+
+// locales are supported locales of the archive. The key is the name used in
+// Config.Locale.
+var locales = map[string]*locale{
+	"ja": {
+		name:         "ja",
+		date:         "2006年1月2日",
+		dateTime:     "2006年1月2日 15:04",
+		dateTimeSecs: "2006年1月2日 15:04:05",
+		monthDayTime: "1月2日 15:04:05",
+		dayTime:      "2日 15:04:05",
+		dateShort:    "2006/01/02",
+		dateLong: func(t time.Time) string {
+			return t.Format("2006年1月2日") + "(" + japaneseWeekdays[t.Weekday()] + ")"
+		},
+		month: func(year int, month time.Month) string {
+			return fmt.Sprintf("%4d年%02d月", year, int(month))
+		},
+		labels: map[string]string{
+			"deleted_message": "このメッセージは削除されました。",
+			"edit_history":    "編集履歴",
+			"topic_cleared":   "%[1]s がトピックを削除しました",
+			"topic":           "%[1]s がトピックを「%[2]s」に設定しました",
+			"purpose_cleared": "%[1]s がチャンネルの説明を削除しました",
+			"purpose":         "%[1]s がチャンネルの説明を「%[2]s」に設定しました",
+			"name":            "%[1]s がチャンネル名を #%[2]s から #%[3]s に変更しました",
+			"archive":         "%[1]s がチャンネルをアーカイブしました",
+			"unarchive":       "%[1]s がチャンネルのアーカイブを解除しました",
+			// labels in templates
+			"about":             "vim-jp/slacklog について",
+			"thread":            "スレッド",
+			"show_in_log":       "ログで表示",
+			"show_thread":       "スレッドを単独で表示",
+			"download":          "ダウンロード: %[1]s(%[2]s)",
+			"replies":           "%[1]d 件の返信",
+			"last_reply":        "最終返信:%[1]s",
+			"replied_to_thread": "このスレッドに返信しました :",
+			"also_sent":         "チャンネルにも投稿済",
+			"pins":              "ピン留め",
+			"channel_history":   "チャンネルの履歴",
+			"user_channels":     "発言したチャンネル",
+			"message_count":     "%[1]d 件",
+			"no_messages":       "発言はありません",
+			"user_threads":      "開始したスレッド",
+			"user_messages":     "最近の発言",
+		},
+		search: searchLabels{
+			Title:              "ログ検索",
+			Button:             "検索",
+			Help:               "<code>from:@ユーザ名</code>、<code>in:#チャンネル名</code>、<code>before:YYYY-MM-DD</code>、<code>after:YYYY-MM-DD</code> で絞り込めます。",
+			Fields:             []string{"本文", "添付", "ファイル名", "スニペット", "ブロック"},
+			NotIndexFile:       "索引ファイルではありません: {key}",
+			UnsupportedVersion: "索引ファイルの形式 ({version}) に対応していません: {key}",
+			InvalidDate:        "日付は YYYY-MM-DD の形式で指定してください: {value}",
+			NoWords:            "検索する語を入力してください",
+			Found:              "{count} 件ヒットしました ({seconds} 秒)",
+			Failed:             "検索中にエラーが発生しました: {error}",
+		},
+	},
+	"en": {
+		name:         "en",
+		date:         "Jan 2, 2006",
+		dateTime:     "Jan 2, 2006 15:04",
+		dateTimeSecs: "Jan 2, 2006 15:04:05",
+		monthDayTime: "Jan 2 15:04:05",
+		dayTime:      "Mon 2 15:04:05",
+		dateShort:    "01/02/2006",
+		dateLong: func(t time.Time) string {
+			return t.Format("Monday, January 2, 2006")
+		},
+		month: func(year int, month time.Month) string {
+			return fmt.Sprintf("%s %d", month, year)
+		},
+		labels: map[string]string{
+			"deleted_message": "This message was deleted.",
+			"edit_history":    "Edit history",
+			"topic_cleared":   "%[1]s cleared the channel topic",
+			"topic":           "%[1]s set the channel topic: %[2]s",
+			"purpose_cleared": "%[1]s cleared the channel description",
+			"purpose":         "%[1]s set the channel description: %[2]s",
+			"name":            "%[1]s renamed the channel from #%[2]s to #%[3]s",
+			"archive":         "%[1]s archived the channel",
+			"unarchive":       "%[1]s unarchived the channel",
+			// labels in templates
+			"about":             "About vim-jp/slacklog",
+			"thread":            "Thread",
+			"show_in_log":       "View in log",
+			"show_thread":       "View thread",
+			"download":          "Download: %[1]s (%[2]s)",
+			"replies":           "%[1]d replies",
+			"last_reply":        "Last reply: %[1]s",
+			"replied_to_thread": "replied to a thread:",
+			"also_sent":         "Also sent to the channel",
+			"pins":              "Pinned",
+			"channel_history":   "Channel history",
+			"user_channels":     "Channels",
+			"message_count":     "%[1]d messages",
+			"no_messages":       "No messages",
+			"user_threads":      "Started threads",
+			"user_messages":     "Recent messages",
+		},
+		search: searchLabels{
+			Title:              "Search logs",
+			Button:             "Search",
+			Help:               "Narrow down by <code>from:@user</code>, <code>in:#channel</code>, <code>before:YYYY-MM-DD</code> and <code>after:YYYY-MM-DD</code>.",
+			Fields:             []string{"text", "attachment", "file name", "snippet", "block"},
+			NotIndexFile:       "not an index file: {key}",
+			UnsupportedVersion: "unsupported index format ({version}): {key}",
+			InvalidDate:        "dates must be YYYY-MM-DD: {value}",
+			NoWords:            "enter words to search",
+			Found:              "{count} messages found ({seconds} seconds)",
+			Failed:             "failed to search: {error}",
+		},
+	},
+}
+
+// label formats the label of the name with args. It returns the name for an
+// unknown label.
+func (l *locale) label(name string, args ...interface{}) string {
+	format, ok := l.labels[name]
+	if !ok {
+		return name
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func (l *locale) formatDate(t time.Time) string {
+	return t.Format(l.date)
+}
+
+func (l *locale) formatDateShort(t time.Time) string {
+	return t.Format(l.dateShort)
+}
+
+func (l *locale) formatDateLong(t time.Time) string {
+	return l.dateLong(t)
+}
+
+// formatDateTime formats a time in minutes with the date.
+func (l *locale) formatDateTime(t time.Time) string {
+	return t.Format(l.dateTime)
+}
+
+// formatDateTimeSecs formats a time in seconds with the date.
+func (l *locale) formatDateTimeSecs(t time.Time) string {
+	return t.Format(l.dateTimeSecs)
+}
+
+// formatDayTime formats a time in seconds with the day, for messages in
+// month pages.
+func (l *locale) formatDayTime(t time.Time) string {
+	return t.Format(l.dayTime)
+}
+
+// formatMonth formats a month like "2020年01月".
+func (l *locale) formatMonth(key MessageMonthKey) string {
+	return l.month(key.year, time.Month(key.month))
+}
+
+// slackDateFormats maps tokens in a format of `<!date>` to functions which
+// format a time. Relative formats like {date_pretty} and {ago} are formatted
+// absolutely, because the archive is read long after.
+// https://api.slack.com/reference/surfaces/formatting#date-formatting
+var slackDateFormats = map[string]func(l *locale, t time.Time) string{
+	"{date_num}": func(_ *locale, t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+	"{date}":              (*locale).formatDate,
+	"{date_pretty}":       (*locale).formatDate,
+	"{date_short}":        (*locale).formatDateShort,
+	"{date_short_pretty}": (*locale).formatDateShort,
+	"{date_long}":         (*locale).formatDateLong,
+	"{date_long_pretty}":  (*locale).formatDateLong,
+	"{time}": func(_ *locale, t time.Time) string {
+		return t.Format("15:04")
+	},
+	"{time_secs}": func(_ *locale, t time.Time) string {
+		return t.Format("15:04:05")
+	},
+	"{ago}": (*locale).formatDateTime,
+}
+
+var reSlackDateToken = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// formatSlackDate formats a UNIX time in seconds by a format of `<!date>`, in
+// loc. It returns false for an invalid time.
+func (l *locale) formatSlackDate(unix, format string, loc *time.Location) (string, bool) {
+	sec, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return "", false
 	}
-	return time.Unix(sec, nsec).In(japan)
+	t := time.Unix(sec, 0).In(loc)
+	return reSlackDateToken.ReplaceAllStringFunc(format, func(token string) string {
+		if f, ok := slackDateFormats[token]; ok {
+			return f(l, t)
+		}
+		return token
+	}), true
 }
 
-// LevelOfDetailTime returns a label string which represents time.  The
+// levelOfDetailTime returns a label string which represents time.  The
 // resolution of the string is determined by differece from base time in 4
 // levels.
-func LevelOfDetailTime(target, base time.Time) string {
+func (l *locale) levelOfDetailTime(target, base time.Time) string {
 	if target.Year() != base.Year() {
-		return target.Format("2006年1月2日 15:04:05")
+		return l.formatDateTimeSecs(target)
 	}
 	if target.Month() != base.Month() {
-		return target.Format("1月2日 15:04:05")
+		return target.Format(l.monthDayTime)
 	}
 	if target.Day() != base.Day() {
-		return target.Format("2日 15:04:05")
+		return l.formatDayTime(target)
 	}
 	return target.Format("15:04:05")
 }
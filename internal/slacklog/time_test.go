@@ -0,0 +1,65 @@
+package slacklog
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfig_archiveTime(t *testing.T) {
+	cfg := &Config{Timezone: "America/New_York", Locale: "en"}
+	loc, l, err := cfg.archiveTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2020-01-26 09:53:20 in Asia/Tokyo
+	ts := "1580000000.000100"
+	if got, want := TsToDateTime(ts, loc).Format("2006-01-02 15:04"), "2020-01-25 19:53"; got != want {
+		t.Errorf("TsToDateTime(%q) = %q, want %q", ts, got, want)
+	}
+	key := tsMonthKey(ts, loc)
+	if got, want := l.formatMonth(key), "January 2020"; got != want {
+		t.Errorf("formatMonth() = %q, want %q", got, want)
+	}
+	base := TsToDateTime("1579000000.000000", loc)
+	if got, want := l.levelOfDetailTime(TsToDateTime(ts, loc), base), "Sat 25 19:53:20"; got != want {
+		t.Errorf("levelOfDetailTime() = %q, want %q", got, want)
+	}
+	if got, _ := l.formatSlackDate("1580000000", "{date_long} {time}", loc); got != "Saturday, January 25, 2020 19:53" {
+		t.Errorf("formatSlackDate() = %q", got)
+	}
+	if got, want := l.label("name", "alice", "old", "new"), "alice renamed the channel from #old to #new"; got != want {
+		t.Errorf("label() = %q, want %q", got, want)
+	}
+
+	for _, cfg := range []*Config{
+		{Locale: "fr"},
+		{Timezone: "Nowhere/Unknown"},
+	} {
+		if _, _, err := cfg.archiveTime(); err == nil {
+			t.Errorf("archiveTime() succeeded with %+v", cfg)
+		}
+	}
+}
+
+func TestLocales_labels(t *testing.T) {
+	names := func(l *locale) []string {
+		var names []string
+		for name := range l.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	want := names(locales[DefaultLocale])
+	for name, l := range locales {
+		if diff := cmp.Diff(want, names(l)); diff != "" {
+			t.Errorf("labels of %s differ from %s: -want +got\n%s", name, DefaultLocale, diff)
+		}
+		if got := len(l.search.Fields); got != int(fieldBlocks)+1 {
+			t.Errorf("%s has %d search field labels", name, got)
+		}
+	}
+}
@@ -20,6 +20,10 @@ func NewUserTable(path string) (*UserTable, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newUserTable(users), nil
+}
+
+func newUserTable(users []User) *UserTable {
 	userMap := make(map[string]*User, len(users))
 	for i, u := range users {
 		pu := &users[i]
@@ -28,7 +32,7 @@ func NewUserTable(path string) (*UserTable, error) {
 			userMap[u.Profile.BotID] = pu
 		}
 	}
-	return &UserTable{users, userMap}, nil
+	return &UserTable{users, userMap}
 }
 
 // User : ユーザ
@@ -0,0 +1,40 @@
+package slacklog
+
+import (
+	"os"
+
+	"github.com/slack-go/slack"
+)
+
+// UserGroupTable : ユーザグループのデータを保持する。
+// UserGroupMapはユーザグループIDをキーとするmapとなっている。
+type UserGroupTable struct {
+	UserGroups []UserGroup
+	// key: user group ID
+	UserGroupMap map[string]*UserGroup
+}
+
+// NewUserGroupTable : pathに指定したJSON形式のユーザグループデータを読み込み、
+// UserGroupTableを生成する。
+// ユーザグループのデータは必須ではないため、ファイルが存在しない場合は空の
+// UserGroupTableを返す。
+func NewUserGroupTable(path string) (*UserGroupTable, error) {
+	var groups []UserGroup
+	err := ReadFileAsJSON(path, true, &groups)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return newUserGroupTable(groups), nil
+}
+
+func newUserGroupTable(groups []UserGroup) *UserGroupTable {
+	groupMap := make(map[string]*UserGroup, len(groups))
+	for i, g := range groups {
+		groupMap[g.ID] = &groups[i]
+	}
+	return &UserGroupTable{groups, groupMap}
+}
+
+// UserGroup : ユーザグループ
+// fetch-usersで取得したusergroups.jsonの中身を保持する。
+type UserGroup slack.UserGroup
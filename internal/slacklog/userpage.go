@@ -0,0 +1,223 @@
+package slacklog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// maxUserRecentItems : ユーザページに表示する最近のメッセージ・スレッドの最大
+// 数。
+const maxUserRecentItems = 20
+
+// UserActivity : ユーザのチャンネル毎の発言数。
+type UserActivity struct {
+	Channel Channel
+	Total   int
+	Months  []UserMonthActivity
+}
+
+// UserMonthActivity : ユーザのチャンネル・月毎の発言数。
+type UserMonthActivity struct {
+	Key   MessageMonthKey
+	Count int
+}
+
+// UserMessage : ユーザページに表示するメッセージ。
+type UserMessage struct {
+	Channel Channel
+	Msg     *Message
+	// URL is a link to the message in the archive.
+	URL string
+	// Replies is number of replies when Msg is a root of thread.
+	Replies int
+}
+
+// userPageData collects activities of a user.
+type userPageData struct {
+	activities map[string]*UserActivity
+	months     map[string]map[MessageMonthKey]int
+	messages   []UserMessage
+	threads    []UserMessage
+}
+
+func (d *userPageData) add(channel Channel, msg *Message, key MessageMonthKey, url string) {
+	if d.activities == nil {
+		d.activities = map[string]*UserActivity{}
+		d.months = map[string]map[MessageMonthKey]int{}
+	}
+	a, ok := d.activities[channel.ID]
+	if !ok {
+		a = &UserActivity{Channel: channel}
+		d.activities[channel.ID] = a
+		d.months[channel.ID] = map[MessageMonthKey]int{}
+	}
+	a.Total++
+	d.months[channel.ID][key]++
+	d.messages = append(d.messages, UserMessage{Channel: channel, Msg: msg, URL: url})
+}
+
+// Activities returns activities sorted by channel name.
+func (d *userPageData) Activities() []*UserActivity {
+	var list []*UserActivity
+	for id, a := range d.activities {
+		a.Months = a.Months[:0]
+		keys := make([]MessageMonthKey, 0, len(d.months[id]))
+		for key := range d.months[id] {
+			keys = append(keys, key)
+		}
+		sortMessageMonthKeys(keys)
+		for _, key := range keys {
+			a.Months = append(a.Months, UserMonthActivity{Key: key, Count: d.months[id][key]})
+		}
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Channel.Name < list[j].Channel.Name
+	})
+	return list
+}
+
+// latestUserMessages sorts msgs in descending order of the timestamp, and
+// returns first maxUserRecentItems messages.
+func latestUserMessages(msgs []UserMessage) []UserMessage {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Msg.Timestamp > msgs[j].Msg.Timestamp
+	})
+	if len(msgs) > maxUserRecentItems {
+		msgs = msgs[:maxUserRecentItems]
+	}
+	return msgs
+}
+
+// UserPagePath returns path of the user's page, relative to the root of the
+// site.
+func UserPagePath(userID string) string {
+	return "/users/" + userID + "/"
+}
+
+// displayedMonthKey returns MessageMonthKey for the month page which shows
+// the message.
+func (s *LogStore) displayedMonthKey(msg *Message) MessageMonthKey {
+	if msg.isThreadChild() {
+		// 返信はスレッドの先頭メッセージのある月のページに表示されている
+		return s.tsMonthKey(msg.ThreadTimestamp)
+	}
+	return s.tsMonthKey(msg.Timestamp)
+}
+
+// messageURL returns URL for the message in the month page.
+func (g *HTMLGenerator) messageURL(channelID string, msg *Message) string {
+	key := g.s.displayedMonthKey(msg)
+	return fmt.Sprintf("%s/%s/%s/%s/#ts-%s", g.baseURL, channelID, key.Year(), key.Month(), msg.Timestamp)
+}
+
+// collectUserPageData collects messages for each user from the channels.
+func (g *HTMLGenerator) collectUserPageData(channels []Channel) (map[string]*userPageData, error) {
+	data := map[string]*userPageData{}
+	get := func(userID string) *userPageData {
+		d, ok := data[userID]
+		if !ok {
+			d = &userPageData{}
+			data[userID] = d
+		}
+		return d
+	}
+	for _, channel := range channels {
+		err := g.s.EachMonth(channel.ID, func(_ MessageMonthKey, msgs Messages) error {
+			for _, msg := range msgs {
+				if !msg.isVisible() || msg.User == "" {
+					continue
+				}
+				get(msg.User).add(channel, msg, g.s.displayedMonthKey(msg), g.messageURL(channel.ID, msg))
+
+				if !msg.IsRootOfThread() {
+					continue
+				}
+				thread, ok := g.s.GetThread(channel.ID, msg.Timestamp)
+				if !ok || thread.ReplyCount() == 0 {
+					continue
+				}
+				d := get(msg.User)
+				d.threads = append(d.threads, UserMessage{
+					Channel: channel,
+					Msg:     msg,
+					URL:     fmt.Sprintf("%s/%s/threads/%s/", g.baseURL, channel.ID, msg.Timestamp),
+					Replies: thread.ReplyCount(),
+				})
+				for _, reply := range thread.Replies() {
+					// チャンネルにも投稿された返信は既に数えている
+					if !reply.isVisible() || reply.User == "" || reply.SubType == "thread_broadcast" {
+						continue
+					}
+					get(reply.User).add(channel, reply, g.s.displayedMonthKey(reply), g.messageURL(channel.ID, reply))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// generateUserPages generates a page for each user in UserTable, to
+// outDir/users/${user_id}/index.html .
+// When force is false, only pages which don't exist are generated.
+func (g *HTMLGenerator) generateUserPages(outDir string, channels []Channel, force bool) error {
+	data, err := g.collectUserPageData(channels)
+	if err != nil {
+		return err
+	}
+
+	var t *template.Template
+	for _, user := range g.s.GetUsers() {
+		dir := filepath.Join(outDir, "users", user.ID)
+		path := filepath.Join(dir, "index.html")
+		if !force && fileExists(path) {
+			continue
+		}
+		if t == nil {
+			tmplPath := filepath.Join(g.templateDir, "user.tmpl")
+			t, err = template.New(filepath.Base(tmplPath)).
+				Funcs(g.pageFuncMap()).
+				Funcs(map[string]interface{}{
+					"fullDatetime": func(ts string) string {
+						return g.s.locale.formatDateTimeSecs(g.s.tsToDateTime(ts))
+					},
+					"text": g.generateMessageText,
+				}).
+				ParseFiles(tmplPath)
+			if err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("could not create %s directory: %w", dir, err)
+		}
+
+		d, ok := data[user.ID]
+		if !ok {
+			d = &userPageData{}
+		}
+		icon := user.Profile.Image192
+		if icon == "" {
+			icon = user.Profile.Image48
+		}
+		params := make(map[string]interface{})
+		params["baseURL"] = g.baseURL
+		params["user"] = user
+		params["displayName"] = g.c.escapeSpecialChars(g.s.GetDisplayNameByUserID(user.ID))
+		params["iconURL"] = icon
+		params["activities"] = d.Activities()
+		params["messages"] = latestUserMessages(d.messages)
+		params["threads"] = latestUserMessages(d.threads)
+		if err := executeAndWrite(t, params, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -30,6 +30,11 @@ func main() {
 		subcmd.DownloadEmojiCommand,       // "download-emoji"
 		subcmd.DownloadFilesCommand,       // "download-files"
 		subcmd.GenerateHTMLCommand,        // "generate-html"
+		subcmd.ExportMarkdownCommand,      // "export-markdown"
+		subcmd.ExportOfflineHTMLCommand,   // "export-offline-html"
+		subcmd.ImportSQLiteCommand,        // "import-sqlite"
+		subcmd.LintLogdataCommand,         // "lint-logdata"
+		subcmd.SearchCommand,              // "search"
 		serve.Command,                     // "serve"
 		buildindex.NewCLICommand(),        // "build-index"
 		fetchmessages.NewCLICommand(),     // "fetch-messages"
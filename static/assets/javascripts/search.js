@@ -1,5 +1,9 @@
 window.addEventListener('DOMContentLoaded', async () => {
   const GRAM_N = 2;
+  // Header of index files, see indexFileMagic and indexFormatVersion in
+  // indexer.go.
+  const INDEX_FILE_MAGIC = "SLIX";
+  const INDEX_FORMAT_VERSION = 1;
   const toHexString = (n) => {
     return n.toString(16).padStart(2, "0");
   };
@@ -7,6 +11,68 @@ window.addEventListener('DOMContentLoaded', async () => {
     return n.toString().padStart(2, "0");
   };
 
+  // The locale and the timezone of the archive, see siteLocale in
+  // generator.go. locale.json is written by generate-html; Japanese labels
+  // and Asia/Tokyo are used without it.
+  const siteLocale = await (async () => {
+    const res = await fetch("./locale.json");
+    return res.ok ? res.json() : {};
+  })();
+  // Labels in the locale of the archive, see searchLabels in time.go.
+  const labels = {
+    title: "ログ検索",
+    button: "検索",
+    help: document.getElementById("search-help").innerHTML,
+    // Labels of field kinds in postings, see indexField in indexer.go.
+    fields: ["本文", "添付", "ファイル名", "スニペット", "ブロック"],
+    notIndexFile: "索引ファイルではありません: {key}",
+    unsupportedVersion: "索引ファイルの形式 ({version}) に対応していません: {key}",
+    invalidDate: "日付は YYYY-MM-DD の形式で指定してください: {value}",
+    noWords: "検索する語を入力してください",
+    found: "{count} 件ヒットしました ({seconds} 秒)",
+    failed: "検索中にエラーが発生しました: {error}",
+    ...siteLocale.search,
+  };
+  // formatLabel replaces {name} in the label with params[name].
+  const formatLabel = (name, params = {}) => {
+    return labels[name].replace(/\{(\w+)\}/g, (m, key) => params[key] ?? m);
+  };
+
+  // Dates of messages are decided in the timezone of the archive, same as
+  // month pages, not in the timezone of the browser.
+  const dateTimeFormat = new Intl.DateTimeFormat("en-US", {
+    timeZone: siteLocale.timezone ?? "Asia/Tokyo",
+    hourCycle: "h23",
+    year: "numeric",
+    month: "numeric",
+    day: "numeric",
+    hour: "numeric",
+    minute: "numeric",
+    second: "numeric",
+  });
+  // archiveDate returns the year, month (1-12), day, hour, minute and second
+  // of the time in milliseconds, in the timezone of the archive.
+  const archiveDate = (t) => {
+    const date = {};
+    for (const {type, value} of dateTimeFormat.formatToParts(new Date(t))) {
+      if (type !== "literal") {
+        date[type] = value - 0;
+      }
+    }
+    return date;
+  };
+  // archiveTime returns the time in milliseconds of 00:00 of the date in the
+  // timezone of the archive. Overflowed days are carried to the month.
+  const archiveTime = (year, month, day) => {
+    const offset = (t) => {
+      const d = archiveDate(t);
+      return Date.UTC(d.year, d.month - 1, d.day, d.hour, d.minute, d.second) - t;
+    };
+    const utc = Date.UTC(year, month - 1, day);
+    // オフセットが変わる日の場合に備えて、求めた時刻のオフセットで補正する
+    return utc - offset(utc - offset(utc));
+  };
+
   class Uint8ArrayReader {
     constructor(u8ary) {
       this.u8ary = u8ary;
@@ -34,6 +100,12 @@ window.addEventListener('DOMContentLoaded', async () => {
       return n;
     }
 
+    readString(length) {
+      const s = String.fromCharCode(...this.u8ary.subarray(this.i, this.i + length));
+      this.i += length;
+      return s;
+    }
+
     isEOF() {
       return this.u8ary.length <= this.i;
     }
@@ -60,6 +132,13 @@ window.addEventListener('DOMContentLoaded', async () => {
       if (res.ok) {
         const blob = await res.blob();
         const reader = new Uint8ArrayReader(new Uint8Array(await blob.arrayBuffer()));
+        if (reader.readString(INDEX_FILE_MAGIC.length) !== INDEX_FILE_MAGIC) {
+          throw new Error(formatLabel("notIndexFile", {key}));
+        }
+        const version = reader.readVInt();
+        if (version !== INDEX_FORMAT_VERSION) {
+          throw new Error(formatLabel("unsupportedVersion", {version, key}));
+        }
         while (!reader.isEOF()) {
           const channelNumber = reader.readVInt();
           let mesCount = reader.readVInt();
@@ -67,8 +146,10 @@ window.addEventListener('DOMContentLoaded', async () => {
             const tsSec = reader.readInt();
             const tsMicrosec = reader.readVInt();
             const ts = `${tsSec}.${tsMicrosec.toString().padStart(6, "0")}`;
+            const field = reader.readVInt();
+            const userNumber = reader.readVInt();
 
-            const key = `${channelNumber}:${ts}`;
+            const key = `${channelNumber}:${ts}:${field}:${userNumber}`;
             let posSet = index.get(key);
             if (posSet == null) {
               posSet = new Set();
@@ -106,6 +187,21 @@ window.addEventListener('DOMContentLoaded', async () => {
     return map;
   })();
 
+  const numToUser = await (async () => {
+    const map = new Map();
+    const res = await fetch("./index/user");
+    if (!res.ok) {
+      return map;
+    }
+    for (const line of (await res.text()).split("\n")) {
+      const [n, userID, userName, displayName] = line.split("\t");
+      if (userID != null) {
+        map.set(n - 0, {userID, userName, displayName});
+      }
+    }
+    return map;
+  })();
+
   const searchByWord = async (word) => {
     const indexes = await Promise.all(
       [...word.matchAll(sepRegexp)].map(async (chunk) => index.get(chunk[0]))
@@ -131,16 +227,119 @@ window.addEventListener('DOMContentLoaded', async () => {
     return result;
   };
 
+  // parseDate returns the time in milliseconds of 00:00 of the date, or
+  // of days after it, in the timezone of the archive.
+  const parseDate = (value, days = 0) => {
+    const m = value.match(/^(\d{4})-(\d{1,2})-(\d{1,2})$/);
+    if (m == null) {
+      throw new Error(formatLabel("invalidDate", {value}));
+    }
+    return archiveTime(m[1] - 0, m[2] - 0, m[3] - 0 + days);
+  };
+
+  // parseQuery splits the query into words and operators:
+  //   from:@user   messages posted by the user (name or display name)
+  //   in:#channel  messages in the channel
+  //   before:YYYY-MM-DD  messages posted before the date
+  //   after:YYYY-MM-DD   messages posted after the date
+  // from: and in: can be given more than once to match any of them.
   const parseQuery = (query) => {
-    // TODO: parse
-    return query;
+    const q = {words: [], from: [], in: [], before: null, after: null};
+    for (const term of query.split(/\s+/)) {
+      const m = term.match(/^(from|in|before|after):(.+)$/);
+      if (m == null) {
+        if (term !== "") {
+          q.words.push(term);
+        }
+        continue;
+      }
+      const [, op, value] = m;
+      switch (op) {
+        case "from":
+          q.from.push(value.replace(/^@/, "").toLowerCase());
+          break;
+        case "in":
+          q.in.push(value.replace(/^#/, "").toLowerCase());
+          break;
+        case "before":
+          q.before = parseDate(value);
+          break;
+        case "after":
+          q.after = parseDate(value, 1);
+          break;
+      }
+    }
+    return q;
+  };
+
+  const matchUser = (q, userNumber) => {
+    if (q.from.length === 0) {
+      return true;
+    }
+    const user = numToUser.get(userNumber);
+    if (user == null) {
+      return false;
+    }
+    const names = [user.userID, user.userName, user.displayName].map((name) => (name ?? "").toLowerCase());
+    return q.from.some((from) => names.includes(from));
   };
 
+  const matchChannel = (q, channelNumber) => {
+    if (q.in.length === 0) {
+      return true;
+    }
+    const channel = numToChannel.get(channelNumber);
+    if (channel == null) {
+      return false;
+    }
+    const names = [channel.channelID, channel.channelName].map((name) => name.toLowerCase());
+    return q.in.some((ch) => names.includes(ch));
+  };
+
+  const matchDate = (q, tsFloat) => {
+    const t = tsFloat * 1000;
+    return (q.before == null || t < q.before) && (q.after == null || q.after <= t);
+  };
+
+  // search returns messages which have all words and match operators in the
+  // query. The key is "{channelNumber}:{ts}", and the value is fields of the
+  // message which have the words.
   const search = async (query) => {
-    const word = parseQuery(query);
-    return searchByWord(word);
+    const q = parseQuery(query);
+    if (q.words.length === 0) {
+      throw new Error(formatLabel("noWords"));
+    }
+
+    let docs = null;
+    for (const word of q.words) {
+      const result = await searchByWord(word);
+      // Postings are per field of messages, so group them by messages.
+      const found = new Map();
+      for (const key of result.keys()) {
+        const [channelNumber, ts, field, userNumber] = key.split(":");
+        const doc = `${channelNumber}:${ts}`;
+        let fields = found.get(doc);
+        if (fields == null) {
+          if (docs != null && !docs.has(doc)) {
+            continue;
+          }
+          if (!matchChannel(q, channelNumber - 0) || !matchUser(q, userNumber - 0) || !matchDate(q, parseFloat(ts))) {
+            continue;
+          }
+          fields = new Set(docs?.get(doc));
+          found.set(doc, fields);
+        }
+        fields.add(field - 0);
+      }
+      docs = found;
+    }
+    return docs;
   };
 
+  document.getElementById("search-title").textContent = labels.title;
+  document.getElementById("search-button").value = labels.button;
+  document.getElementById("search-help").innerHTML = labels.help;
+
   const text = document.getElementById("search-text");
   const resultElement = document.getElementById("result");
 
@@ -148,25 +347,26 @@ window.addEventListener('DOMContentLoaded', async () => {
     try {
       const startTime = Date.now();
 
-      const result = await search(text.value);
+      const docs = await search(text.value);
 
       const links =
-        [...result.keys()]
-        .map((doc) => doc.split(":"))
-        .map(([channelNumber, ts]) => [channelNumber, ts, parseFloat(ts)])
+        [...docs.entries()]
+        .map(([doc, fields]) => [...doc.split(":"), fields])
+        .map(([channelNumber, ts, fields]) => [channelNumber, ts, parseFloat(ts), fields])
         .sort(([, , tsA], [, , tsB]) => tsB - tsA)
         .map(
-          ([channelNumber, ts, tsFloat]) => {
+          ([channelNumber, ts, tsFloat, fields]) => {
             const {channelID, channelName} = numToChannel.get(channelNumber - 0);
-            const date = new Date(tsFloat * 1000);
-            const link = `${channelID}/${date.getFullYear()}/${(date.getMonth() + 1).toString().padStart(2, "0")}/#ts-${ts}`;
-            return `<a href="${link}">&#35;${channelName}: ${date.getFullYear()}-${to2dString(date.getMonth() + 1)}-${to2dString(date.getDate())} ${to2dString(date.getHours())}:${to2dString(date.getMinutes())}:${to2dString(date.getSeconds())}</a>`;
+            const date = archiveDate(tsFloat * 1000);
+            const link = `${channelID}/${date.year}/${to2dString(date.month)}/#ts-${ts}`;
+            const fieldNames = [...fields].sort((a, b) => a - b).map((field) => labels.fields[field] ?? "").join(", ");
+            return `<a href="${link}">&#35;${channelName}: ${date.year}-${to2dString(date.month)}-${to2dString(date.day)} ${to2dString(date.hour)}:${to2dString(date.minute)}:${to2dString(date.second)}</a> <span class="text-gray f6">(${fieldNames})</span>`;
           }
         );
       const processTime = Date.now() - startTime;
-      resultElement.innerHTML = `<p>${links.length} 件ヒットしました (${processTime / 1000} 秒)</p>${links.join("<br>")}`;
+      resultElement.innerHTML = `<p>${formatLabel("found", {count: links.length, seconds: processTime / 1000})}</p>${links.join("<br>")}`;
     } catch (e) {
-      resultElement.innerHTML = `検索中にエラーが発生しました: ${e.name}: ${e.message}`;
+      resultElement.innerHTML = formatLabel("failed", {error: `${e.name}: ${e.message}`});
     }
   };
 
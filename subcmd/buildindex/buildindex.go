@@ -8,42 +8,40 @@ import (
 	"github.com/vim-jp/slacklog-generator/internal/slacklog"
 )
 
-func run(datadir, outdir, config string) error {
+func run(datadir, outdir, filesdir, statePath, config, dbPath string, full bool) error {
 	configJSONPath := filepath.Clean(config)
 	cfg, err := slacklog.ReadConfig(configJSONPath)
 	if err != nil {
 		return fmt.Errorf("could not read config: %w", err)
 	}
-	s, err := slacklog.NewLogStore(datadir, cfg)
+	s, err := slacklog.OpenLogStore(datadir, dbPath, cfg)
 	if err != nil {
 		return err
 	}
+	defer s.Close()
 
 	i := slacklog.NewIndexer(s)
-	err = i.Build()
-	if err != nil {
-		return err
-	}
-
-	err = i.Output(outdir)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	i.SetFilesDir(filesdir)
+	i.SetFullRebuild(full)
+	i.SetStatePath(statePath)
+	return i.Update(outdir)
 }
 
 func NewCLICommand() *cli.Command {
 	var (
-		datadir string
-		outdir  string
-		config  string
+		datadir  string
+		outdir   string
+		filesdir string
+		state    string
+		config   string
+		dbPath   string
+		full     bool
 	)
 	return &cli.Command{
 		Name:  "build-index",
 		Usage: "build index for searching",
 		Action: func(c *cli.Context) error {
-			return run(datadir, outdir, config)
+			return run(datadir, outdir, filesdir, state, config, dbPath, full)
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -63,6 +61,28 @@ func NewCLICommand() *cli.Command {
 				Usage:       "directory to output result",
 				Destination: &outdir,
 			},
+			&cli.StringFlag{
+				Name:        "filesdir",
+				Usage:       "files downloaded dir, to index snippets",
+				Value:       filepath.Join("_logdata", "files"),
+				Destination: &filesdir,
+			},
+			&cli.StringFlag{
+				Name:        "state",
+				Usage:       "file to save indexed message files for next update, out of outdir which is published. the whole index is rebuilt every time when empty",
+				Value:       filepath.Join("_logdata", "index_state.json"),
+				Destination: &state,
+			},
+			&cli.StringFlag{
+				Name:        "sqlite",
+				Usage:       "read logs from SQLite database created by import-sqlite, instead of datadir",
+				Destination: &dbPath,
+			},
+			&cli.BoolFlag{
+				Name:        "full",
+				Usage:       "rebuild the whole index even if message files are not changed",
+				Destination: &full,
+			},
 		},
 	}
 }
@@ -14,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	cli "github.com/urfave/cli/v2"
 	"github.com/vim-jp/slacklog-generator/internal/slacklog"
@@ -26,6 +27,11 @@ var ConvertExportedLogsCommand = &cli.Command{
 	Usage:  "convert slack exported logs to API download logs",
 	Action: convertExportedLogs,
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "config.json path, which enables private channels, group DMs and DMs",
+			Value: filepath.Join("scripts", "config.json"),
+		},
 		&cli.StringFlag{
 			Name:  "indir",
 			Usage: "exported log dir",
@@ -36,53 +42,75 @@ var ConvertExportedLogsCommand = &cli.Command{
 			Usage: "slacklog_data dir",
 			Value: filepath.Join("_logdata", "slacklog_data"),
 		},
+		&cli.StringFlag{
+			Name:  "timezone",
+			Usage: "timezone in which days are split (default: timezone in config)",
+		},
 	},
 }
 
 // convertExportedLogs converts log which exported from Slack, to generator can
 // treat.
 func convertExportedLogs(c *cli.Context) error {
+	configJSONPath := filepath.Clean(c.String("config"))
 	inDir := filepath.Clean(c.String("indir"))
 	outDir := filepath.Clean(c.String("outdir"))
-	inChannelsFile := filepath.Join(inDir, "channels.json")
 
-	channels, _, err := readChannels(inChannelsFile, []string{"*"})
+	// コンフィグが無ければ公開チャンネルのみを変換する
+	cfg, err := slacklog.ReadConfigIfExists(configJSONPath)
 	if err != nil {
-		return fmt.Errorf("could not read channels.json: %w", err)
+		return fmt.Errorf("could not read config: %w", err)
 	}
-
-	if err := os.MkdirAll(outDir, 0777); err != nil {
-		return fmt.Errorf("could not create %s directory: %w", outDir, err)
+	timezone := c.String("timezone")
+	if timezone == "" {
+		timezone = cfg.Timezone
 	}
-
-	err = copyFile(filepath.Join(inDir, "channels.json"), filepath.Join(outDir, "channels.json"))
+	loc, err := slacklog.LoadLocation(timezone)
 	if err != nil {
 		return err
 	}
 
-	err = copyFile(filepath.Join(inDir, "users.json"), filepath.Join(outDir, "users.json"))
+	return convertConversations(inDir, outDir, cfg, loc)
+}
+
+// convertConversations converts users and conversations in inDir into
+// outDir. Conversations of types which are not enabled by cfg are skipped,
+// and neither their list nor messages are written. Messages are split by
+// days in loc.
+func convertConversations(inDir, outDir string, cfg *slacklog.Config, loc *time.Location) error {
+	if err := os.MkdirAll(outDir, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", outDir, err)
+	}
+
+	err := copyFile(filepath.Join(inDir, "users.json"), filepath.Join(outDir, "users.json"))
 	if err != nil {
 		return err
 	}
 
-	for _, channel := range channels {
-		messages, err := ReadAllMessages(filepath.Join(inDir, channel.Name))
-		if err != nil {
-			return err
+	// 公開チャンネル以外の会話はConfigで有効にした種類のみを変換する。
+	// slacklog_dataは公開されるため、無効な種類の会話は一切書き出さない。
+	for i, f := range slacklog.ConversationFiles {
+		if !f.Enabled(cfg) {
+			continue
 		}
-
-		for _, message := range messages {
-			message.RemoveTokenFromURLs()
+		inFile := filepath.Join(inDir, f.Name)
+		channels, _, err := readChannels(inFile, []string{"*"})
+		if err != nil {
+			if i != 0 && os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("could not read %s: %w", f.Name, err)
 		}
-
-		channelDir := filepath.Join(outDir, channel.ID)
-		if err := os.MkdirAll(channelDir, 0777); err != nil {
-			return fmt.Errorf("could not create %s directory: %w", channelDir, err)
+		err = copyFile(inFile, filepath.Join(outDir, f.Name))
+		if err != nil {
+			return err
 		}
-
-		messagesPerDay := groupMessagesByDay(messages)
-		for key, msgs := range messagesPerDay {
-			err = writeMessages(filepath.Join(channelDir, key+".json"), msgs)
+		for _, channel := range channels {
+			name := channel.Name
+			if f.ByID {
+				name = channel.ID
+			}
+			err := convertChannelLogs(filepath.Join(inDir, name), outDir, channel.ID, loc)
 			if err != nil {
 				return err
 			}
@@ -92,6 +120,33 @@ func convertExportedLogs(c *cli.Context) error {
 	return nil
 }
 
+// convertChannelLogs converts messages in inDir, and writes them in the
+// directory of channelID in outDir, by days in loc.
+func convertChannelLogs(inDir, outDir, channelID string, loc *time.Location) error {
+	messages, err := ReadAllMessages(inDir)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		message.RemoveTokenFromURLs()
+	}
+
+	channelDir := filepath.Join(outDir, channelID)
+	if err := os.MkdirAll(channelDir, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", channelDir, err)
+	}
+
+	messagesPerDay := groupMessagesByDay(messages, loc)
+	for key, msgs := range messagesPerDay {
+		err = writeMessages(filepath.Join(channelDir, key+".json"), msgs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func copyFile(from string, to string) error {
 	r, err := os.Open(from)
 	if err != nil {
@@ -160,10 +215,10 @@ func ReadAllMessages(inDir string) ([]*slacklog.Message, error) {
 	return messages, nil
 }
 
-func groupMessagesByDay(messages []*slacklog.Message) map[string][]*slacklog.Message {
+func groupMessagesByDay(messages []*slacklog.Message, loc *time.Location) map[string][]*slacklog.Message {
 	messagesPerDay := map[string][]*slacklog.Message{}
 	for _, msg := range messages {
-		time := slacklog.TsToDateTime(msg.Timestamp).Format("2006-01-02")
+		time := slacklog.TsToDateTime(msg.Timestamp, loc).Format("2006-01-02")
 		messagesPerDay[time] = append(messagesPerDay[time], msg)
 	}
 	return messagesPerDay
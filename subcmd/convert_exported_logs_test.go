@@ -0,0 +1,88 @@
+package subcmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertConversations_dms(t *testing.T) {
+	tmpPath, err := ioutil.TempDir("", "convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpPath)
+
+	inDir := filepath.Join(tmpPath, "export")
+	const msgs = `[{"type":"message","user":"U001","text":"hello","ts":"1580000000.000100"}]`
+	writeTestFile(t, filepath.Join(inDir, "users.json"), `[{"id":"U001","name":"alice"}]`)
+	writeTestFile(t, filepath.Join(inDir, "channels.json"), `[{"id":"C001","name":"general"}]`)
+	writeTestFile(t, filepath.Join(inDir, "general", "2020-01-26.json"), msgs)
+	writeTestFile(t, filepath.Join(inDir, "dms.json"), `[{"id":"D001","members":["U001"]}]`)
+	writeTestFile(t, filepath.Join(inDir, "D001", "2020-01-26.json"), msgs)
+
+	for _, enabled := range []bool{false, true} {
+		outDir := filepath.Join(tmpPath, "out")
+		if err := os.RemoveAll(outDir); err != nil {
+			t.Fatal(err)
+		}
+		if err := convertConversations(inDir, outDir, &slacklog.Config{DMs: enabled}, time.UTC); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "C001", "2020-01-26.json")); err != nil {
+			t.Errorf("public channel (dms: %t) is not written: %s", enabled, err)
+		}
+		for _, name := range []string{"dms.json", "D001"} {
+			_, err := os.Stat(filepath.Join(outDir, name))
+			if got := err == nil; got != enabled {
+				t.Errorf("%s (dms: %t) is written: %t", name, enabled, got)
+			}
+		}
+	}
+}
+
+func TestConvertExportedLogs_noConfig(t *testing.T) {
+	tmpPath, err := ioutil.TempDir("", "convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpPath)
+
+	inDir := filepath.Join(tmpPath, "export")
+	outDir := filepath.Join(tmpPath, "out")
+	writeTestFile(t, filepath.Join(inDir, "users.json"), `[{"id":"U001","name":"alice"}]`)
+	writeTestFile(t, filepath.Join(inDir, "channels.json"), `[{"id":"C001","name":"general"}]`)
+	writeTestFile(t, filepath.Join(inDir, "general", "2020-01-26.json"), `[{"type":"message","user":"U001","text":"hello","ts":"1580000000.000100"}]`)
+	writeTestFile(t, filepath.Join(inDir, "dms.json"), `[{"id":"D001","members":["U001"]}]`)
+
+	app := &cli.App{Commands: []*cli.Command{ConvertExportedLogsCommand}}
+	err = app.Run([]string{"slacklog", "convert-exported-logs",
+		"--config", filepath.Join(tmpPath, "config.json"),
+		"--indir", inDir,
+		"--outdir", outDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "C001", "2020-01-26.json")); err != nil {
+		t.Errorf("public channel is not written: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "dms.json")); err == nil {
+		t.Error("dms.json is written without config")
+	}
+}
@@ -82,44 +82,49 @@ func urlAndSuffixes(f slack.File) map[string]string {
 	}
 }
 
+// queueMessageFiles queues download requests for files attached to msgs.
+func queueMessageFiles(d *slacklog.Downloader, msgs slacklog.Messages, outputDir string) error {
+	for _, msg := range msgs {
+		for _, f := range msg.Files {
+			if !slacklog.HostBySlack(f) {
+				continue
+			}
+			// avoid github's file size limit
+			if f.Size >= 104857600 {
+				continue
+			}
+
+			targetDir := filepath.Join(outputDir, f.ID)
+			err := os.MkdirAll(targetDir, 0777)
+			if err != nil {
+				return fmt.Errorf("failed to create %s directory: %w", targetDir, err)
+			}
+
+			for url, suffix := range urlAndSuffixes(f) {
+				if url == "" {
+					continue
+				}
+				d.QueueDownloadRequest(
+					url,
+					filepath.Join(targetDir, slacklog.LocalName(f, url, suffix)),
+					true,
+				)
+			}
+		}
+	}
+	return nil
+}
+
 func generateMessageFileTargets(d *slacklog.Downloader, s *slacklog.LogStore, outputDir string) {
 	defer d.CloseQueue()
 	channels := s.GetChannels()
 	for _, channel := range channels {
-		msgs, err := s.GetAllMessages(channel.ID)
+		err := s.WalkAllMessages(channel.ID, func(msgs slacklog.Messages) error {
+			return queueMessageFiles(d, msgs, outputDir)
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to get messages on %s channel: %s", channel.Name, err)
+			fmt.Fprintf(os.Stderr, "failed to queue files on %s channel: %s", channel.Name, err)
 			return
 		}
-
-		for _, msg := range msgs {
-			for _, f := range msg.Files {
-				if !slacklog.HostBySlack(f) {
-					continue
-				}
-				// avoid github's file size limit
-				if f.Size >= 104857600 {
-					continue
-				}
-
-				targetDir := filepath.Join(outputDir, f.ID)
-				err := os.MkdirAll(targetDir, 0777)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "failed to create %s directory: %s", targetDir, err)
-					return
-				}
-
-				for url, suffix := range urlAndSuffixes(f) {
-					if url == "" {
-						continue
-					}
-					d.QueueDownloadRequest(
-						url,
-						filepath.Join(targetDir, slacklog.LocalName(f, url, suffix)),
-						true,
-					)
-				}
-			}
-		}
 	}
 }
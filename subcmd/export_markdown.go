@@ -0,0 +1,53 @@
+package subcmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+// ExportMarkdownCommand provoides "export-markdown" command.
+// It... ログデータをチャンネル・月毎のMarkdownファイルとして出力する。
+var ExportMarkdownCommand = &cli.Command{
+	Name:   "export-markdown",
+	Usage:  "export slacklog_data as markdown files",
+	Action: exportMarkdown,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "config.json path",
+			Value: filepath.Join("scripts", "config.json"),
+		},
+		&cli.StringFlag{
+			Name:  "indir",
+			Usage: "slacklog_data dir",
+			Value: filepath.Join("_logdata", "slacklog_data"),
+		},
+		&cli.StringFlag{
+			Name:  "outdir",
+			Usage: "markdown files target dir",
+			Value: "_markdown",
+		},
+	},
+}
+
+// exportMarkdown : ログデータをMarkdownに変換して出力する。
+func exportMarkdown(c *cli.Context) error {
+	configJSONPath := filepath.Clean(c.String("config"))
+	inDir := filepath.Clean(c.String("indir"))
+	outDir := filepath.Clean(c.String("outdir"))
+
+	cfg, err := slacklog.ReadConfig(configJSONPath)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	s, err := slacklog.NewLogStore(inDir, cfg)
+	if err != nil {
+		return err
+	}
+
+	return slacklog.NewMarkdownExporter(s).Export(outDir)
+}
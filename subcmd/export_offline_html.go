@@ -0,0 +1,132 @@
+package subcmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+// ExportOfflineHTMLCommand provoides "export-offline-html" command.
+// It... チャンネルのログをオフラインで閲覧できる1つのHTMLファイルとして出力す
+// る。
+var ExportOfflineHTMLCommand = &cli.Command{
+	Name:   "export-offline-html",
+	Usage:  "export a channel as a single self-contained html file",
+	Action: exportOfflineHTML,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "config.json path",
+			Value: filepath.Join("scripts", "config.json"),
+		},
+		&cli.StringFlag{
+			Name:  "templatedir",
+			Usage: "templates dir",
+			Value: "templates",
+		},
+		&cli.StringFlag{
+			Name:  "filesdir",
+			Usage: "files downloaded dir",
+			Value: filepath.Join("_logdata", "files"),
+		},
+		&cli.StringFlag{
+			Name:  "emojisdir",
+			Usage: "emojis downloaded dir",
+			Value: filepath.Join("_logdata", "emojis"),
+		},
+		&cli.StringFlag{
+			Name:  "css",
+			Usage: "CSS file to be inlined",
+			Value: filepath.Join("static", "assets", "css", "site.css"),
+		},
+		&cli.StringFlag{
+			Name:  "highlight-css",
+			Usage: "CSS file for highlighted code to be inlined",
+			Value: filepath.Join("static", "assets", "css", "highlight.css"),
+		},
+		&cli.StringFlag{
+			Name:  "primer-css",
+			Usage: "path or URL of Primer CSS to be inlined",
+			Value: "https://unpkg.com/@primer/css/dist/primer.css",
+		},
+		&cli.StringFlag{
+			Name:  "indir",
+			Usage: "slacklog_data dir",
+			Value: filepath.Join("_logdata", "slacklog_data"),
+		},
+		&cli.StringFlag{
+			Name:     "channel",
+			Usage:    "ID or name of the channel to export",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "export messages on and after this date (YYYY-MM-DD)",
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "export messages on and before this date (YYYY-MM-DD)",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output html file (default: ${channel_name}.html)",
+		},
+	},
+}
+
+// parseDate parses s as a date in loc. An empty string results zero time.
+func parseDate(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, loc)
+}
+
+// exportOfflineHTML : チャンネルのログを1つのHTMLファイルとして出力する。
+func exportOfflineHTML(c *cli.Context) error {
+	configJSONPath := filepath.Clean(c.String("config"))
+	templateDir := filepath.Clean(c.String("templatedir"))
+	filesDir := filepath.Clean(c.String("filesdir"))
+	emojisDir := filepath.Clean(c.String("emojisdir"))
+	cssPaths := []string{c.String("primer-css"), filepath.Clean(c.String("css")), filepath.Clean(c.String("highlight-css"))}
+	inDir := filepath.Clean(c.String("indir"))
+
+	cfg, err := slacklog.ReadConfig(configJSONPath)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	s, err := slacklog.NewLogStore(inDir, cfg)
+	if err != nil {
+		return err
+	}
+
+	// 日付はConfigのタイムゾーンで解釈する
+	from, err := parseDate(c.String("from"), s.Location())
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	to, err := parseDate(c.String("to"), s.Location())
+	if err != nil {
+		return fmt.Errorf("invalid --to: %w", err)
+	}
+	if !to.IsZero() {
+		// --to の日付を含める
+		to = to.AddDate(0, 0, 1)
+	}
+
+	channel, ok := s.FindChannel(c.String("channel"))
+	if !ok {
+		return fmt.Errorf("channel not found: %s", c.String("channel"))
+	}
+	output := c.String("output")
+	if output == "" {
+		output = channel.Name + ".html"
+	}
+
+	g := slacklog.NewHTMLGenerator(templateDir, filesDir, s, cfg)
+	return slacklog.NewOfflineExporter(g, emojisDir, cssPaths).Export(output, *channel, from, to)
+}
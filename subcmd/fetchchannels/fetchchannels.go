@@ -2,14 +2,18 @@ package fetchchannels
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"path/filepath"
 
 	cli "github.com/urfave/cli/v2"
 	"github.com/vim-jp/slacklog-generator/internal/jsonwriter"
 	"github.com/vim-jp/slacklog-generator/internal/slackadapter"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
 )
 
-func run(token, datadir string, excludeArchived, verbose bool) error {
+func run(token, datadir string, excludeArchived, pins, verbose bool) error {
 	outfile := filepath.Join(datadir, "channels.json")
 	fw, err := jsonwriter.CreateFile(outfile, true)
 	if err != nil {
@@ -27,6 +31,11 @@ func run(token, datadir string, excludeArchived, verbose bool) error {
 				return "", err
 			}
 			for _, c := range r.Channels {
+				if pins {
+					if err := fetchPins(ctx, token, c, verbose); err != nil {
+						return "", err
+					}
+				}
 				err := fw.Write(c)
 				if err != nil {
 					return "", err
@@ -49,6 +58,26 @@ func run(token, datadir string, excludeArchived, verbose bool) error {
 	return nil
 }
 
+// fetchPins fetches pinned messages of the channel into c.Pins. Pins are
+// optional, so a token without the pins:read scope, or a channel which the
+// token's user is not in is not an error.
+func fetchPins(ctx context.Context, token string, c *slacklog.Channel, verbose bool) error {
+	pins, err := slackadapter.Pins(ctx, token, c.ID)
+	if err != nil {
+		var e *slackadapter.Error
+		if errors.As(err, &e) && (e.Err == "missing_scope" || e.Err == "not_in_channel") {
+			log.Printf("[WARN] skip fetching pins of #%s: %s", c.Name, e.Err)
+			return nil
+		}
+		return fmt.Errorf("failed to fetch pins of %s: %w", c.Name, err)
+	}
+	c.Pins = pins
+	if verbose {
+		log.Printf("fetched %d pins of #%s", len(pins), c.Name)
+	}
+	return nil
+}
+
 // NewCLICommand creates a cli.Command, which provides "fetch-channels"
 // sub-command.
 func NewCLICommand() *cli.Command {
@@ -56,13 +85,14 @@ func NewCLICommand() *cli.Command {
 		token           string
 		datadir         string
 		excludeArchived bool
+		pins            bool
 		verbose         bool
 	)
 	return &cli.Command{
 		Name:  "fetch-channels",
 		Usage: "fetch channels in the workspace",
 		Action: func(c *cli.Context) error {
-			return run(token, datadir, excludeArchived, verbose)
+			return run(token, datadir, excludeArchived, pins, verbose)
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -82,6 +112,11 @@ func NewCLICommand() *cli.Command {
 				Usage:       "exclude archived channesls",
 				Destination: &excludeArchived,
 			},
+			&cli.BoolFlag{
+				Name:        "pins",
+				Usage:       "fetch pinned messages of channels (requires pins:read scope)",
+				Destination: &pins,
+			},
 			&cli.BoolFlag{
 				Name:        "verbose",
 				Usage:       "verbose log",
@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/slack-go/slack"
 	cli "github.com/urfave/cli/v2"
 	"github.com/vim-jp/slacklog-generator/internal/jsonwriter"
 	"github.com/vim-jp/slacklog-generator/internal/slackadapter"
@@ -22,10 +21,10 @@ func toDateString(ti time.Time) string {
 	return ti.Format(dateFormat)
 }
 
-func parseDateString(s string) (time.Time, error) {
-	l, err := time.LoadLocation("Asia/Tokyo")
-	if err != nil {
-		return time.Time{}, err
+// parseDateString parses s as a date in l. An empty string results today.
+func parseDateString(s string, l *time.Location) (time.Time, error) {
+	if s == "" {
+		s = toDateString(time.Now().In(l))
 	}
 	ti, err := time.ParseInLocation(dateFormat, s, l)
 	if err != nil {
@@ -38,15 +37,19 @@ func parseDateString(s string) (time.Time, error) {
 // day.
 func Run(args []string) error {
 	var (
-		token   string
-		datadir string
-		date    string
-		verbose bool
+		token      string
+		datadir    string
+		configPath string
+		date       string
+		timezone   string
+		verbose    bool
 	)
 	fs := flag.NewFlagSet("fetch-messages", flag.ExitOnError)
 	fs.StringVar(&token, "token", os.Getenv("SLACK_TOKEN"), `slack token. can be set by SLACK_TOKEN env var`)
 	fs.StringVar(&datadir, "datadir", "_logdata", `directory to load/save data`)
-	fs.StringVar(&date, "date", toDateString(time.Now()), `target date to get`)
+	fs.StringVar(&date, "date", "", `target date to get (default: today)`)
+	fs.StringVar(&configPath, "config", filepath.Join("scripts", "config.json"), `config.json path, which has the timezone`)
+	fs.StringVar(&timezone, "timezone", "", `timezone in which days are split (default: timezone in config)`)
 	fs.BoolVar(&verbose, "verbose", false, "verbose log")
 	err := fs.Parse(args)
 	if err != nil {
@@ -55,11 +58,28 @@ func Run(args []string) error {
 	if token == "" {
 		return errors.New("SLACK_TOKEN environment variable requied")
 	}
-	return run(token, datadir, date, verbose)
+	return run(token, datadir, configPath, date, timezone, verbose)
+}
+
+// archiveLocation returns the timezone to split days. timezone overrides the
+// timezone in the config at configPath, which is optional.
+func archiveLocation(configPath, timezone string) (*time.Location, error) {
+	if timezone == "" {
+		cfg, err := slacklog.ReadConfigIfExists(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config: %w", err)
+		}
+		timezone = cfg.Timezone
+	}
+	return slacklog.LoadLocation(timezone)
 }
 
-func run(token, datadir, date string, verbose bool) error {
-	oldest, err := parseDateString(date)
+func run(token, datadir, configPath, date, timezone string, verbose bool) error {
+	loc, err := archiveLocation(configPath, timezone)
+	if err != nil {
+		return err
+	}
+	oldest, err := parseDateString(date, loc)
 	if err != nil {
 		return err
 	}
@@ -93,27 +113,21 @@ func run(token, datadir, date string, verbose bool) error {
 				}
 				for _, message := range r.Messages {
 					if message.IsRootOfThread() {
-						client := slack.New(token)
 						err = slackadapter.IterateCursor(ctx, slackadapter.CursorIteratorFunc(func(ctx context.Context, c slackadapter.Cursor) (slackadapter.Cursor, error) {
-							msgs, hasMore, nextCursor, err := client.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
-								ChannelID: sch.ID,
-								Cursor:    string(c),
-								Timestamp: message.Timestamp,
+							rr, err := slackadapter.ConversationsReplies(ctx, token, sch.ID, message.Timestamp, slackadapter.ConversationsRepliesParams{
+								Cursor: c,
 							})
 							if err != nil {
 								return "", err
 							}
-							for _, m := range msgs {
-								sMes := slacklog.Message{
-									Message: m,
-								}
+							for _, m := range rr.Messages {
 								// スレッドのルートとブロードキャストメッセージは通常のログに含まれるのでここでは弾く
-								if !sMes.IsRootOfThread() && sMes.SubType != "thread_broadcast" {
-									r.Messages = append(r.Messages, &sMes)
+								if !m.IsRootOfThread() && m.SubType != "thread_broadcast" {
+									r.Messages = append(r.Messages, m)
 								}
 							}
-							if hasMore {
-								return slackadapter.Cursor(nextCursor), nil
+							if m := rr.ResponseMetadata; rr.HasMore && m != nil {
+								return m.NextCursor, nil
 							}
 							return "", nil
 						}))
@@ -153,16 +167,18 @@ func run(token, datadir, date string, verbose bool) error {
 // sub-command.
 func NewCLICommand() *cli.Command {
 	var (
-		token   string
-		datadir string
-		date    string
-		verbose bool
+		token      string
+		datadir    string
+		configPath string
+		date       string
+		timezone   string
+		verbose    bool
 	)
 	return &cli.Command{
 		Name:  "fetch-messages",
 		Usage: "fetch messages of channel by day",
 		Action: func(c *cli.Context) error {
-			return run(token, datadir, date, verbose)
+			return run(token, datadir, configPath, date, timezone, verbose)
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -179,10 +195,20 @@ func NewCLICommand() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:        "date",
-				Usage:       "target date to get",
-				Value:       toDateString(time.Now()),
+				Usage:       "target date to get (default: today)",
 				Destination: &date,
 			},
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "config.json path, which has the timezone",
+				Value:       filepath.Join("scripts", "config.json"),
+				Destination: &configPath,
+			},
+			&cli.StringFlag{
+				Name:        "timezone",
+				Usage:       "timezone in which days are split (default: timezone in config)",
+				Destination: &timezone,
+			},
 			&cli.BoolFlag{
 				Name:        "verbose",
 				Usage:       "verbose log",
@@ -2,6 +2,8 @@ package fetchusers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"path/filepath"
 
 	cli "github.com/urfave/cli/v2"
@@ -38,7 +40,33 @@ func run(token, datadir string, excludeArchived, verbose bool) error {
 		return err
 	}
 
-	return nil
+	return fetchUserGroups(token, datadir)
+}
+
+// fetchUserGroups fetches user groups and saves them into usergroups.json.
+// User groups are optional, so a token without the usergroups:read scope is
+// not an error.
+func fetchUserGroups(token, datadir string) error {
+	groups, err := slackadapter.UserGroups(context.Background(), token)
+	if err != nil {
+		var e *slackadapter.Error
+		if errors.As(err, &e) && e.Err == "missing_scope" {
+			log.Printf("[WARN] skip fetching user groups: the token doesn't have usergroups:read scope")
+			return nil
+		}
+		return err
+	}
+	fw, err := jsonwriter.CreateFile(filepath.Join(datadir, "usergroups.json"), true)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := fw.Write(g); err != nil {
+			fw.Close()
+			return err
+		}
+	}
+	return fw.Close()
 }
 
 // NewCLICommand creates a cli.Command, which provides "fetch-users"
@@ -35,11 +35,24 @@ var GenerateHTMLCommand = &cli.Command{
 			Usage: "slacklog_data dir",
 			Value: filepath.Join("_logdata", "slacklog_data"),
 		},
+		&cli.StringFlag{
+			Name:  "sqlite",
+			Usage: "read logs from SQLite database created by import-sqlite, instead of indir",
+		},
 		&cli.StringFlag{
 			Name:  "outdir",
 			Usage: "generated html target dir",
 			Value: "_site",
 		},
+		&cli.BoolFlag{
+			Name:  "full",
+			Usage: "regenerate all pages even if their inputs are not changed",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: html, json or text",
+			Value: "html",
+		},
 	},
 }
 
@@ -56,11 +69,25 @@ func generateHTML(c *cli.Context) error {
 		return fmt.Errorf("could not read config: %w", err)
 	}
 
-	s, err := slacklog.NewLogStore(inDir, cfg)
+	s, err := slacklog.OpenLogStore(inDir, c.String("sqlite"), cfg)
 	if err != nil {
 		return err
 	}
+	defer s.Close()
+
+	var r slacklog.Renderer
+	switch format := c.String("format"); format {
+	case "html":
+		r = slacklog.NewHTMLGenerator(templateDir, filesDir, s, cfg)
+	case "json":
+		r = slacklog.NewJSONRenderer()
+	case "text":
+		r = slacklog.NewTextRenderer(s)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
 
-	g := slacklog.NewHTMLGenerator(templateDir, filesDir, s)
+	g := slacklog.NewGenerator(s, cfg, r)
+	g.SetFullRebuild(c.Bool("full"))
 	return g.Generate(outDir)
 }
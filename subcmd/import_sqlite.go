@@ -0,0 +1,49 @@
+package subcmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+// ImportSQLiteCommand provoides "import-sqlite" command.
+// It... ログデータをSQLiteのデータベースに取り込む。
+var ImportSQLiteCommand = &cli.Command{
+	Name:   "import-sqlite",
+	Usage:  "import slacklog_data into a SQLite database",
+	Action: importSQLite,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "config.json path",
+			Value: filepath.Join("scripts", "config.json"),
+		},
+		&cli.StringFlag{
+			Name:  "indir",
+			Usage: "slacklog_data dir",
+			Value: filepath.Join("_logdata", "slacklog_data"),
+		},
+		&cli.StringFlag{
+			Name:  "db",
+			Usage: "SQLite database path",
+			Value: filepath.Join("_logdata", "slacklog.db"),
+		},
+	},
+}
+
+// importSQLite : ログデータをSQLiteのデータベースに取り込む。前回の取り込みか
+// ら変更されたファイルのみを読み込む。
+func importSQLite(c *cli.Context) error {
+	configJSONPath := filepath.Clean(c.String("config"))
+	inDir := filepath.Clean(c.String("indir"))
+	dbPath := filepath.Clean(c.String("db"))
+
+	cfg, err := slacklog.ReadConfig(configJSONPath)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	return slacklog.ImportSQLite(inDir, cfg, dbPath)
+}
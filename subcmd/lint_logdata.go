@@ -0,0 +1,94 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+// LintLogdataCommand provoides "lint-logdata" command.
+// It... ログデータを検査し、問題があれば報告する。
+var LintLogdataCommand = &cli.Command{
+	Name:   "lint-logdata",
+	Usage:  "check problems in slacklog_data",
+	Action: lintLogdata,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "config.json path",
+			Value: filepath.Join("scripts", "config.json"),
+		},
+		&cli.StringFlag{
+			Name:  "indir",
+			Usage: "slacklog_data dir",
+			Value: filepath.Join("_logdata", "slacklog_data"),
+		},
+		&cli.StringFlag{
+			Name:  "filesdir",
+			Usage: "files downloaded dir, attached files are not checked when empty",
+			Value: filepath.Join("_logdata", "files"),
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: text or json",
+			Value: "text",
+		},
+	},
+}
+
+// lintLogdata : ログデータを検査し、見つかった問題を標準出力に出力する。問題が
+// ある場合はエラーを返し、終了ステータスを0以外にする。
+func lintLogdata(c *cli.Context) error {
+	configJSONPath := filepath.Clean(c.String("config"))
+	inDir := filepath.Clean(c.String("indir"))
+	filesDir := c.String("filesdir")
+	if filesDir != "" {
+		filesDir = filepath.Clean(filesDir)
+	}
+
+	format := c.String("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	cfg, err := slacklog.ReadConfig(configJSONPath)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	s, err := slacklog.NewLogStore(inDir, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	problems, err := slacklog.LintLogData(s, filesDir)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		if problems == nil {
+			problems = []slacklog.LintProblem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(problems); err != nil {
+			return err
+		}
+	case "text":
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(problems), inDir)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package subcmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/vim-jp/slacklog-generator/internal/slacklog"
+)
+
+// SearchCommand provides "search" command.
+// build-indexで作成した索引を使い、検索ページと同じ方法でメッセージを検索する。
+var SearchCommand = &cli.Command{
+	Name:      "search",
+	Usage:     "search messages with the index built by build-index",
+	ArgsUsage: "QUERY...",
+	Action:    search,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "config.json path",
+			Value: filepath.Join("scripts", "config.json"),
+		},
+		&cli.StringFlag{
+			Name:  "indir",
+			Usage: "slacklog_data dir, to show texts of messages. texts are not shown when empty",
+			Value: filepath.Join("_logdata", "slacklog_data"),
+		},
+		&cli.StringFlag{
+			Name:     "indexdir",
+			Usage:    "index dir built by build-index",
+			Required: true,
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "max number of messages to show, 0 shows all",
+			Value: 20,
+		},
+		&cli.BoolFlag{
+			Name:  "no-color",
+			Usage: "enclose matched words with [[ and ]] instead of colors",
+		},
+	},
+}
+
+// search : QUERYを含むメッセージを新しい順に、チャンネル、日時、投稿者と一致
+// した箇所と共に出力する。
+func search(c *cli.Context) error {
+	query := strings.Join(c.Args().Slice(), " ")
+	if query == "" {
+		return fmt.Errorf("QUERY is required")
+	}
+	configJSONPath := filepath.Clean(c.String("config"))
+	inDir := c.String("indir")
+	indexDir := filepath.Clean(c.String("indexdir"))
+	limit := c.Int("limit")
+
+	open, close := "\x1b[1;31m", "\x1b[0m"
+	if c.Bool("no-color") {
+		open, close = "[[", "]]"
+	}
+
+	cfg, err := slacklog.ReadConfig(configJSONPath)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	var s *slacklog.LogStore
+	if inDir != "" {
+		s, err = slacklog.NewLogStore(filepath.Clean(inDir), cfg)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	loc, err := slacklog.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return err
+	}
+	q, err := slacklog.ParseSearchQuery(query, loc)
+	if err != nil {
+		return err
+	}
+	r, err := slacklog.NewIndexReader(indexDir)
+	if err != nil {
+		return fmt.Errorf("could not read index: %w", err)
+	}
+	results, err := r.Search(q)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d messages found\n", len(results))
+	for i, res := range results {
+		if limit > 0 && i >= limit {
+			break
+		}
+		author := res.User.DisplayName
+		if author == "" {
+			author = res.User.Name
+		}
+		if author == "" {
+			author = res.User.ID
+		}
+		t := slacklog.TsToDateTime(res.Timestamp, loc)
+		fmt.Printf("\n#%s %s %s (%s)\n", res.Channel.Name, t.Format("2006-01-02 15:04:05"), author, strings.Join(res.FieldNames(), ", "))
+		if s == nil {
+			continue
+		}
+		if msg, ok := s.GetMessage(res.Channel.ID, res.Timestamp); ok {
+			fmt.Printf("    %s\n", res.Snippet(msg.Text, 80, open, close))
+		}
+	}
+	return nil
+}